@@ -0,0 +1,198 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// UserPath specifies the user resource path.
+const UserPath = "/user/"
+
+// TokenPath specifies the token resource path.
+const TokenPath = "/token/"
+
+var users = NewStore()
+
+// verifier verifies bearer tokens which are JWTs; nil disables them.
+var verifier *Verifier
+
+// registration is the policy of the creation of new users.
+var registration struct {
+	open       bool   // Anyone can create a user.
+	adminToken string // Bearer token allowing the creation of users; empty disables it.
+}
+
+// SetStore sets the store used to authenticate requests.
+// It must be called before the server starts handling requests.
+func SetStore(s *Store) {
+	users = s
+}
+
+// SetVerifier sets the verifier used to authenticate requests carrying
+// a JWT as the bearer token. It must be called before the server starts
+// handling requests.
+func SetVerifier(v *Verifier) {
+	verifier = v
+}
+
+// SetRegistration sets whether anyone can create a new user, or only
+// the requests carrying adminToken as the bearer token. Nobody can create
+// users if registration isn't open and adminToken is empty. It must be
+// called before the server starts handling requests.
+func SetRegistration(open bool, adminToken string) {
+	registration.open, registration.adminToken = open, adminToken
+}
+
+// authenticate returns the user who owns the bearer token,
+// which is either a JWT or an API token.
+func authenticate(token string) (*User, error) {
+	if verifier != nil && strings.Count(token, ".") == 2 {
+		return verifier.User(token)
+	}
+	u, ok := users.Authenticate(token)
+	if !ok {
+		return nil, fmt.Errorf("invalid token")
+	}
+	return u, nil
+}
+
+// bearer extracts the bearer token from the Authorization header.
+func bearer(r *http.Request) (string, bool) {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(h[len(prefix):]), true
+}
+
+// unauthorized writes a response to the request which failed to authenticate.
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="todo"`)
+	w.Header().Add("WWW-Authenticate", `Basic realm="todo"`)
+	http.Error(w, fmt.Sprintf("%d %v", http.StatusUnauthorized, err), http.StatusUnauthorized)
+}
+
+// Required wraps fn so it's called only for the requests carrying a valid
+// API token or JWT in the Authorization header. For the clients which
+// can't send bearer tokens, like calendar apps, the token may also be
+// sent as the password of the Basic authentication with the name of
+// its owner as the user name. The user who owns the token is stored
+// in the request context.
+func Required(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := bearer(r)
+		name, basic := "", false
+		if !ok {
+			name, token, basic = r.BasicAuth()
+		}
+		if !ok && !basic {
+			unauthorized(w, fmt.Errorf("missing bearer token"))
+			return
+		}
+		u, err := authenticate(token)
+		if err == nil && basic && name != u.Name && JWTPrefix+name != u.Name {
+			err = fmt.Errorf("token of another user")
+		}
+		if err != nil {
+			unauthorized(w, err)
+			return
+		}
+		fn(w, r.WithContext(NewContext(r.Context(), u)))
+	}
+}
+
+// UserAPI is a handler function that handles http requests for the creation
+// of a new user. The response carries the first API token of the user.
+// Unless registration is open, the request must carry the admin token.
+func UserAPI(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" || r.URL.Path != UserPath {
+		http.Error(w, fmt.Sprintf("%d %s %s doesn't implemented", http.StatusBadRequest, r.Method, r.URL.Path), http.StatusBadRequest)
+		return
+	}
+	if !registration.open {
+		token, ok := bearer(r)
+		if !ok || registration.adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(registration.adminToken)) != 1 {
+			unauthorized(w, fmt.Errorf("registration requires the admin token"))
+			return
+		}
+	}
+	req := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("%d %v", http.StatusBadRequest, err), http.StatusBadRequest)
+		return
+	}
+	u, err := users.AddUser(req.Name)
+	switch err {
+	case nil:
+	case ErrUserExists:
+		http.Error(w, fmt.Sprintf("%d %v", http.StatusConflict, err), http.StatusConflict)
+		return
+	case ErrUserEmptyName, ErrUserInvalidName:
+		http.Error(w, fmt.Sprintf("%d %v", http.StatusBadRequest, err), http.StatusBadRequest)
+		return
+	default:
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeToken(w, u.Name)
+}
+
+// TokenAPI is a handler function that handles http requests to the token
+// resources of the authenticated user. It must be wrapped by Required.
+func TokenAPI(w http.ResponseWriter, r *http.Request) {
+	u, ok := FromContext(r.Context())
+	if !ok {
+		unauthorized(w, fmt.Errorf("missing user"))
+		return
+	}
+	switch id := r.URL.Path[len(TokenPath):]; {
+	case r.Method == "GET" && id == "":
+		res := struct {
+			Tokens []*Token `json:"tokens"`
+		}{
+			users.Tokens(u.Name),
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(res)
+	case r.Method == "POST" && id == "":
+		writeToken(w, u.Name)
+	case r.Method == "DELETE" && id != "":
+		switch err := users.Revoke(u.Name, id); err {
+		case nil:
+		case ErrRevokeUnknown:
+			http.Error(w, fmt.Sprintf("%d %v", http.StatusNotFound, err), http.StatusNotFound)
+		default:
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+		}
+	default:
+		http.Error(w, fmt.Sprintf("%d %s %s doesn't implemented", http.StatusBadRequest, r.Method, r.URL.Path), http.StatusBadRequest)
+	}
+}
+
+// writeToken issues a new token for user and writes it to the response.
+func writeToken(w http.ResponseWriter, user string) {
+	token, t, err := users.Issue(user)
+	if err != nil {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+	res := struct {
+		Secret string `json:"token"`
+		*Token
+	}{
+		token,
+		t,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
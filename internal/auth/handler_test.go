@@ -0,0 +1,205 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func checkStatusCode(got, want int) error {
+	if got != want {
+		return fmt.Errorf("got status code %d; want %d", got, want)
+	}
+	return nil
+}
+
+// send sends a request authenticated with token to handler h.
+func send(t *testing.T, h http.HandlerFunc, method, path, token, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// adminToken allows the creation of users in the tests.
+const adminToken = "admin-secret"
+
+func init() {
+	SetRegistration(false, adminToken)
+}
+
+// signup creates a new user and returns its token.
+func signup(t *testing.T, name string) string {
+	rec := send(t, UserAPI, "POST", UserPath, adminToken, `{"name":"`+name+`"}`)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s: %v", UserPath, err)
+	}
+	res := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res.Token
+}
+
+func TestRequired(t *testing.T) {
+	users = NewStore()
+	token := signup(t, "alice")
+
+	var got *User
+	h := Required(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})
+	if rec := send(t, h, "GET", "/", token, ""); rec.Code != http.StatusOK || got == nil || got.Name != "alice" {
+		t.Errorf("valid token: got status code %d, user %v; want %d, alice", rec.Code, got, http.StatusOK)
+	}
+
+	for _, token := range []string{"", "invalid", token + "0"} {
+		rec := send(t, h, "GET", "/", token, "")
+		if err := checkStatusCode(rec.Code, http.StatusUnauthorized); err != nil {
+			t.Errorf("token %q: %v", token, err)
+		}
+		if rec.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("token %q: missing WWW-Authenticate header", token)
+		}
+	}
+}
+
+func TestRequiredBasic(t *testing.T) {
+	users = NewStore()
+	token := signup(t, "alice")
+	signup(t, "bob")
+
+	var got *User
+	h := Required(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})
+	for _, test := range []struct {
+		name, token string
+		code        int
+	}{
+		{"alice", token, http.StatusOK},
+		{"bob", token, http.StatusUnauthorized},
+		{"", token, http.StatusUnauthorized},
+		{"alice", "invalid", http.StatusUnauthorized},
+	} {
+		got = nil
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(test.name, test.token)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("Basic %s:%s: %v", test.name, test.token, err)
+		}
+		if test.code == http.StatusOK && (got == nil || got.Name != test.name) {
+			t.Errorf("Basic %s:%s: got user %v; want %s", test.name, test.token, got, test.name)
+		}
+		if test.code != http.StatusOK && len(rec.Header()["Www-Authenticate"]) != 2 {
+			t.Errorf("Basic %s:%s: got WWW-Authenticate %q; want Bearer and Basic challenges", test.name, test.token, rec.Header()["Www-Authenticate"])
+		}
+	}
+}
+
+func TestUserReqError(t *testing.T) {
+	users = NewStore()
+	signup(t, "alice")
+	for _, test := range []struct {
+		method string
+		json   string
+		code   int
+	}{
+		{"POST", `{"name":"alice"}`, http.StatusConflict},
+		{"POST", `{"name":""}`, http.StatusBadRequest},
+		{"POST", `{"name":"jwt:alice"}`, http.StatusBadRequest},
+		{"POST", `{"name":}`, http.StatusBadRequest},
+		{"GET", ``, http.StatusBadRequest},
+	} {
+		rec := send(t, UserAPI, test.method, UserPath, adminToken, test.json)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("%s %s %s: %v", test.method, UserPath, test.json, err)
+		}
+	}
+}
+
+func TestRegistration(t *testing.T) {
+	defer SetRegistration(registration.open, registration.adminToken)
+	for i, test := range []struct {
+		open       bool
+		adminToken string
+		token      string
+		code       int
+	}{
+		{true, "", "", http.StatusOK},
+		{false, "secret", "secret", http.StatusOK},
+		{false, "secret", "", http.StatusUnauthorized},
+		{false, "secret", "secret0", http.StatusUnauthorized},
+		{false, "", "", http.StatusUnauthorized},
+	} {
+		users = NewStore()
+		SetRegistration(test.open, test.adminToken)
+		body := fmt.Sprintf(`{"name":"user%d"}`, i)
+		rec := send(t, UserAPI, "POST", UserPath, test.token, body)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("POST %s with registration open: %t, admin token %q and token %q: %v", UserPath, test.open, test.adminToken, test.token, err)
+		}
+	}
+}
+
+func TestTokenReq(t *testing.T) {
+	users = NewStore()
+	token := signup(t, "alice")
+	api := Required(TokenAPI)
+
+	// Issue a second token.
+	rec := send(t, api, "POST", TokenPath, token, "")
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s: %v", TokenPath, err)
+	}
+	issued := struct {
+		Token string `json:"token"`
+		ID    string `json:"id"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&issued); err != nil {
+		t.Fatal(err)
+	}
+
+	// List the tokens.
+	rec = send(t, api, "GET", TokenPath, issued.Token, "")
+	list := struct {
+		Tokens []*Token `json:"tokens"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(list.Tokens), 2; got != want {
+		t.Errorf("GET %s: got %d tokens; want %d", TokenPath, got, want)
+	}
+
+	// Revoke the second token.
+	if rec := send(t, api, "DELETE", TokenPath+issued.ID, token, ""); rec.Code != http.StatusOK {
+		t.Errorf("DELETE %s%s: got status code %d; want %d", TokenPath, issued.ID, rec.Code, http.StatusOK)
+	}
+	if rec := send(t, api, "GET", TokenPath, issued.Token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got status code %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := send(t, api, "DELETE", TokenPath+issued.ID, token, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("DELETE %s%s again: got status code %d; want %d", TokenPath, issued.ID, rec.Code, http.StatusNotFound)
+	}
+}
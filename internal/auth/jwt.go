@@ -0,0 +1,336 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JWTPrefix prefixes the names of the users authenticated by JWTs,
+// so they never clash with the names of the users of a Store.
+const JWTPrefix = "jwt:"
+
+// ErrTokenMalformed indicates a token which isn't a well formed JWT.
+var ErrTokenMalformed = errors.New("jwt: malformed token")
+
+// ErrTokenSignature indicates a token with an invalid signature.
+var ErrTokenSignature = errors.New("jwt: invalid signature")
+
+// ErrTokenExpired indicates a token used after its expiration time.
+var ErrTokenExpired = errors.New("jwt: token is expired")
+
+// ErrTokenNoExpiration indicates a token without the exp claim
+// verified by a Verifier requiring it.
+var ErrTokenNoExpiration = errors.New("jwt: missing expiration time")
+
+// ErrTokenNotValidYet indicates a token used before its not before time.
+var ErrTokenNotValidYet = errors.New("jwt: token is not valid yet")
+
+// ErrTokenAudience indicates a token issued for another audience.
+var ErrTokenAudience = errors.New("jwt: invalid audience")
+
+// ErrTokenIssuer indicates a token issued by an unexpected issuer.
+var ErrTokenIssuer = errors.New("jwt: invalid issuer")
+
+// ErrTokenNoUser indicates a token without the claim naming the user.
+var ErrTokenNoUser = errors.New("jwt: missing user claim")
+
+// Claims holds the claims of a verified token.
+type Claims map[string]interface{}
+
+// time returns the claim name as time. It returns false
+// if the claim is missing or isn't a number.
+func (c Claims) time(name string) (time.Time, bool) {
+	f, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(f), 0), true
+}
+
+// hasAudience reports whether aud is one of the audiences of the claims.
+func (c Claims) hasAudience(aud string) bool {
+	switch v := c["aud"].(type) {
+	case string:
+		return v == aud
+	case []interface{}:
+		for _, a := range v {
+			if a == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Verifier verifies JSON Web Tokens signed by HS256 or RS256 algorithm
+// and maps them to users. It is safe for concurrent use.
+type Verifier struct {
+	// Audience is required in the aud claim if not empty.
+	Audience string
+
+	// Issuer is required in the iss claim if not empty.
+	Issuer string
+
+	// UserClaim names the claim carrying the user name; sub by default.
+	UserClaim string
+
+	// Leeway is the allowed clock skew of exp and nbf claims.
+	Leeway time.Duration
+
+	// RequireExp rejects tokens without the exp claim, which never expire.
+	RequireExp bool
+
+	mu   sync.RWMutex
+	keys map[string]interface{} // Keys by their ids; either []byte or *rsa.PublicKey.
+	now  func() time.Time
+}
+
+// NewVerifier returns a new Verifier without any keys.
+func NewVerifier() *Verifier {
+	return &Verifier{
+		keys: make(map[string]interface{}),
+		now:  time.Now,
+	}
+}
+
+// AddHMACKey adds the HS256 secret with given key id.
+// An empty key id matches tokens without the kid header.
+func (v *Verifier) AddHMACKey(kid string, secret []byte) {
+	v.mu.Lock()
+	v.keys[kid] = secret
+	v.mu.Unlock()
+}
+
+// AddRSAKey adds the RS256 public key with given key id.
+// An empty key id matches tokens without the kid header.
+func (v *Verifier) AddRSAKey(kid string, key *rsa.PublicKey) {
+	v.mu.Lock()
+	v.keys[kid] = key
+	v.mu.Unlock()
+}
+
+// LoadHMACKeyFile adds the HS256 secret read from the file with given key id.
+// Leading and trailing white space of the file content is ignored.
+func (v *Verifier) LoadHMACKeyFile(kid, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	secret := []byte(strings.TrimSpace(string(b)))
+	if len(secret) == 0 {
+		return fmt.Errorf("jwt: empty secret in %s", path)
+	}
+	v.AddHMACKey(kid, secret)
+	return nil
+}
+
+// LoadRSAKeyFile adds the RS256 public key read from the PEM encoded
+// file with given key id. The file may contain a PKIX or PKCS #1
+// public key or a certificate.
+func (v *Verifier) LoadRSAKeyFile(kid, path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return fmt.Errorf("jwt: no PEM data in %s", path)
+	}
+	var key interface{}
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		var cert *x509.Certificate
+		if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+			key = cert.PublicKey
+		}
+	default:
+		err = fmt.Errorf("jwt: unsupported PEM block %q in %s", block.Type, path)
+	}
+	if err != nil {
+		return err
+	}
+	rk, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("jwt: %s doesn't contain an RSA public key", path)
+	}
+	v.AddRSAKey(kid, rk)
+	return nil
+}
+
+// LoadJWKSFile adds the keys from the JSON Web Key Set document read
+// from the file. Only RSA and symmetric (oct) keys are supported;
+// the other keys and keys not meant for signing are skipped.
+func (v *Verifier) LoadJWKSFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	set := struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			K   string `json:"k"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(b, &set); err != nil {
+		return fmt.Errorf("jwt: %s: %v", path, err)
+	}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(k.N)
+			if err != nil {
+				return fmt.Errorf("jwt: %s: key %q: %v", path, k.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(k.E)
+			if err != nil {
+				return fmt.Errorf("jwt: %s: key %q: %v", path, k.Kid, err)
+			}
+			v.AddRSAKey(k.Kid, &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			})
+		case "oct":
+			secret, err := base64.RawURLEncoding.DecodeString(k.K)
+			if err != nil {
+				return fmt.Errorf("jwt: %s: key %q: %v", path, k.Kid, err)
+			}
+			v.AddHMACKey(k.Kid, secret)
+		}
+	}
+	return nil
+}
+
+// key returns the key with given id.
+func (v *Verifier) key(kid string) (interface{}, bool) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	k, ok := v.keys[kid]
+	return k, ok
+}
+
+// Verify verifies the signature and the registered claims of the token
+// and returns its claims. The signing algorithm must match the type of
+// the key selected by the kid header.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrTokenMalformed
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrTokenMalformed
+	}
+
+	key, ok := v.key(header.Kid)
+	if !ok {
+		return nil, fmt.Errorf("jwt: unknown key %q", header.Kid)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch k := key.(type) {
+	case []byte:
+		if header.Alg != "HS256" {
+			return nil, fmt.Errorf("jwt: algorithm %q doesn't match the key", header.Alg)
+		}
+		mac := hmac.New(sha256.New, k)
+		mac.Write(signed)
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return nil, ErrTokenSignature
+		}
+	case *rsa.PublicKey:
+		if header.Alg != "RS256" {
+			return nil, fmt.Errorf("jwt: algorithm %q doesn't match the key", header.Alg)
+		}
+		h := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) != nil {
+			return nil, ErrTokenSignature
+		}
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return nil, err
+	}
+	now := v.now()
+	exp, ok := c.time("exp")
+	switch {
+	case !ok && v.RequireExp:
+		return nil, ErrTokenNoExpiration
+	case ok && !now.Before(exp.Add(v.Leeway)):
+		return nil, ErrTokenExpired
+	}
+	if nbf, ok := c.time("nbf"); ok && now.Add(v.Leeway).Before(nbf) {
+		return nil, ErrTokenNotValidYet
+	}
+	if v.Audience != "" && !c.hasAudience(v.Audience) {
+		return nil, ErrTokenAudience
+	}
+	if v.Issuer != "" && c["iss"] != v.Issuer {
+		return nil, ErrTokenIssuer
+	}
+	return c, nil
+}
+
+// User verifies the token and returns the user named by its claims.
+// The name of the user is prefixed by JWTPrefix.
+func (v *Verifier) User(token string) (*User, error) {
+	c, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	claim := v.UserClaim
+	if claim == "" {
+		claim = "sub"
+	}
+	name, ok := c[claim].(string)
+	if !ok || name == "" {
+		return nil, ErrTokenNoUser
+	}
+	return &User{Name: JWTPrefix + name}, nil
+}
+
+// decodeSegment decodes the base64url encoded JSON segment of a token into v.
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrTokenMalformed
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrTokenMalformed
+	}
+	return nil
+}
@@ -0,0 +1,306 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1426691590, 0)
+
+// testRSAKey is generated once because the generation is slow.
+var testRSAKey *rsa.PrivateKey
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	if testRSAKey == nil {
+		k, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testRSAKey = k
+	}
+	return testRSAKey
+}
+
+// sign returns a token with the claims signed by key,
+// which is either []byte or *rsa.PrivateKey.
+func sign(t *testing.T, kid string, key interface{}, claims map[string]interface{}) string {
+	header := map[string]string{"typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	switch key.(type) {
+	case []byte:
+		header["alg"] = "HS256"
+	case *rsa.PrivateKey:
+		header["alg"] = "RS256"
+	}
+	enc := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	signed := enc(header) + "." + enc(claims)
+
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		h := sha256.Sum256([]byte(signed))
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, h[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func newTestVerifier() *Verifier {
+	v := NewVerifier()
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("secret")
+	key := rsaKey(t)
+	v := newTestVerifier()
+	v.Audience = "todo"
+	v.Issuer = "https://id.example.com"
+	v.AddHMACKey("", secret)
+	v.AddRSAKey("rsa", &key.PublicKey)
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"sub": "alice",
+			"iss": "https://id.example.com",
+			"aud": []string{"other", "todo"},
+			"exp": testNow.Add(time.Hour).Unix(),
+			"nbf": testNow.Add(-time.Hour).Unix(),
+		}
+	}
+	with := func(k string, val interface{}) map[string]interface{} {
+		c := valid()
+		if val == nil {
+			delete(c, k)
+		} else {
+			c[k] = val
+		}
+		return c
+	}
+
+	for _, test := range []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"HS256", sign(t, "", secret, valid()), nil},
+		{"RS256", sign(t, "rsa", key, valid()), nil},
+		{"single audience", sign(t, "", secret, with("aud", "todo")), nil},
+		{"no exp", sign(t, "", secret, with("exp", nil)), nil},
+		{"expired", sign(t, "", secret, with("exp", testNow.Add(-time.Second).Unix())), ErrTokenExpired},
+		{"not valid yet", sign(t, "", secret, with("nbf", testNow.Add(time.Minute).Unix())), ErrTokenNotValidYet},
+		{"wrong audience", sign(t, "", secret, with("aud", "other")), ErrTokenAudience},
+		{"no audience", sign(t, "", secret, with("aud", nil)), ErrTokenAudience},
+		{"wrong issuer", sign(t, "", secret, with("iss", "https://evil.example.com")), ErrTokenIssuer},
+		{"wrong secret", sign(t, "", []byte("other"), valid()), ErrTokenSignature},
+		{"malformed", "a.b", ErrTokenMalformed},
+		{"malformed header", "!.b.c", ErrTokenMalformed},
+	} {
+		_, err := v.Verify(test.token)
+		if err != test.err {
+			t.Errorf("Verify(%s): got error %v; want %v", test.name, err, test.err)
+		}
+	}
+
+	// Algorithm confusion: an HS256 token signed by the RSA public key.
+	pub := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	if _, err := v.Verify(sign(t, "rsa", pub, valid())); err == nil {
+		t.Errorf("Verify(HS256 token for RSA key): expected error")
+	}
+	if _, err := v.Verify(sign(t, "unknown", secret, valid())); err == nil {
+		t.Errorf("Verify(token with unknown kid): expected error")
+	}
+}
+
+func TestVerifierRequireExp(t *testing.T) {
+	v := newTestVerifier()
+	v.RequireExp = true
+	v.AddHMACKey("", []byte("secret"))
+	for _, test := range []struct {
+		name   string
+		claims map[string]interface{}
+		err    error
+	}{
+		{"exp", map[string]interface{}{"sub": "alice", "exp": testNow.Add(time.Hour).Unix()}, nil},
+		{"no exp", map[string]interface{}{"sub": "alice"}, ErrTokenNoExpiration},
+		{"malformed exp", map[string]interface{}{"sub": "alice", "exp": "tomorrow"}, ErrTokenNoExpiration},
+		{"expired", map[string]interface{}{"sub": "alice", "exp": testNow.Unix()}, ErrTokenExpired},
+	} {
+		if _, err := v.Verify(sign(t, "", []byte("secret"), test.claims)); err != test.err {
+			t.Errorf("Verify(%s) requiring exp: got error %v; want %v", test.name, err, test.err)
+		}
+	}
+}
+
+func TestVerifierLeeway(t *testing.T) {
+	v := newTestVerifier()
+	v.Leeway = time.Minute
+	v.AddHMACKey("", []byte("secret"))
+	token := sign(t, "", []byte("secret"), map[string]interface{}{"sub": "alice", "exp": testNow.Add(-30 * time.Second).Unix()})
+	if _, err := v.Verify(token); err != nil {
+		t.Errorf("Verify(token expired within leeway): unexpected error: %v", err)
+	}
+}
+
+func TestVerifierUser(t *testing.T) {
+	v := newTestVerifier()
+	v.AddHMACKey("", []byte("secret"))
+	token := sign(t, "", []byte("secret"), map[string]interface{}{"sub": "alice", "email": "alice@example.com"})
+	if u, err := v.User(token); err != nil || u.Name != JWTPrefix+"alice" {
+		t.Errorf("User(...) = %v, %v; want %salice, <nil>", u, err, JWTPrefix)
+	}
+	v.UserClaim = "email"
+	if u, err := v.User(token); err != nil || u.Name != JWTPrefix+"alice@example.com" {
+		t.Errorf("User(...) with email claim = %v, %v; want %salice@example.com, <nil>", u, err, JWTPrefix)
+	}
+	v.UserClaim = "name"
+	if _, err := v.User(token); err != ErrTokenNoUser {
+		t.Errorf("User(...) without name claim: got error %v; want %v", err, ErrTokenNoUser)
+	}
+}
+
+func TestLoadKeyFiles(t *testing.T) {
+	dir := t.TempDir()
+	key := rsaKey(t)
+	write := func(name string, b []byte) string {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, b, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	pkix, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA", "kid": "jwks-rsa", "use": "sig",
+				"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+			{"kty": "oct", "kid": "jwks-oct", "k": base64.RawURLEncoding.EncodeToString([]byte("jwks secret"))},
+			{"kty": "EC", "kid": "jwks-ec"},
+			{"kty": "RSA", "kid": "jwks-enc", "use": "enc"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := newTestVerifier()
+	if err := v.LoadHMACKeyFile("hmac", write("secret", []byte("file secret\n"))); err != nil {
+		t.Fatalf("LoadHMACKeyFile: unexpected error: %v", err)
+	}
+	if err := v.LoadRSAKeyFile("pem", write("key.pem", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pkix}))); err != nil {
+		t.Fatalf("LoadRSAKeyFile: unexpected error: %v", err)
+	}
+	if err := v.LoadJWKSFile(write("jwks.json", jwks)); err != nil {
+		t.Fatalf("LoadJWKSFile: unexpected error: %v", err)
+	}
+
+	claims := map[string]interface{}{"sub": "alice"}
+	for _, token := range []string{
+		sign(t, "hmac", []byte("file secret"), claims),
+		sign(t, "pem", key, claims),
+		sign(t, "jwks-rsa", key, claims),
+		sign(t, "jwks-oct", []byte("jwks secret"), claims),
+	} {
+		if _, err := v.Verify(token); err != nil {
+			t.Errorf("Verify(%q): unexpected error: %v", token, err)
+		}
+	}
+	if _, ok := v.key("jwks-enc"); ok {
+		t.Errorf("LoadJWKSFile: loaded encryption key")
+	}
+
+	for _, err := range []error{
+		v.LoadHMACKeyFile("", write("empty", nil)),
+		v.LoadRSAKeyFile("", write("garbage.pem", []byte("garbage"))),
+		v.LoadJWKSFile(write("garbage.json", []byte("garbage"))),
+		v.LoadJWKSFile(filepath.Join(dir, "missing.json")),
+	} {
+		if err == nil {
+			t.Errorf("loading invalid key file: expected error")
+		}
+	}
+}
+
+func TestRequiredJWT(t *testing.T) {
+	users = NewStore()
+	v := newTestVerifier()
+	v.AddHMACKey("", []byte("secret"))
+	SetVerifier(v)
+	defer SetVerifier(nil)
+
+	var got *User
+	h := Required(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})
+	token := sign(t, "", []byte("secret"), map[string]interface{}{"sub": "alice"})
+	if rec := send(t, h, "GET", "/", token, ""); rec.Code != http.StatusOK || got == nil || got.Name != JWTPrefix+"alice" {
+		t.Errorf("valid JWT: got status code %d, user %v; want %d, %salice", rec.Code, got, http.StatusOK, JWTPrefix)
+	}
+
+	// The local user alice isn't the JWT user alice.
+	local := signup(t, "alice")
+	if rec := send(t, h, "GET", "/", local, ""); rec.Code != http.StatusOK || got == nil || got.Name != "alice" {
+		t.Errorf("token of local user: got status code %d, user %v; want %d, alice", rec.Code, got, http.StatusOK)
+	}
+	for _, test := range []struct {
+		name string
+		code int
+	}{
+		{"alice", http.StatusOK},
+		{"bob", http.StatusUnauthorized},
+	} {
+		req, err := http.NewRequest("GET", "/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth(test.name, token)
+		rec := httptest.NewRecorder()
+		h(rec, req)
+		if rec.Code != test.code {
+			t.Errorf("Basic %s with JWT of alice: got status code %d; want %d", test.name, rec.Code, test.code)
+		}
+	}
+	token = sign(t, "", []byte("other"), map[string]interface{}{"sub": "alice"})
+	if rec := send(t, h, "GET", "/", token, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("invalid JWT: got status code %d; want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,288 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package auth implements user accounts and API token authentication.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUserExists indicates attempt to add a user with a name which is already taken.
+var ErrUserExists = errors.New("AddUser: user already exists")
+
+// ErrUserEmptyName indicates attempt to add a user with an empty name.
+var ErrUserEmptyName = errors.New("AddUser: empty name")
+
+// ErrUserInvalidName indicates attempt to add a user with a name containing
+// a colon, which is reserved for the users authenticated by JWTs.
+var ErrUserInvalidName = errors.New("AddUser: name contains a colon")
+
+// ErrUserUnknown indicates attempt to issue a token for an unknown user.
+var ErrUserUnknown = errors.New("Issue: unknown user")
+
+// ErrRevokeUnknown indicates attempt to revoke an unknown token.
+var ErrRevokeUnknown = errors.New("Revoke: unknown token")
+
+// User enumerates user properties.
+type User struct {
+	Name string `json:"name"`
+}
+
+// Token enumerates properties of an issued API token.
+// Only a hash of the token secret is stored.
+type Token struct {
+	ID      string            `json:"id"`
+	User    string            `json:"user"`
+	Created int64             `json:"created"`
+	hash    [sha256.Size]byte // Hash of the token secret.
+}
+
+// Store stores users and their API tokens. It is safe for concurrent use.
+type Store struct {
+	mu     sync.RWMutex
+	users  map[string]*User
+	tokens map[string]*Token
+	path   string // File the store is saved to after every change, if not empty.
+}
+
+// NewStore returns a new empty Store.
+func NewStore() *Store {
+	return &Store{
+		users:  make(map[string]*User),
+		tokens: make(map[string]*Token),
+	}
+}
+
+// storeData is the content of the store file.
+type storeData struct {
+	Users  []*User       `json:"users"`
+	Tokens []storedToken `json:"tokens"`
+}
+
+// storedToken is a token with the hash of its secret in the store file.
+type storedToken struct {
+	*Token
+	Hash string `json:"hash"`
+}
+
+// OpenStore returns a new Store saved to the file at path after every
+// change. The users and tokens are loaded from the file if it exists.
+func OpenStore(path string) (*Store, error) {
+	s := NewStore()
+	s.path = path
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d storeData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("auth: %s: %v", path, err)
+	}
+	for _, u := range d.Users {
+		s.users[u.Name] = u
+	}
+	for _, t := range d.Tokens {
+		h, err := hex.DecodeString(t.Hash)
+		if err != nil || len(h) != sha256.Size || t.Token == nil {
+			return nil, fmt.Errorf("auth: %s: invalid token", path)
+		}
+		copy(t.hash[:], h)
+		s.tokens[t.ID] = t.Token
+	}
+	return s, nil
+}
+
+// save writes the users and tokens to the store file, if any. The file
+// is replaced atomically, so it's never left partially written. It must
+// be called with s.mu held.
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	d := storeData{Users: []*User{}, Tokens: []storedToken{}}
+	for _, u := range s.users {
+		d.Users = append(d.Users, u)
+	}
+	sort.Slice(d.Users, func(i, j int) bool { return d.Users[i].Name < d.Users[j].Name })
+	for _, t := range s.tokens {
+		d.Tokens = append(d.Tokens, storedToken{t, hex.EncodeToString(t.hash[:])})
+	}
+	sort.Slice(d.Tokens, func(i, j int) bool { return d.Tokens[i].ID < d.Tokens[j].ID })
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err := f.Chmod(0600); err != nil { // The file holds the hashes of the secrets.
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), s.path)
+}
+
+// AddUser stores and returns a new user with given name. An error is
+// returned if the name is empty, contains a colon or is already taken,
+// or if the store can't be saved.
+func (s *Store) AddUser(name string) (*User, error) {
+	switch {
+	case name == "":
+		return nil, ErrUserEmptyName
+	case strings.Contains(name, ":"):
+		return nil, ErrUserInvalidName
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[name]; ok {
+		return nil, ErrUserExists
+	}
+	u := &User{Name: name}
+	s.users[name] = u
+	if err := s.save(); err != nil {
+		delete(s.users, name)
+		return nil, err
+	}
+	return u, nil
+}
+
+// Issue issues a new API token for the user with given name.
+// It returns the token which is shown to the user only once,
+// together with its stored properties.
+func (s *Store) Issue(user string) (string, *Token, error) {
+	id, secret := make([]byte, 8), make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", nil, err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", nil, err
+	}
+	t := &Token{
+		ID:      hex.EncodeToString(id),
+		User:    user,
+		Created: time.Now().Unix(),
+		hash:    sha256.Sum256(secret),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.users[user]; !ok {
+		return "", nil, ErrUserUnknown
+	}
+	s.tokens[t.ID] = t
+	if err := s.save(); err != nil {
+		delete(s.tokens, t.ID)
+		return "", nil, err
+	}
+	return t.ID + "." + hex.EncodeToString(secret), t, nil
+}
+
+// Tokens returns all tokens issued for the user with given name
+// ordered by the time of their creation.
+func (s *Store) Tokens(user string) []*Token {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var r []*Token
+	for _, t := range s.tokens {
+		if t.User == user {
+			r = append(r, t)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Created != r[j].Created {
+			return r[i].Created < r[j].Created
+		}
+		return r[i].ID < r[j].ID
+	})
+	return r
+}
+
+// Revoke revokes the token with given id issued for the user with given name.
+// An error is returned if such a token doesn't exist or the store can't be saved.
+func (s *Store) Revoke(user, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.tokens[id]
+	if !ok || t.User != user {
+		return ErrRevokeUnknown
+	}
+	delete(s.tokens, id)
+	if err := s.save(); err != nil {
+		s.tokens[id] = t
+		return err
+	}
+	return nil
+}
+
+// Authenticate returns the user who owns the token.
+// Returns nil and false if the token isn't valid.
+func (s *Store) Authenticate(token string) (*User, bool) {
+	i := strings.IndexByte(token, '.')
+	if i < 0 {
+		return nil, false
+	}
+	secret, err := hex.DecodeString(token[i+1:])
+	if err != nil {
+		return nil, false
+	}
+	hash := sha256.Sum256(secret)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.tokens[token[:i]]
+	if !ok || subtle.ConstantTimeCompare(t.hash[:], hash[:]) != 1 {
+		return nil, false
+	}
+	u, ok := s.users[t.User]
+	return u, ok
+}
+
+// contextKey is the type of keys of values stored in a context by this package.
+type contextKey int
+
+// userKey is the context key of the authenticated user.
+const userKey contextKey = 0
+
+// NewContext returns a new context carrying user u.
+func NewContext(ctx context.Context, u *User) context.Context {
+	return context.WithValue(ctx, userKey, u)
+}
+
+// FromContext returns the user stored in ctx, if any.
+func FromContext(ctx context.Context) (*User, bool) {
+	u, ok := ctx.Value(userKey).(*User)
+	return u, ok
+}
@@ -0,0 +1,171 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package auth
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAddUser(t *testing.T) {
+	s := NewStore()
+	for _, test := range []struct {
+		in   string
+		want *User
+		err  error
+	}{
+		{"alice", &User{Name: "alice"}, nil},
+		{"bob", &User{Name: "bob"}, nil},
+		{"alice", nil, ErrUserExists},
+		{"", nil, ErrUserEmptyName},
+		{JWTPrefix + "alice", nil, ErrUserInvalidName},
+	} {
+		got, err := s.AddUser(test.in)
+		if !reflect.DeepEqual(got, test.want) || err != test.err {
+			t.Errorf("AddUser(%q) = %v, %v; want %v, %v", test.in, got, err, test.want, test.err)
+		}
+	}
+}
+
+func TestIssue(t *testing.T) {
+	s := NewStore()
+	if _, _, err := s.Issue("alice"); err != ErrUserUnknown {
+		t.Errorf("Issue(%q) for unknown user: got error %v; want %v", "alice", err, ErrUserUnknown)
+	}
+
+	s.AddUser("alice")
+	token, tok, err := s.Issue("alice")
+	if err != nil {
+		t.Fatalf("Issue(%q): unexpected error: %v", "alice", err)
+	}
+	if u, ok := s.Authenticate(token); !ok || u.Name != "alice" {
+		t.Errorf("Authenticate(%q) = %v, %t; want alice, true", token, u, ok)
+	}
+	if got := s.Tokens("alice"); len(got) != 1 || got[0] != tok {
+		t.Errorf("Tokens(%q) = %v; want [%v]", "alice", got, tok)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	s := NewStore()
+	s.AddUser("alice")
+	token, tok, err := s.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, in := range []string{
+		"",
+		"invalid",
+		tok.ID,
+		tok.ID + ".",
+		tok.ID + ".zz",
+		tok.ID + ".00",
+		"0000000000000000" + token[len(tok.ID):],
+	} {
+		if u, ok := s.Authenticate(in); ok {
+			t.Errorf("Authenticate(%q) = %v, %t; want <nil>, false", in, u, ok)
+		}
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	s := NewStore()
+	s.AddUser("alice")
+	s.AddUser("bob")
+	token, tok, err := s.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := s.Revoke("bob", tok.ID), ErrRevokeUnknown; got != want {
+		t.Errorf("Revoke(%q, %q) = %v; want %v", "bob", tok.ID, got, want)
+	}
+	if err := s.Revoke("alice", tok.ID); err != nil {
+		t.Errorf("Revoke(%q, %q): unexpected error: %v", "alice", tok.ID, err)
+	}
+	if u, ok := s.Authenticate(token); ok {
+		t.Errorf("Authenticate(%q) after revoke = %v, %t; want <nil>, false", token, u, ok)
+	}
+	if got, want := s.Revoke("alice", tok.ID), ErrRevokeUnknown; got != want {
+		t.Errorf("Revoke(%q, %q) again = %v; want %v", "alice", tok.ID, got, want)
+	}
+}
+
+func TestContext(t *testing.T) {
+	if u, ok := FromContext(context.Background()); ok {
+		t.Errorf("FromContext(empty) = %v, %t; want <nil>, false", u, ok)
+	}
+	want := &User{Name: "alice"}
+	if got, ok := FromContext(NewContext(context.Background(), want)); !ok || got != want {
+		t.Errorf("FromContext(...) = %v, %t; want %v, true", got, ok, want)
+	}
+}
+
+func TestOpenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.json.users")
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore(%q): unexpected error: %v", path, err)
+	}
+	s.AddUser("alice")
+	s.AddUser("bob")
+	token, _, err := s.Issue("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, revoked, err := s.Issue("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Revoke("bob", revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore(%q) again: unexpected error: %v", path, err)
+	}
+	if u, ok := s.Authenticate(token); !ok || u.Name != "alice" {
+		t.Errorf("Authenticate(%q) after reopening = %v, %t; want alice, true", token, u, ok)
+	}
+	if got := s.Tokens("bob"); len(got) != 0 {
+		t.Errorf("Tokens(%q) after reopening = %v; want none", "bob", got)
+	}
+	if _, err := s.AddUser("bob"); err != ErrUserExists {
+		t.Errorf("AddUser(%q) after reopening: got error %v; want %v", "bob", err, ErrUserExists)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("Stat(%q) = %v, %v; want mode 0600", path, fi, err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"tokens":[{"id":"1","hash":"zz"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStore(path); err == nil {
+		t.Errorf("OpenStore(%q) of a malformed file: expected error", path)
+	}
+}
+
+func TestStoreSaveError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.json.users")
+	s, err := OpenStore(path)
+	if err != nil {
+		t.Fatalf("OpenStore(%q): unexpected error: %v", path, err)
+	}
+	s.path = filepath.Join(path, "missing") // The directory doesn't exist.
+	if _, err := s.AddUser("alice"); err == nil {
+		t.Errorf("AddUser(%q) failing to save: expected error", "alice")
+	}
+	if _, err := s.AddUser(""); err != ErrUserEmptyName {
+		t.Errorf("AddUser(%q): got error %v; want %v", "", err, ErrUserEmptyName)
+	}
+	s.path = path
+	if _, err := s.AddUser("alice"); err != nil {
+		t.Errorf("AddUser(%q) after failed save: unexpected error: %v", "alice", err)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package config loads the server configuration.
+//
+// Every setting has a key like cors.max-age and is loaded, with
+// increasing precedence, from its default value, the configuration
+// file, the environment variable (TODO_CORS_MAX_AGE) and the command
+// line flag (-cors-max-age). The configuration file is selected by
+// the -config flag or the TODO_CONFIG environment variable and its
+// format, TOML, JSON or YAML, by its extension.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvPrefix prefixes the names of environment variables holding settings.
+const EnvPrefix = "TODO_"
+
+// Config enumerates server settings.
+type Config struct {
+	File        string // Path of the loaded configuration file.
+	PrintConfig bool   // Print the configuration and exit.
+
+	Addr   string // Listen address.
+	Static string // Directory served as the web frontend; empty disables it.
+
+	TLS struct {
+		Cert string // PEM encoded certificate file; TLS is enabled if set.
+		Key  string // PEM encoded private key file.
+	}
+
+	Storage struct {
+		Backend string // Either memory or file.
+		Path    string // Path of the file storage.
+	}
+
+	CORS struct {
+		Origins        []string
+		Credentials    bool
+		MaxAge         time.Duration
+		ExposedHeaders []string
+	}
+
+	Log struct {
+		Level  string   // One of debug, info, warn or error.
+		Format string   // Either text (logfmt) or json.
+		Access bool     // Log every request.
+		Redact []string // Keys of attributes and query parameters whose values aren't logged.
+	}
+
+	Timeouts struct {
+		ReadHeader time.Duration
+		Read       time.Duration
+		Write      time.Duration
+		Idle       time.Duration
+		Drain      time.Duration // Time between failing the readiness probe and closing the listener.
+		Shutdown   time.Duration // Maximum time of draining the requests in progress.
+	}
+
+	Trash struct {
+		Days int // Purge deleted tasks after Days days; 0 keeps them forever.
+	}
+
+	Idempotency struct {
+		Window time.Duration // Replay responses to retried requests within Window.
+	}
+
+	Users struct {
+		Registration bool   // Anyone can create a user.
+		AdminToken   string // File with the token allowing the creation of users.
+	}
+
+	JWT struct {
+		HMACKey    string
+		RSAKey     string
+		JWKS       string
+		Audience   string
+		Issuer     string
+		UserClaim  string
+		Leeway     time.Duration // Allowed clock skew of the exp and nbf claims.
+		RequireExp bool          // Reject JWTs without the exp claim.
+	}
+}
+
+// Default returns a Config with the default settings.
+func Default() *Config {
+	c := new(Config)
+	c.Addr = ":8080"
+	c.Static = "frontend/web"
+	c.Storage.Backend = "memory"
+	c.CORS.Origins = []string{"*"}
+	c.CORS.MaxAge = 10 * time.Minute
+	c.CORS.ExposedHeaders = []string{"Idempotent-Replayed", "X-Request-ID"}
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	c.Log.Access = true
+	c.Log.Redact = []string{"authorization", "password", "secret", "token"}
+	c.Timeouts.ReadHeader = 5 * time.Second
+	c.Timeouts.Read = 15 * time.Second
+	c.Timeouts.Write = 30 * time.Second
+	c.Timeouts.Idle = 2 * time.Minute
+	c.Timeouts.Drain = 5 * time.Second
+	c.Timeouts.Shutdown = 30 * time.Second
+	c.Trash.Days = 30
+	c.Idempotency.Window = 24 * time.Hour
+	c.JWT.UserClaim = "sub"
+	c.JWT.Leeway = time.Minute
+	c.JWT.RequireExp = true
+	return c
+}
+
+// list is a flag.Value holding a comma separated list.
+type list []string
+
+func (l *list) String() string { return strings.Join(*l, ",") }
+
+func (l *list) Get() interface{} { return []string(*l) }
+
+func (l *list) Set(s string) error {
+	*l = nil
+	for _, e := range strings.Split(s, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			*l = append(*l, e)
+		}
+	}
+	return nil
+}
+
+// flagSet returns a flag set bound to the settings of c. The flags are
+// named by the setting keys with dots replaced by dashes.
+func (c *Config) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.StringVar(&c.File, "config", c.File, "load the configuration from `file` (.toml, .json, .yaml or .yml)")
+	fs.BoolVar(&c.PrintConfig, "print-config", c.PrintConfig, "print the configuration and exit")
+
+	fs.StringVar(&c.Addr, "addr", c.Addr, "listen on `address`")
+	fs.StringVar(&c.Static, "static", c.Static, "serve the web frontend from `dir`; empty disables it")
+	fs.StringVar(&c.TLS.Cert, "tls-cert", c.TLS.Cert, "serve TLS with the PEM encoded certificate read from `file`")
+	fs.StringVar(&c.TLS.Key, "tls-key", c.TLS.Key, "serve TLS with the PEM encoded private key read from `file`")
+	fs.StringVar(&c.Storage.Backend, "storage-backend", c.Storage.Backend, "store the tasks in `backend`: memory or file")
+	fs.StringVar(&c.Storage.Path, "storage-path", c.Storage.Path, "store the tasks in `file` when the storage backend is file")
+	fs.Var((*list)(&c.CORS.Origins), "cors-origins", "comma separated `list` of origins allowed to make cross-origin requests, like https://*.example.com")
+	fs.BoolVar(&c.CORS.Credentials, "cors-credentials", c.CORS.Credentials, "allow cross-origin requests carrying credentials")
+	fs.DurationVar(&c.CORS.MaxAge, "cors-max-age", c.CORS.MaxAge, "cache preflight responses for `duration`")
+	fs.Var((*list)(&c.CORS.ExposedHeaders), "cors-exposed-headers", "comma separated `list` of response headers exposed to cross-origin clients")
+	fs.StringVar(&c.Log.Level, "log-level", c.Log.Level, "log messages of `level` and above: debug, info, warn or error")
+	fs.StringVar(&c.Log.Format, "log-format", c.Log.Format, "log messages in `format`: text (logfmt) or json")
+	fs.BoolVar(&c.Log.Access, "log-access", c.Log.Access, "log every request")
+	fs.Var((*list)(&c.Log.Redact), "log-redact", "comma separated `list` of attribute and query parameter names whose values aren't logged")
+	fs.DurationVar(&c.Timeouts.ReadHeader, "timeouts-read-header", c.Timeouts.ReadHeader, "maximum `duration` for reading request headers")
+	fs.DurationVar(&c.Timeouts.Read, "timeouts-read", c.Timeouts.Read, "maximum `duration` for reading a request")
+	fs.DurationVar(&c.Timeouts.Write, "timeouts-write", c.Timeouts.Write, "maximum `duration` for writing a response")
+	fs.DurationVar(&c.Timeouts.Idle, "timeouts-idle", c.Timeouts.Idle, "maximum `duration` of an idle keep-alive connection")
+	fs.DurationVar(&c.Timeouts.Drain, "timeouts-drain", c.Timeouts.Drain, "`duration` of reporting not ready before closing the listener on shutdown")
+	fs.DurationVar(&c.Timeouts.Shutdown, "timeouts-shutdown", c.Timeouts.Shutdown, "maximum `duration` of finishing requests in progress on shutdown")
+	fs.IntVar(&c.Trash.Days, "trash-days", c.Trash.Days, "purge deleted tasks after `N` days; 0 keeps them forever")
+	fs.DurationVar(&c.Idempotency.Window, "idempotency-window", c.Idempotency.Window, "replay responses to requests retried with the same Idempotency-Key within `duration`")
+	fs.BoolVar(&c.Users.Registration, "users-registration", c.Users.Registration, "allow anyone to create a user")
+	fs.StringVar(&c.Users.AdminToken, "users-admin-token", c.Users.AdminToken, "allow the requests carrying the token read from `file` to create users")
+	fs.StringVar(&c.JWT.HMACKey, "jwt-hmac-key", c.JWT.HMACKey, "accept HS256 JWTs signed by the secret read from `file`")
+	fs.StringVar(&c.JWT.RSAKey, "jwt-rsa-key", c.JWT.RSAKey, "accept RS256 JWTs signed by the PEM encoded public key read from `file`")
+	fs.StringVar(&c.JWT.JWKS, "jwt-jwks", c.JWT.JWKS, "accept JWTs signed by the keys of the JWKS document read from `file`")
+	fs.StringVar(&c.JWT.Audience, "jwt-audience", c.JWT.Audience, "require the JWT aud claim to contain `audience`")
+	fs.StringVar(&c.JWT.Issuer, "jwt-issuer", c.JWT.Issuer, "require the JWT iss claim to be `issuer`")
+	fs.StringVar(&c.JWT.UserClaim, "jwt-user-claim", c.JWT.UserClaim, "map the JWT `claim` to the user")
+	fs.DurationVar(&c.JWT.Leeway, "jwt-leeway", c.JWT.Leeway, "allow the clock skew `duration` in the JWT exp and nbf claims")
+	fs.BoolVar(&c.JWT.RequireExp, "jwt-require-exp", c.JWT.RequireExp, "reject JWTs without the exp claim")
+	return fs
+}
+
+// flagName returns the name of the flag for the setting key.
+func flagName(key string) string {
+	return strings.NewReplacer(".", "-", "_", "-").Replace(strings.ToLower(key))
+}
+
+// envName returns the name of the environment variable for the setting key.
+func envName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(key))
+}
+
+// meta are the flags which aren't settings.
+var meta = map[string]bool{"config": true, "print-config": true}
+
+// Load returns the configuration loaded from the command line arguments
+// (without the program name), the environment looked up by getenv and
+// the configuration file. The returned configuration isn't validated.
+func Load(name string, args []string, getenv func(string) string) (*Config, error) {
+	// Parse the flags first, so the configuration file is known and the
+	// flags can be applied last, over the file and environment settings.
+	fc := Default()
+	ffs := fc.flagSet(name)
+	if err := ffs.Parse(args); err != nil {
+		return nil, err
+	}
+	if ffs.NArg() > 0 {
+		return nil, fmt.Errorf("config: unexpected arguments: %q", ffs.Args())
+	}
+
+	c := Default()
+	fs := c.flagSet(name)
+	c.File = fc.File
+	if c.File == "" {
+		c.File = getenv(EnvPrefix + "CONFIG")
+	}
+	if c.File != "" {
+		kv, err := readFile(c.File)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range kv {
+			n := flagName(k)
+			if fs.Lookup(n) == nil || meta[n] {
+				return nil, fmt.Errorf("config: %s: unknown setting %q", c.File, k)
+			}
+			if err := fs.Set(n, v); err != nil {
+				return nil, fmt.Errorf("config: %s: %s: %v", c.File, k, err)
+			}
+		}
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		if err != nil || meta[f.Name] {
+			return
+		}
+		env := envName(f.Name)
+		if v := getenv(env); v != "" {
+			if e := fs.Set(f.Name, v); e != nil {
+				err = fmt.Errorf("config: %s: %v", env, e)
+			}
+		}
+	})
+	ffs.Visit(func(f *flag.Flag) {
+		if err == nil && f.Name != "config" {
+			err = fs.Set(f.Name, f.Value.String())
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate reports all invalid settings of c.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("config: "+format, args...))
+		}
+	}
+	exists := func(key, path string) {
+		if path == "" {
+			return
+		}
+		fi, err := os.Stat(path)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("config: %s: %v", key, err))
+		case fi.IsDir():
+			check(false, "%s: %s is a directory", key, path)
+		}
+	}
+
+	check(c.Addr != "", "addr: empty address")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls: both cert and key are required")
+	exists("tls.cert", c.TLS.Cert)
+	exists("tls.key", c.TLS.Key)
+	switch c.Storage.Backend {
+	case "memory":
+	case "file":
+		check(c.Storage.Path != "", "storage.path: required by the file backend")
+	default:
+		check(false, "storage.backend: unknown backend %q", c.Storage.Backend)
+	}
+	for _, o := range c.CORS.Origins {
+		check(o == "*" || strings.Contains(o, "://"), "cors.origins: invalid origin %q", o)
+		check(o != "*" || !c.CORS.Credentials, "cors.credentials: not allowed with the * origin")
+	}
+	check(c.CORS.MaxAge >= 0, "cors.max-age: negative duration")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level: unknown level %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format: unknown format %q", c.Log.Format)
+	check(c.Timeouts.ReadHeader >= 0, "timeouts.read-header: negative duration")
+	check(c.Timeouts.Read >= 0, "timeouts.read: negative duration")
+	check(c.Timeouts.Write >= 0, "timeouts.write: negative duration")
+	check(c.Timeouts.Idle >= 0, "timeouts.idle: negative duration")
+	check(c.Timeouts.Drain >= 0, "timeouts.drain: negative duration")
+	check(c.Timeouts.Shutdown > 0, "timeouts.shutdown: non-positive duration")
+	check(c.Trash.Days >= 0, "trash.days: negative number of days")
+	check(c.Idempotency.Window > 0, "idempotency.window: non-positive duration")
+	exists("users.admin-token", c.Users.AdminToken)
+	exists("jwt.hmac-key", c.JWT.HMACKey)
+	exists("jwt.rsa-key", c.JWT.RSAKey)
+	exists("jwt.jwks", c.JWT.JWKS)
+	check(c.JWT.UserClaim != "", "jwt.user-claim: empty claim")
+	check(c.JWT.Leeway >= 0, "jwt.leeway: negative duration")
+	return errors.Join(errs...)
+}
+
+// Write writes the settings of c to w as a TOML configuration file.
+func (c *Config) Write(w io.Writer) error {
+	sections := make(map[string][]*flag.Flag)
+	c.flagSet("").VisitAll(func(f *flag.Flag) {
+		if !meta[f.Name] {
+			s := ""
+			if i := strings.Index(f.Name, "-"); i > 0 && hasSection(f.Name[:i]) {
+				s = f.Name[:i]
+			}
+			sections[s] = append(sections[s], f)
+		}
+	})
+	var names []string
+	for s := range sections {
+		names = append(names, s)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, s := range names {
+		if s != "" {
+			fmt.Fprintf(&b, "\n[%s]\n", s)
+		}
+		for _, f := range sections[s] {
+			fmt.Fprintf(&b, "%s = %s\n", strings.TrimPrefix(strings.TrimPrefix(f.Name, s), "-"), tomlValue(f.Value))
+		}
+	}
+	_, err := io.WriteString(w, strings.TrimPrefix(b.String(), "\n"))
+	return err
+}
+
+// hasSection reports whether s names a section of the settings.
+func hasSection(s string) bool {
+	switch s {
+	case "tls", "storage", "cors", "log", "timeouts", "trash", "idempotency", "users", "jwt":
+		return true
+	}
+	return false
+}
+
+// tomlValue returns v formatted as a TOML value.
+func tomlValue(v flag.Value) string {
+	switch x := v.(flag.Getter).Get().(type) {
+	case bool:
+		return strconv.FormatBool(x)
+	case int:
+		return strconv.Itoa(x)
+	case []string:
+		q := make([]string, len(x))
+		for i, s := range x {
+			q[i] = strconv.Quote(s)
+		}
+		return "[" + strings.Join(q, ", ") + "]"
+	default:
+		return strconv.Quote(v.String())
+	}
+}
@@ -0,0 +1,249 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// env returns getenv function looking up variables in m.
+func env(m map[string]string) func(string) string {
+	return func(k string) string { return m[k] }
+}
+
+// writeFile writes the content to the file name in a temporary directory.
+func writeFile(t *testing.T, name, content string) string {
+	p := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestLoadDefault(t *testing.T) {
+	c, err := Load("todo", nil, env(nil))
+	if err != nil {
+		t.Fatalf("Load(): unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(c, Default()) {
+		t.Errorf("Load() = %+v; want %+v", c, Default())
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "todo.toml", `
+addr = ":1"
+static = ""
+
+[storage]
+backend = "file"
+path = "/var/lib/todo.json"
+
+[cors]
+origins = ["https://a.example.com", "https://*.example.org"]
+max-age = "1m"
+`)
+	c, err := Load("todo", []string{"-config", file, "-addr", ":3", "-cors-credentials"}, env(map[string]string{
+		"TODO_ADDR":               ":2",
+		"TODO_STORAGE_PATH":       "/tmp/todo.json",
+		"TODO_TRASH_DAYS":         "7",
+		"TODO_IDEMPOTENCY_WINDOW": "1h",
+		"TODO_USERS_REGISTRATION": "true",
+	}))
+	if err != nil {
+		t.Fatalf("Load(...): unexpected error: %v", err)
+	}
+
+	want := Default()
+	want.File = file
+	want.Addr = ":3"
+	want.Static = ""
+	want.Storage.Backend = "file"
+	want.Storage.Path = "/tmp/todo.json"
+	want.CORS.Origins = []string{"https://a.example.com", "https://*.example.org"}
+	want.CORS.Credentials = true
+	want.CORS.MaxAge = time.Minute
+	want.Trash.Days = 7
+	want.Idempotency.Window = time.Hour
+	want.Users.Registration = true
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Load(...) = %+v; want %+v", c, want)
+	}
+
+	// The configuration file may be selected by the environment.
+	c, err = Load("todo", nil, env(map[string]string{"TODO_CONFIG": file}))
+	if err != nil || c.Addr != ":1" {
+		t.Errorf("Load() with TODO_CONFIG: got addr %q, error %v; want :1, <nil>", c.Addr, err)
+	}
+}
+
+func TestLoadFormats(t *testing.T) {
+	want := Default()
+	want.Addr = ":9090"
+	want.TLS.Cert = "cert.pem"
+	want.TLS.Key = "key.pem"
+	want.CORS.Origins = []string{"https://a.example.com", "https://b.example.com"}
+	want.CORS.Credentials = true
+	want.Log.Level = "debug"
+	want.Timeouts.Read = 5 * time.Second
+	want.Trash.Days = 0
+
+	for _, test := range []struct {
+		name, content string
+	}{
+		{"todo.json", `{
+			"addr": ":9090",
+			"tls": {"cert": "cert.pem", "key": "key.pem"},
+			"cors": {"origins": ["https://a.example.com", "https://b.example.com"], "credentials": true},
+			"log": {"level": "debug"},
+			"timeouts": {"read": "5s"},
+			"trash": {"days": 0}
+		}`},
+		{"todo.toml", `
+# Server settings.
+addr = ":9090" # Listen on all interfaces.
+[tls]
+cert = "cert.pem"
+key = 'key.pem'
+[cors]
+origins = ["https://a.example.com", "https://b.example.com"]
+credentials = true
+[log]
+level = "debug"
+[timeouts]
+read = "5s"
+[trash]
+days = 0
+`},
+		{"todo.yaml", `
+# Server settings.
+addr: ":9090"
+tls:
+  cert: cert.pem
+  key: 'key.pem'
+cors:
+  origins:
+  - https://a.example.com
+  - "https://b.example.com"
+  credentials: true
+log:
+  level: debug # Verbose.
+timeouts:
+  read: 5s
+trash:
+  days: 0
+`},
+	} {
+		file := writeFile(t, test.name, test.content)
+		c, err := Load("todo", []string{"-config", file}, env(nil))
+		if err != nil {
+			t.Errorf("Load(%s): unexpected error: %v", test.name, err)
+			continue
+		}
+		want.File = file
+		if !reflect.DeepEqual(c, want) {
+			t.Errorf("Load(%s) = %+v; want %+v", test.name, c, want)
+		}
+	}
+}
+
+func TestLoadError(t *testing.T) {
+	for _, test := range []struct {
+		args []string
+		env  map[string]string
+	}{
+		{[]string{"-unknown"}, nil},
+		{[]string{"arg"}, nil},
+		{[]string{"-config", "missing.toml"}, nil},
+		{[]string{"-config", writeFile(t, "todo.ini", "addr = :1")}, nil},
+		{[]string{"-config", writeFile(t, "todo.toml", "unknown = 1")}, nil},
+		{[]string{"-config", writeFile(t, "todo.toml", "[trash]\ndays = \"many\"")}, nil},
+		{[]string{"-config", writeFile(t, "todo.toml", "addr")}, nil},
+		{[]string{"-config", writeFile(t, "todo.json", "{")}, nil},
+		{[]string{"-config", writeFile(t, "todo.yaml", "addr\n")}, nil},
+		{[]string{"-config", writeFile(t, "todo.yaml", "log: {level: debug}\n")}, nil}, // Flow mappings aren't supported.
+		{nil, map[string]string{"TODO_CORS_MAX_AGE": "long"}},
+	} {
+		if _, err := Load("todo", test.args, env(test.env)); err == nil {
+			t.Errorf("Load(%q) with env %v: expected error", test.args, test.env)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := Default()
+	if err := c.Validate(); err != nil {
+		t.Errorf("Validate() of default config: unexpected error: %v", err)
+	}
+
+	c.Addr = ""
+	c.TLS.Cert = "cert.pem"
+	c.Storage.Backend = "file"
+	c.CORS.Origins = []string{"example.com", "*"}
+	c.CORS.Credentials = true
+	c.Log.Level = "verbose"
+	c.Log.Format = "xml"
+	c.Timeouts.Idle = -time.Second
+	c.Timeouts.Drain = -time.Second
+	c.Timeouts.Shutdown = 0
+	c.Trash.Days = -1
+	c.Idempotency.Window = 0
+	c.Users.AdminToken = filepath.Join(t.TempDir(), "missing")
+	c.JWT.HMACKey = t.TempDir()
+	c.JWT.Leeway = -time.Second
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Validate() of invalid config: expected error")
+	}
+	for _, key := range []string{"addr", "tls", "tls.cert", "storage.path", "cors.origins", "cors.credentials", "log.level", "log.format", "timeouts.idle", "timeouts.drain", "timeouts.shutdown", "trash.days", "idempotency.window", "users.admin-token", "jwt.hmac-key", "jwt.leeway"} {
+		if !strings.Contains(err.Error(), "config: "+key+": ") {
+			t.Errorf("Validate() = %v; want an error of %s", err, key)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	c := Default()
+	c.CORS.Origins = []string{"https://a.example.com", "https://*.example.org"}
+	c.Storage.Backend = "file"
+	c.Storage.Path = `C:\todo "tasks".json`
+
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatalf("Write(...): unexpected error: %v", err)
+	}
+	for _, want := range []string{
+		"addr = \":8080\"\n",
+		"\n[cors]\n",
+		`origins = ["https://a.example.com", "https://*.example.org"]`,
+		"max-age = \"10m0s\"\n",
+		"\n[timeouts]\ndrain = \"5s\"\n",
+		"\n[trash]\ndays = 30\n",
+		"\n[idempotency]\nwindow = \"24h0m0s\"\n",
+		"leeway = \"1m0s\"\nrequire-exp = true\n",
+		"\n[users]\nadmin-token = \"\"\nregistration = false\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Write(...) = %s; want it to contain %q", buf.String(), want)
+		}
+	}
+
+	// The written configuration loads back.
+	file := writeFile(t, "todo.toml", buf.String())
+	got, err := Load("todo", []string{"-config", file}, env(nil))
+	if err != nil {
+		t.Fatalf("Load(written config): unexpected error: %v", err)
+	}
+	c.File = file
+	if !reflect.DeepEqual(got, c) {
+		t.Errorf("Load(written config) = %+v; want %+v", got, c)
+	}
+}
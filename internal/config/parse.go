@@ -0,0 +1,268 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// readFile reads the configuration file and returns its settings as
+// values by dotted keys, like cors.max-age. Lists are joined by commas.
+func readFile(path string) (map[string]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %v", err)
+	}
+	var kv map[string]string
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		kv, err = parseJSON(b)
+	case ".toml":
+		kv, err = parseTOML(b)
+	case ".yaml", ".yml":
+		kv, err = parseYAML(b)
+	default:
+		return nil, fmt.Errorf("config: %s: unknown format %q", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config: %s: %v", path, err)
+	}
+	return kv, nil
+}
+
+// parseJSON parses a JSON object whose nested objects are sections.
+func parseJSON(b []byte) (map[string]string, error) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	kv := make(map[string]string)
+	var flatten func(prefix string, v interface{}) error
+	flatten = func(prefix string, v interface{}) error {
+		switch x := v.(type) {
+		case map[string]interface{}:
+			for k, e := range x {
+				if err := flatten(join(prefix, k), e); err != nil {
+					return err
+				}
+			}
+			return nil
+		case []interface{}:
+			s := make([]string, len(x))
+			for i, e := range x {
+				if _, ok := e.(map[string]interface{}); ok {
+					return fmt.Errorf("%s: list of objects", prefix)
+				}
+				s[i] = fmt.Sprint(e)
+			}
+			kv[prefix] = strings.Join(s, ",")
+		case float64:
+			kv[prefix] = strconv.FormatFloat(x, 'f', -1, 64)
+		case nil:
+			kv[prefix] = ""
+		default:
+			kv[prefix] = fmt.Sprint(x)
+		}
+		return nil
+	}
+	if err := flatten("", doc); err != nil {
+		return nil, err
+	}
+	return kv, nil
+}
+
+// parseTOML parses the subset of TOML made of [section] tables and
+// key = value pairs, where a value is a string, number, boolean or
+// a single line array of them.
+func parseTOML(b []byte) (map[string]string, error) {
+	kv := make(map[string]string)
+	section := ""
+	for n, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(stripComment(line))
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") || strings.HasPrefix(line, "[[") {
+				return nil, fmt.Errorf("line %d: invalid table %q", n+1, line)
+			}
+			section = strings.TrimSpace(line[1 : len(line)-1])
+		default:
+			i := strings.Index(line, "=")
+			if i < 0 {
+				return nil, fmt.Errorf("line %d: expected key = value", n+1)
+			}
+			v, err := value(strings.TrimSpace(line[i+1:]))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			kv[join(section, unquote(strings.TrimSpace(line[:i])))] = v
+		}
+	}
+	return kv, nil
+}
+
+// parseYAML parses the subset of YAML made of nested mappings
+// indented by spaces, whose values are scalars, flow sequences
+// like [a, b] or block sequences of "- item" lines.
+func parseYAML(b []byte) (map[string]string, error) {
+	kv := make(map[string]string)
+	type mapping struct {
+		indent int
+		key    string
+	}
+	var stack []mapping
+	for n, line := range strings.Split(string(b), "\n") {
+		if s := strings.TrimSpace(line); s == "" || s == "---" || strings.HasPrefix(s, "#") {
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(line, " "), "\t") {
+			return nil, fmt.Errorf("line %d: tab indentation", n+1)
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		line = strings.TrimSpace(stripComment(line))
+
+		if item := strings.TrimPrefix(line, "-"); item != line && (item == "" || item[0] == ' ') {
+			// A sequence item may be indented as its key.
+			for len(stack) > 0 && stack[len(stack)-1].indent > indent {
+				stack = stack[:len(stack)-1]
+			}
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("line %d: sequence without key", n+1)
+			}
+			key := stack[len(stack)-1].key
+			v, err := value(strings.TrimSpace(item))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			if kv[key] != "" {
+				v = kv[key] + "," + v
+			}
+			kv[key] = v
+			continue
+		}
+
+		for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+			stack = stack[:len(stack)-1]
+		}
+		i := strings.Index(line, ":")
+		if i < 0 || (i+1 < len(line) && line[i+1] != ' ') {
+			return nil, fmt.Errorf("line %d: expected key: value", n+1)
+		}
+		key := unquote(strings.TrimSpace(line[:i]))
+		if len(stack) > 0 {
+			key = join(stack[len(stack)-1].key, key)
+		}
+		if v := strings.TrimSpace(line[i+1:]); v != "" {
+			s, err := value(v)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", n+1, err)
+			}
+			kv[key] = s
+			continue
+		}
+		stack = append(stack, mapping{indent, key})
+	}
+	return kv, nil
+}
+
+// value parses a scalar or a single line array of scalars.
+func value(s string) (string, error) {
+	if !strings.HasPrefix(s, "[") {
+		return scalar(s)
+	}
+	if !strings.HasSuffix(s, "]") {
+		return "", fmt.Errorf("unterminated array %s", s)
+	}
+	var r []string
+	for _, e := range splitArray(s[1 : len(s)-1]) {
+		if e = strings.TrimSpace(e); e == "" {
+			continue
+		}
+		v, err := scalar(e)
+		if err != nil {
+			return "", err
+		}
+		r = append(r, v)
+	}
+	return strings.Join(r, ","), nil
+}
+
+// scalar parses a quoted or a bare scalar.
+func scalar(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		if len(s) < 2 || !strings.HasSuffix(s, "'") {
+			return "", fmt.Errorf("invalid string %s", s)
+		}
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return s, nil
+}
+
+// unquote returns the quoted key s without quotes.
+func unquote(s string) string {
+	if v, err := scalar(s); err == nil {
+		return v
+	}
+	return s
+}
+
+// splitArray splits the array elements by commas outside of quotes.
+func splitArray(s string) []string {
+	var r []string
+	var quote rune
+	start := 0
+	for i, c := range s {
+		switch {
+		case quote != 0:
+			if c == quote && (quote == '\'' || i == 0 || s[i-1] != '\\') {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			r = append(r, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(r, s[start:])
+}
+
+// stripComment removes the # comment outside of quotes from the line.
+func stripComment(line string) string {
+	var quote rune
+	for i, c := range line {
+		switch {
+		case quote != 0:
+			if c == quote && (quote == '\'' || line[i-1] != '\\') {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// join joins the section and the key by a dot.
+func join(section, key string) string {
+	if section == "" {
+		return key
+	}
+	return section + "." + key
+}
@@ -0,0 +1,190 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package cors implements a Cross-Origin Resource Sharing policy.
+package cors
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrWildcardCredentials indicates a Config allowing all origins to make
+// requests carrying credentials, which would expose the users of every
+// origin to cross-site request forgery.
+var ErrWildcardCredentials = errors.New("cors: the * origin doesn't allow credentials")
+
+// Config enumerates properties of a CORS policy.
+type Config struct {
+	// AllowedOrigins lists the origins allowed to make cross-origin requests.
+	// An origin is either exact, like https://app.example.com, or matches
+	// all subdomains, like https://*.example.com. A single * allows all.
+	AllowedOrigins []string
+
+	// AllowedMethods lists the methods allowed in cross-origin requests.
+	AllowedMethods []string
+
+	// AllowedHeaders lists the request headers allowed in cross-origin requests.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists the response headers exposed to the clients.
+	ExposedHeaders []string
+
+	// AllowCredentials allows requests carrying credentials.
+	// It can't be combined with the * origin.
+	AllowCredentials bool
+
+	// MaxAge specifies for how long the preflight response may be cached.
+	// Zero omits the Access-Control-Max-Age header.
+	MaxAge time.Duration
+}
+
+// DefaultConfig returns a Config which allows all origins to make
+// requests with the methods and headers used by the todo API.
+func DefaultConfig() Config {
+	return Config{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Accept", "Content-Type", "Content-Length", "Accept-Encoding", "Authorization", "Idempotency-Key", "X-Session-ID", "X-Request-ID", "X-CSRF-Token"},
+		ExposedHeaders: []string{"Idempotent-Replayed", "X-Request-ID"},
+	}
+}
+
+// Policy is a CORS policy.
+type Policy struct {
+	c        Config
+	any      bool            // True if all origins are allowed.
+	origins  map[string]bool // Exact origins.
+	suffixes []wildcard      // Wildcard subdomain origins.
+	methods  map[string]bool // Upper-case methods.
+	headers  map[string]bool // Canonical header names.
+	maxAge   string          // Value of the Access-Control-Max-Age header.
+	exposed  string          // Value of the Access-Control-Expose-Headers header.
+}
+
+// wildcard matches origins with the scheme and any subdomain of the suffix.
+type wildcard struct {
+	scheme, suffix string // Suffix starts with a dot.
+}
+
+// New returns a new Policy configured by c.
+func New(c Config) (*Policy, error) {
+	p := &Policy{
+		c:       c,
+		origins: make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+		exposed: strings.Join(c.ExposedHeaders, ", "),
+	}
+	for _, o := range c.AllowedOrigins {
+		o = strings.ToLower(strings.TrimSuffix(o, "/"))
+		switch i := strings.Index(o, "://*."); {
+		case o == "*":
+			p.any = true
+		case i >= 0:
+			p.suffixes = append(p.suffixes, wildcard{o[:i], o[i+len("://*"):]})
+		default:
+			p.origins[o] = true
+		}
+	}
+	for _, m := range c.AllowedMethods {
+		p.methods[strings.ToUpper(m)] = true
+	}
+	for _, h := range c.AllowedHeaders {
+		p.headers[http.CanonicalHeaderKey(h)] = true
+	}
+	if p.any && c.AllowCredentials {
+		return nil, ErrWildcardCredentials
+	}
+	if c.MaxAge > 0 {
+		p.maxAge = strconv.Itoa(int(c.MaxAge / time.Second))
+	}
+	return p, nil
+}
+
+// allowOrigin reports whether the origin is allowed.
+func (p *Policy) allowOrigin(origin string) bool {
+	if p.any {
+		return true
+	}
+	o := strings.ToLower(origin)
+	if p.origins[o] {
+		return true
+	}
+	for _, w := range p.suffixes {
+		if host := strings.TrimPrefix(o, w.scheme+"://"); host != o && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowHeaders reports whether all headers in the comma separated list are allowed.
+func (p *Policy) allowHeaders(list string) bool {
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.TrimSpace(h); h != "" && !p.headers[http.CanonicalHeaderKey(h)] {
+			return false
+		}
+	}
+	return true
+}
+
+// setOrigin sets the headers allowing the origin to read the response.
+func (p *Policy) setOrigin(h http.Header, origin string) {
+	if p.any {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// Handler wraps fn and applies the policy to its requests. Preflight
+// requests are answered without calling fn; the other requests are
+// passed to fn, with CORS headers added if their origin is allowed.
+func (p *Policy) Handler(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			fn(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		if r.Method != "OPTIONS" || method == "" { // Not a preflight request.
+			if p.allowOrigin(origin) {
+				p.setOrigin(h, origin)
+				if p.exposed != "" {
+					h.Set("Access-Control-Expose-Headers", p.exposed)
+				}
+			}
+			fn(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !p.allowOrigin(origin) || !p.methods[strings.ToUpper(method)] || !p.allowHeaders(reqHeaders) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		p.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(p.c.AllowedMethods, ", "))
+		if reqHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+		if p.maxAge != "" {
+			h.Set("Access-Control-Max-Age", p.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,161 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package cors
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serve sends a request with the given headers through the policy
+// and reports whether the wrapped handler was called.
+func serve(p *Policy, method string, header map[string]string) (*httptest.ResponseRecorder, bool) {
+	req, _ := http.NewRequest(method, "/task/", nil)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	called := false
+	rec := httptest.NewRecorder()
+	p.Handler(func(w http.ResponseWriter, r *http.Request) { called = true })(rec, req)
+	return rec, called
+}
+
+// newPolicy returns a new Policy configured by c or fails the test.
+func newPolicy(t *testing.T, c Config) *Policy {
+	p, err := New(c)
+	if err != nil {
+		t.Fatalf("New(%+v): unexpected error: %v", c, err)
+	}
+	return p
+}
+
+func TestAllowOrigin(t *testing.T) {
+	p := newPolicy(t, Config{AllowedOrigins: []string{"https://app.example.com", "https://*.example.org", "http://localhost:3000/"}})
+	for _, test := range []struct {
+		origin string
+		want   bool
+	}{
+		{"https://app.example.com", true},
+		{"https://APP.example.com", true},
+		{"http://app.example.com", false},
+		{"https://evil.example.com", false},
+		{"https://a.example.org", true},
+		{"https://a.b.example.org", true},
+		{"https://example.org", false},
+		{"http://a.example.org", false},
+		{"https://a.example.org.evil.com", false},
+		{"https://evilexample.org", false},
+		{"http://localhost:3000", true},
+		{"null", false},
+	} {
+		if got := p.allowOrigin(test.origin); got != test.want {
+			t.Errorf("allowOrigin(%q) = %t; want %t", test.origin, got, test.want)
+		}
+	}
+	if !newPolicy(t, DefaultConfig()).allowOrigin("https://anything.com") {
+		t.Errorf("allowOrigin with * rejected an origin")
+	}
+}
+
+func TestActualRequest(t *testing.T) {
+	c := DefaultConfig()
+	c.AllowedOrigins = []string{"https://app.example.com"}
+	c.AllowCredentials = true
+	c.ExposedHeaders = []string{"Idempotent-Replayed", "X-Request-ID"}
+	p := newPolicy(t, c)
+
+	rec, called := serve(p, "GET", map[string]string{"Origin": "https://app.example.com"})
+	if !called {
+		t.Errorf("GET: handler wasn't called")
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "Idempotent-Replayed, X-Request-ID",
+		"Vary":                             "Origin",
+	} {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("GET: got %s header %q; want %q", k, got, want)
+		}
+	}
+
+	// Not allowed origin gets no CORS headers, but the request is handled.
+	rec, called = serve(p, "GET", map[string]string{"Origin": "https://evil.com"})
+	if !called || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("GET from not allowed origin: called %t, headers %v", called, rec.Header())
+	}
+
+	// Same-origin request is passed through.
+	if _, called := serve(p, "GET", nil); !called {
+		t.Errorf("GET without origin: handler wasn't called")
+	}
+
+	// OPTIONS which isn't a preflight is passed to the handler.
+	if _, called := serve(p, "OPTIONS", map[string]string{"Origin": "https://app.example.com"}); !called {
+		t.Errorf("OPTIONS without Access-Control-Request-Method: handler wasn't called")
+	}
+}
+
+func TestWildcardOrigin(t *testing.T) {
+	rec, _ := serve(newPolicy(t, DefaultConfig()), "GET", map[string]string{"Origin": "https://app.example.com"})
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("got Access-Control-Allow-Origin %q; want %q", got, "*")
+	}
+
+	c := DefaultConfig()
+	c.AllowCredentials = true
+	for _, origins := range [][]string{{"*"}, {"https://app.example.com", "*"}} {
+		c.AllowedOrigins = origins
+		if _, err := New(c); err != ErrWildcardCredentials {
+			t.Errorf("New(%v with credentials): got error %v; want %v", origins, err, ErrWildcardCredentials)
+		}
+	}
+}
+
+func TestPreflightRequest(t *testing.T) {
+	c := DefaultConfig()
+	c.AllowedOrigins = []string{"https://*.example.com"}
+	c.MaxAge = 10 * time.Minute
+	p := newPolicy(t, c)
+
+	rec, called := serve(p, "OPTIONS", map[string]string{
+		"Origin":                         "https://app.example.com",
+		"Access-Control-Request-Method":  "PATCH",
+		"Access-Control-Request-Headers": "content-type, idempotency-key",
+	})
+	if called {
+		t.Errorf("preflight: handler was called")
+	}
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("preflight: got status code %d; want %d", rec.Code, http.StatusNoContent)
+	}
+	for k, want := range map[string]string{
+		"Access-Control-Allow-Origin":  "https://app.example.com",
+		"Access-Control-Allow-Methods": "GET, POST, PUT, PATCH, DELETE, OPTIONS",
+		"Access-Control-Allow-Headers": "content-type, idempotency-key",
+		"Access-Control-Max-Age":       "600",
+	} {
+		if got := rec.Header().Get(k); got != want {
+			t.Errorf("preflight: got %s header %q; want %q", k, got, want)
+		}
+	}
+	if got, want := rec.Header()["Vary"], []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("preflight: got Vary headers %q; want %q", got, want)
+	}
+
+	for _, header := range []map[string]string{
+		{"Origin": "https://evil.com", "Access-Control-Request-Method": "GET"},
+		{"Origin": "https://app.example.com", "Access-Control-Request-Method": "TRACE"},
+		{"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "X-Unknown"},
+	} {
+		rec, called := serve(p, "OPTIONS", header)
+		if called || rec.Code != http.StatusForbidden || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("preflight %v: got called %t, status code %d, headers %v; want rejected", header, called, rec.Code, rec.Header())
+		}
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader is the header carrying the request id.
+const RequestIDHeader = "X-Request-ID"
+
+// Handler wraps fn so every request gets an id, which is carried by
+// the request context and sent back in the RequestIDHeader response
+// header. A valid id received in the RequestIDHeader request header
+// is kept, so requests can be traced across services.
+func Handler(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		fn(w, r.WithContext(NewContext(r.Context(), id)))
+	}
+}
+
+// responseRecorder records the status code and the size of a response.
+type responseRecorder struct {
+	http.ResponseWriter
+	code  int
+	bytes int
+}
+
+// WriteHeader is part of http.ResponseWriter.
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write is part of http.ResponseWriter.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Unwrap returns the wrapped ResponseWriter for http.ResponseController.
+func (r *responseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// AccessLog wraps fn and logs its requests with their method, path,
+// query parameters, status code, response size and duration. Server
+// errors are logged at the error level, the others at the info level.
+func AccessLog(fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &responseRecorder{ResponseWriter: w}
+		fn(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+
+		level := slog.LevelInfo
+		if rec.code >= 500 {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+		}
+		if q := r.URL.Query(); len(q) > 0 {
+			keys := make([]string, 0, len(q))
+			for k := range q {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			var params []interface{}
+			for _, k := range keys {
+				params = append(params, slog.String(k, strings.Join(q[k], ",")))
+			}
+			attrs = append(attrs, slog.Group("query", params...))
+		}
+		attrs = append(attrs,
+			slog.Int("status", rec.code),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		)
+		FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
+	}
+}
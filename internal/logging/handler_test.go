@@ -0,0 +1,81 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	var got string
+	h := Handler(func(w http.ResponseWriter, r *http.Request) { got = RequestID(r.Context()) })
+
+	req, _ := http.NewRequest("GET", "/task/", nil)
+	req.Header.Set(RequestIDHeader, "client-1")
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	if got != "client-1" || rec.Header().Get(RequestIDHeader) != "client-1" {
+		t.Errorf("Handler kept request id %q, sent %q; want client-1", got, rec.Header().Get(RequestIDHeader))
+	}
+
+	req.Header.Set(RequestIDHeader, "forged\nid")
+	rec = httptest.NewRecorder()
+	h(rec, req)
+	if got == "" || got == "forged\nid" || rec.Header().Get(RequestIDHeader) != got {
+		t.Errorf("Handler with invalid request id: got %q, sent %q; want a new id", got, rec.Header().Get(RequestIDHeader))
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := New(&buf, Options{Format: "json", Redact: []string{"token"}})
+	useLogger(t, l)
+
+	h := Handler(AccessLog(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			http.Error(w, "internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("hello"))
+	}))
+	for _, method := range []string{"GET", "POST"} {
+		req, _ := http.NewRequest(method, "/task/?filter=isDone&token=s3cret", nil)
+		req.Header.Set(RequestIDHeader, "req-"+method)
+		h(httptest.NewRecorder(), req)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for _, want := range []struct {
+		level  string
+		method string
+		status int
+		bytes  int
+	}{
+		{"INFO", "GET", 200, 5},
+		{"ERROR", "POST", 500, 22},
+	} {
+		var got struct {
+			Level, Msg, Method, Path string
+			Query                    map[string]string
+			Status, Bytes            int
+			Duration                 int64
+			RequestID                string `json:"request_id"`
+		}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("AccessLog: cannot decode record: %v", err)
+		}
+		if got.Level != want.level || got.Msg != "request" || got.Method != want.method || got.Path != "/task/" ||
+			got.Status != want.status || got.Bytes != want.bytes || got.RequestID != "req-"+want.method {
+			t.Errorf("AccessLog: got record %+v; want %+v", got, want)
+		}
+		if got.Query["filter"] != "isDone" || got.Query["token"] != Redacted {
+			t.Errorf("AccessLog: got query %v; want filter and redacted token", got.Query)
+		}
+	}
+}
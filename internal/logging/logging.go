@@ -0,0 +1,105 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package logging implements structured application and access logging.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Redacted replaces the values of redacted attributes.
+const Redacted = "[REDACTED]"
+
+// Options enumerates properties of a logger.
+type Options struct {
+	// Level is the minimum level of logged messages.
+	Level slog.Level
+
+	// Format is either text (logfmt) or json.
+	Format string
+
+	// Redact lists keys of attributes, including query parameters
+	// of access logs, whose values are replaced by Redacted.
+	// The keys are matched case-insensitively.
+	Redact []string
+}
+
+// New returns a new logger writing to w. It returns an error
+// if the format is unknown.
+func New(w io.Writer, o Options) (*slog.Logger, error) {
+	redact := make(map[string]bool)
+	for _, k := range o.Redact {
+		redact[strings.ToLower(k)] = true
+	}
+	ho := &slog.HandlerOptions{
+		Level: o.Level,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if redact[strings.ToLower(a.Key)] {
+				return slog.String(a.Key, Redacted)
+			}
+			return a
+		},
+	}
+	switch o.Format {
+	case "text", "":
+		return slog.New(slog.NewTextHandler(w, ho)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, ho)), nil
+	}
+	return nil, fmt.Errorf("logging: unknown format %q", o.Format)
+}
+
+// key is the type of context keys defined in this package.
+type key int
+
+const requestIDKey key = 0
+
+// NewContext returns a new context carrying the request id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the request id carried by ctx or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the default logger which adds
+// the request id carried by ctx to the messages.
+func FromContext(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return slog.Default().With("request_id", id)
+	}
+	return slog.Default()
+}
+
+// newRequestID returns a new random request id.
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// validRequestID reports whether id received from a client may be
+// used as the request id; it must be short and printable, so it
+// can't forge log records.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+// useLogger makes l the default logger until the test ends.
+func useLogger(t *testing.T, l *slog.Logger) {
+	d := slog.Default()
+	slog.SetDefault(l)
+	t.Cleanup(func() { slog.SetDefault(d) })
+}
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := New(&buf, Options{Level: slog.LevelWarn, Format: "json", Redact: []string{"Password"}})
+	if err != nil {
+		t.Fatalf("New(...): unexpected error: %v", err)
+	}
+	l.Info("hidden")
+	l.Warn("login", "user", "alice", slog.Group("form", "password", "s3cret"))
+	var got struct {
+		Msg  string
+		User string
+		Form struct{ Password string }
+	}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatalf("New(...) logged %q: %v", buf.String(), err)
+	}
+	if got.Msg != "login" || got.User != "alice" || got.Form.Password != Redacted {
+		t.Errorf("New(...) logged %q; want login of alice with redacted password", buf.String())
+	}
+
+	buf.Reset()
+	if l, err = New(&buf, Options{}); err != nil {
+		t.Fatalf("New(...) of text format: unexpected error: %v", err)
+	}
+	l.Info("hello", "user", "alice")
+	if got := buf.String(); !strings.Contains(got, "level=INFO msg=hello user=alice") {
+		t.Errorf("New(...) of text format logged %q", got)
+	}
+
+	if _, err := New(&buf, Options{Format: "xml"}); err == nil {
+		t.Errorf("New(...) of unknown format: expected error")
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	l, _ := New(&buf, Options{})
+	useLogger(t, l)
+
+	ctx := NewContext(context.Background(), "req-1")
+	if got := RequestID(ctx); got != "req-1" {
+		t.Errorf("RequestID(...) = %q; want req-1", got)
+	}
+	FromContext(ctx).Info("hello")
+	FromContext(context.Background()).Info("world")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "msg=hello request_id=req-1") || strings.Contains(lines[1], "request_id") {
+		t.Errorf("FromContext(...) logged %q", buf.String())
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for _, test := range []struct {
+		id   string
+		want bool
+	}{
+		{"", false},
+		{"f3b6132a-9d1c-4e55", true},
+		{"trace:1.2_3", true},
+		{"a b", false},
+		{"a\nlevel=ERROR", false},
+		{strings.Repeat("a", 129), false},
+	} {
+		if got := validRequestID(test.id); got != test.want {
+			t.Errorf("validRequestID(%q) = %t; want %t", test.id, got, test.want)
+		}
+	}
+	if id := newRequestID(); !validRequestID(id) || id == newRequestID() {
+		t.Errorf("newRequestID() = %q; want a valid unique id", id)
+	}
+}
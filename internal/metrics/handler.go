@@ -0,0 +1,87 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Path specifies the path of the metrics resource.
+const Path = "/metrics"
+
+// registry holds the metrics exposed by MetricsAPI.
+var registry = NewRegistry()
+
+var (
+	httpRequests = registry.Counter("todo_http_requests_total",
+		"Number of HTTP requests by method, route and status code.",
+		"method", "route", "status")
+	httpDuration = registry.Histogram("todo_http_request_duration_seconds",
+		"Latency of HTTP requests by method, route and status code.",
+		DefBuckets, "method", "route", "status")
+)
+
+// methods lists the request methods which label the metrics. The other
+// methods are labeled OTHER, so clients can't create new series at will.
+var methods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true,
+	"OPTIONS": true, "PROPFIND": true, "REPORT": true,
+}
+
+// statusRecorder records the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+// WriteHeader is part of http.ResponseWriter.
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write is part of http.ResponseWriter.
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the wrapped ResponseWriter for http.ResponseController.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Handler wraps fn and counts its requests and measures their latency.
+// The route labels the metrics instead of the request path, so the
+// number of series doesn't grow with the number of tasks.
+func Handler(route string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		fn(rec, r)
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		method, status := r.Method, strconv.Itoa(rec.code)
+		if !methods[method] {
+			method = "OTHER"
+		}
+		httpRequests.Inc(method, route, status)
+		httpDuration.Observe(time.Since(start).Seconds(), method, route, status)
+	}
+}
+
+// MetricsAPI is a handler function that writes all metrics
+// in the Prometheus text exposition format.
+func MetricsAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	registry.WriteTo(w)
+}
@@ -0,0 +1,85 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scrape returns the metrics written by MetricsAPI.
+func scrape(t *testing.T) string {
+	req, err := http.NewRequest("GET", Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	MetricsAPI(rec, req)
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("MetricsAPI: got Content-Type %q", ct)
+	}
+	return rec.Body.String()
+}
+
+// value returns the value of the series in the scraped metrics,
+// or 0 if the series is missing.
+func value(metrics, series string) float64 {
+	for _, l := range strings.Split(metrics, "\n") {
+		if strings.HasPrefix(l, series+" ") {
+			v, _ := strconv.ParseFloat(strings.TrimPrefix(l, series+" "), 64)
+			return v
+		}
+	}
+	return 0
+}
+
+// checkDeltas checks that the series changed by the deltas
+// between the scrapes before and after.
+func checkDeltas(t *testing.T, before, after string, deltas map[string]float64) {
+	for series, want := range deltas {
+		if got := value(after, series) - value(before, series); got != want {
+			t.Errorf("MetricsAPI: %s changed by %v; want %v in:\n%s", series, got, want, after)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	h := Handler("/test/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusCreated)
+			w.WriteHeader(http.StatusInternalServerError) // Superfluous.
+		case "GET":
+			w.Write([]byte("ok"))
+		}
+	})
+	before := scrape(t)
+	for _, method := range []string{"GET", "GET", "POST", "DELETE", "BREW", "X-RANDOM-1"} {
+		req, err := http.NewRequest(method, "/test/42", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h(httptest.NewRecorder(), req)
+	}
+
+	got := scrape(t)
+	checkDeltas(t, before, got, map[string]float64{
+		`todo_http_requests_total{method="GET",route="/test/",status="200"}`:                             2,
+		`todo_http_requests_total{method="POST",route="/test/",status="201"}`:                            1,
+		`todo_http_requests_total{method="DELETE",route="/test/",status="200"}`:                          1,
+		`todo_http_requests_total{method="OTHER",route="/test/",status="200"}`:                           2,
+		`todo_http_request_duration_seconds_count{method="GET",route="/test/",status="200"}`:             2,
+		`todo_http_request_duration_seconds_bucket{method="POST",route="/test/",status="201",le="+Inf"}`: 1,
+	})
+	if strings.Contains(got, "/test/42") {
+		t.Errorf("MetricsAPI: request path is used as a label")
+	}
+	if strings.Contains(got, "BREW") {
+		t.Errorf("MetricsAPI: unknown request method is used as a label")
+	}
+}
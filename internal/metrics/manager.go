@@ -0,0 +1,138 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/mrekucci/todo/internal/task"
+)
+
+var managerDuration = registry.Histogram("todo_manager_operation_duration_seconds",
+	"Latency of task storage operations by operation.",
+	[]float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1}, "op")
+
+// now returns the current time. It is replaced in tests.
+var now = time.Now
+
+// counted is the Manager whose tasks are counted by the gauges.
+var counted task.Manager
+
+func init() {
+	// count returns the number of the tasks matched by the filter
+	// returned by f, which is called at each scrape.
+	count := func(f func() task.Filter) func() float64 {
+		return func() float64 {
+			if counted == nil {
+				return 0
+			}
+			return float64(len(f().Tasks(counted.All())))
+		}
+	}
+	all := func() task.Filter { return func(t *task.Task) bool { return true } }
+	done := func() task.Filter { return func(t *task.Task) bool { return t.Done } }
+	overdue := func() task.Filter { return task.Overdue(now().UTC()) }
+	registry.GaugeFunc("todo_tasks", "Number of stored tasks, except the deleted ones.", count(all))
+	registry.GaugeFunc("todo_tasks_done", "Number of done tasks.", count(done))
+	registry.GaugeFunc("todo_tasks_overdue", "Number of not done tasks scheduled in the past.", count(overdue))
+}
+
+// Count makes the task gauges count the tasks of m. It should be the
+// storage rather than a Manager decorated by the middlewares, so the
+// scrapes aren't logged, validated or measured as storage operations.
+// All-day tasks are overdue after their day ends in UTC.
+func Count(m task.Manager) {
+	counted = m
+}
+
+// instrumented is a task.Manager measuring the latency of the operations
+// of the Manager it wraps.
+type instrumented struct {
+	task.Manager
+}
+
+// Manager returns a task.Manager which measures the latency of the
+// operations of m.
+func Manager(m task.Manager) task.Manager {
+	return &instrumented{m}
+}
+
+// WithContext returns m whose operations are made with ctx.
+func (m *instrumented) WithContext(ctx context.Context) task.Manager {
+	return &instrumented{task.WithContext(ctx, m.Manager)}
+}
+
+// observe records the latency of the operation op started at start.
+func observe(op string, start time.Time) {
+	managerDuration.Observe(time.Since(start).Seconds(), op)
+}
+
+func (m *instrumented) Create(title string) (*task.Task, error) {
+	defer observe("create", time.Now())
+	return m.Manager.Create(title)
+}
+
+func (m *instrumented) Find(id int) (*task.Task, bool) {
+	defer observe("find", time.Now())
+	return m.Manager.Find(id)
+}
+
+func (m *instrumented) All() []*task.Task {
+	defer observe("all", time.Now())
+	return m.Manager.All()
+}
+
+func (m *instrumented) Update(t *task.Task) error {
+	defer observe("update", time.Now())
+	return m.Manager.Update(t)
+}
+
+func (m *instrumented) Delete(id int) error {
+	defer observe("delete", time.Now())
+	return m.Manager.Delete(id)
+}
+
+func (m *instrumented) Count() int {
+	defer observe("count", time.Now())
+	return m.Manager.Count()
+}
+
+func (m *instrumented) Trash() []*task.Task {
+	defer observe("trash", time.Now())
+	return m.Manager.Trash()
+}
+
+func (m *instrumented) Restore(id int) (*task.Task, error) {
+	defer observe("restore", time.Now())
+	return m.Manager.Restore(id)
+}
+
+func (m *instrumented) Purge(id int) error {
+	defer observe("purge", time.Now())
+	return m.Manager.Purge(id)
+}
+
+func (m *instrumented) PurgeBefore(t time.Time) int {
+	defer observe("purge_before", time.Now())
+	return m.Manager.PurgeBefore(t)
+}
+
+// Tx measures the latency of the whole transaction
+// and of the operations made within it.
+func (m *instrumented) Tx(fn func(m task.Manager) error) error {
+	defer observe("tx", time.Now())
+	return m.Manager.Tx(func(tx task.Manager) error { return fn(&instrumented{tx}) })
+}
+
+func (m *instrumented) Flush() error {
+	defer observe("flush", time.Now())
+	return m.Manager.Flush()
+}
+
+func (m *instrumented) Ping() error {
+	defer observe("ping", time.Now())
+	return m.Manager.Ping()
+}
@@ -0,0 +1,66 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mrekucci/todo/internal/task"
+)
+
+func TestManager(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) } // 2015-03-18 15:13:10 UTC.
+	defer Count(nil)
+
+	before := scrape(t)
+	s := task.NewManager()
+	Count(s)
+	m := Manager(s)
+	for _, u := range []task.Task{
+		{Title: "Task 0"},
+		{Title: "Task 1", Done: true, Date: 1426691580},
+		{Title: "Task 2", Date: 1426691580},
+		{Title: "Task 3", Date: 1426691600},
+		{Title: "Task 4", Date: 1426636800, AllDay: true}, // Today.
+		{Title: "Task 5", Date: 1426550400, AllDay: true}, // Yesterday.
+	} {
+		c, err := m.Create(u.Title)
+		if err != nil {
+			t.Fatalf("Create(%q): unexpected error: %v", u.Title, err)
+		}
+		u.ID = c.ID
+		if err := m.Update(&u); err != nil {
+			t.Fatalf("Update(%v): unexpected error: %v", u, err)
+		}
+	}
+	m.Tx(func(tx task.Manager) error {
+		_, err := tx.Create("Task 6")
+		return err
+	})
+	if err := m.Delete(0); err != nil {
+		t.Fatalf("Delete(0): unexpected error: %v", err)
+	}
+
+	got := scrape(t)
+	for _, want := range []string{
+		"todo_tasks 6",
+		"todo_tasks_done 1",
+		"todo_tasks_overdue 2",
+	} {
+		if !strings.Contains(got, want+"\n") {
+			t.Errorf("MetricsAPI: missing %s in:\n%s", want, got)
+		}
+	}
+	checkDeltas(t, before, got, map[string]float64{
+		`todo_manager_operation_duration_seconds_count{op="create"}`: 7,
+		`todo_manager_operation_duration_seconds_count{op="update"}`: 6,
+		`todo_manager_operation_duration_seconds_count{op="tx"}`:     1,
+		`todo_manager_operation_duration_seconds_count{op="delete"}`: 1,
+		`todo_manager_operation_duration_seconds_count{op="all"}`:    0, // The scrapes aren't measured.
+	})
+}
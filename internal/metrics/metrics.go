@@ -0,0 +1,221 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+// Package metrics collects metrics of the server and exposes
+// them in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default upper bounds of histogram buckets in seconds.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// kind enumerates types of metrics.
+type kind string
+
+const (
+	counter   kind = "counter"
+	gauge     kind = "gauge"
+	histogram kind = "histogram"
+)
+
+// series holds the value of a metric with specific label values.
+type series struct {
+	values []string // Label values.
+	value  float64  // Value of a counter.
+	counts []uint64 // Non-cumulative counts of histogram buckets.
+	sum    float64  // Sum of the observed values.
+	count  uint64   // Number of the observed values.
+}
+
+// family is a metric with all its series. It is safe for concurrent use.
+type family struct {
+	name    string
+	help    string
+	kind    kind
+	labels  []string
+	buckets []float64
+	value   func() float64 // Value of a gauge.
+
+	mu     sync.Mutex
+	series map[string]*series // Series by their joined label values.
+}
+
+// with returns the series with label values, creating it if necessary.
+// The caller must hold f.mu.
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s: got %d label values; want %d", f.name, len(values), len(f.labels)))
+	}
+	k := strings.Join(values, "\xff")
+	s, ok := f.series[k]
+	if !ok {
+		s = &series{values: append([]string(nil), values...)}
+		if f.kind == histogram {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		f.series[k] = s
+	}
+	return s
+}
+
+// Counter is a monotonically increasing metric partitioned by labels.
+type Counter struct{ f *family }
+
+// Add adds v to the counter with label values.
+func (c Counter) Add(v float64, values ...string) {
+	c.f.mu.Lock()
+	c.f.with(values).value += v
+	c.f.mu.Unlock()
+}
+
+// Inc increments the counter with label values.
+func (c Counter) Inc(values ...string) { c.Add(1, values...) }
+
+// Histogram counts observed values in buckets partitioned by labels.
+type Histogram struct{ f *family }
+
+// Observe adds v to the histogram with label values.
+func (h Histogram) Observe(v float64, values ...string) {
+	h.f.mu.Lock()
+	defer h.f.mu.Unlock()
+	s := h.f.with(values)
+	if i := sort.SearchFloat64s(h.f.buckets, v); i < len(s.counts) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Registry holds metrics. It is safe for concurrent use.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+}
+
+// NewRegistry returns a new Registry without any metrics.
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+// register adds f to the registry. It panics if a metric
+// with the same name is already registered.
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, e := range r.families {
+		if e.name == f.name {
+			panic("metrics: duplicate metric " + f.name)
+		}
+	}
+	f.series = make(map[string]*series)
+	r.families = append(r.families, f)
+	return f
+}
+
+// Counter registers and returns a new counter.
+func (r *Registry) Counter(name, help string, labels ...string) Counter {
+	return Counter{r.register(&family{name: name, help: help, kind: counter, labels: labels})}
+}
+
+// Histogram registers and returns a new histogram with the bucket
+// upper bounds, which must be sorted in increasing order.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	return Histogram{r.register(&family{name: name, help: help, kind: histogram, labels: labels, buckets: buckets})}
+}
+
+// GaugeFunc registers a gauge whose value is computed by fn on every scrape.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, kind: gauge, value: fn})
+}
+
+// WriteTo writes all metrics to w in the Prometheus text format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]*family(nil), r.families...)
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	var b strings.Builder
+	for _, f := range families {
+		fmt.Fprintf(&b, "# HELP %s %s\n", f.name, escape(f.help, false))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", f.name, f.kind)
+		if f.kind == gauge {
+			fmt.Fprintf(&b, "%s %s\n", f.name, number(f.value()))
+			continue
+		}
+		f.mu.Lock()
+		series := make([]*series, 0, len(f.series))
+		for _, s := range f.series {
+			series = append(series, s)
+		}
+		sort.Slice(series, func(i, j int) bool {
+			return strings.Join(series[i].values, "\xff") < strings.Join(series[j].values, "\xff")
+		})
+		for _, s := range series {
+			if f.kind == counter {
+				fmt.Fprintf(&b, "%s%s %s\n", f.name, labels(f.labels, s.values, ""), number(s.value))
+				continue
+			}
+			var n uint64
+			for i, ub := range f.buckets {
+				n += s.counts[i]
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, labels(f.labels, s.values, number(ub)), n)
+			}
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", f.name, labels(f.labels, s.values, "+Inf"), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", f.name, labels(f.labels, s.values, ""), number(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", f.name, labels(f.labels, s.values, ""), s.count)
+		}
+		f.mu.Unlock()
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// labels returns the label pairs formatted as {name="value",...},
+// followed by the le label of a histogram bucket if le isn't empty.
+func labels(names, values []string, le string) string {
+	var p []string
+	for i, n := range names {
+		p = append(p, n+`="`+escape(values[i], true)+`"`)
+	}
+	if le != "" {
+		p = append(p, `le="`+le+`"`)
+	}
+	if len(p) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(p, ",") + "}"
+}
+
+// escape escapes backslashes and new lines, and also
+// double quotes if quote is true, as the format requires.
+func escape(s string, quote bool) string {
+	r := strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	if quote {
+		r = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+	}
+	return r.Replace(s)
+}
+
+// number formats v as the format requires.
+func number(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,68 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestRegistryWriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.Counter("requests_total", "Number of requests.", "method", "path")
+	c.Inc("GET", `/a"b\c`)
+	c.Add(2, "GET", "/")
+	h := r.Histogram("latency_seconds", "Latency\nof requests.", []float64{0.1, 1}, "method")
+	h.Observe(0.05, "GET")
+	h.Observe(0.1, "GET")
+	h.Observe(0.5, "GET")
+	h.Observe(5, "GET")
+	r.GaugeFunc("temperature", "Current temperature.", func() float64 { return math.Inf(-1) })
+
+	var buf bytes.Buffer
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo(...): unexpected error: %v", err)
+	}
+	want := `# HELP latency_seconds Latency\nof requests.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="GET",le="0.1"} 2
+latency_seconds_bucket{method="GET",le="1"} 3
+latency_seconds_bucket{method="GET",le="+Inf"} 4
+latency_seconds_sum{method="GET"} 5.65
+latency_seconds_count{method="GET"} 4
+# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{method="GET",path="/"} 2
+requests_total{method="GET",path="/a\"b\\c"} 1
+# HELP temperature Current temperature.
+# TYPE temperature gauge
+temperature -Inf
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTo(...) wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRegistryPanics(t *testing.T) {
+	for name, fn := range map[string]func(r *Registry){
+		"duplicate metric": func(r *Registry) {
+			r.Counter("a", "")
+			r.Counter("a", "")
+		},
+		"wrong number of label values": func(r *Registry) {
+			r.Counter("a", "", "method").Inc()
+		},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			fn(NewRegistry())
+		}()
+	}
+}
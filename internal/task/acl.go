@@ -0,0 +1,267 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// SharePath specifies the path of the resource sharing all tasks of a user.
+const SharePath = "/share/"
+
+// Role enumerates levels of access to tasks.
+type Role int
+
+// Roles ordered by the level of access they grant.
+const (
+	RoleNone   Role = iota // No access.
+	RoleViewer             // Read access.
+	RoleEditor             // Read and update access.
+	RoleOwner              // Full access, including deletion and sharing.
+)
+
+var roleNames = [...]string{"none", "viewer", "editor", "owner"}
+
+// String returns the name of the role.
+func (r Role) String() string {
+	if r < 0 || int(r) >= len(roleNames) {
+		return "Role(" + strconv.Itoa(int(r)) + ")"
+	}
+	return roleNames[r]
+}
+
+// MarshalText is part of encoding.TextMarshaler.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// UnmarshalText is part of encoding.TextUnmarshaler.
+func (r *Role) UnmarshalText(b []byte) error {
+	for i, n := range roleNames {
+		if n == string(b) {
+			*r = Role(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", b)
+}
+
+// Grant describes an access granted to a user.
+type Grant struct {
+	Owner  string `json:"owner"`            // Owner of the shared tasks.
+	TaskID *int   `json:"taskId,omitempty"` // Shared task; nil if all tasks of the owner are shared.
+	User   string `json:"user"`
+	Role   Role   `json:"role"`
+}
+
+// listGrant is the key of a grant sharing all tasks of owner with user.
+type listGrant struct {
+	owner, user string
+}
+
+// taskGrant is the key of a grant sharing a single task with user.
+type taskGrant struct {
+	id   int
+	user string
+}
+
+// acl stores access granted to users. It is safe for concurrent use.
+type acl struct {
+	mu    sync.RWMutex
+	lists map[listGrant]Role
+	tasks map[taskGrant]Role
+	owner map[int]string // Owners of the shared tasks.
+}
+
+// newACL returns a new acl without any grants.
+func newACL() *acl {
+	return &acl{
+		lists: make(map[listGrant]Role),
+		tasks: make(map[taskGrant]Role),
+		owner: make(map[int]string),
+	}
+}
+
+var grants = newACL()
+
+// role returns the role of user for task t.
+func (a *acl) role(user string, t *Task) Role {
+	if t.Owner == user {
+		return RoleOwner
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	r := a.lists[listGrant{t.Owner, user}]
+	if tr := a.tasks[taskGrant{t.ID, user}]; tr > r {
+		r = tr
+	}
+	return r
+}
+
+// shareList grants user the role for all tasks of owner.
+// RoleNone revokes the grant.
+func (a *acl) shareList(owner, user string, r Role) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r == RoleNone {
+		delete(a.lists, listGrant{owner, user})
+		return
+	}
+	a.lists[listGrant{owner, user}] = r
+}
+
+// shareTask grants user the role for task t. RoleNone revokes the grant.
+func (a *acl) shareTask(t *Task, user string, r Role) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if r == RoleNone {
+		delete(a.tasks, taskGrant{t.ID, user})
+		return
+	}
+	a.tasks[taskGrant{t.ID, user}] = r
+	a.owner[t.ID] = t.Owner
+}
+
+// list returns the grants matching the filter f ordered by user.
+func (a *acl) list(f func(g *Grant) bool) []*Grant {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	var r []*Grant
+	for k, role := range a.lists {
+		if g := (&Grant{Owner: k.owner, User: k.user, Role: role}); f(g) {
+			r = append(r, g)
+		}
+	}
+	for k, role := range a.tasks {
+		id := k.id
+		if g := (&Grant{Owner: a.owner[id], TaskID: &id, User: k.user, Role: role}); f(g) {
+			r = append(r, g)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].User != r[j].User {
+			return r[i].User < r[j].User
+		}
+		return r[i].TaskID != nil && (r[j].TaskID == nil || *r[i].TaskID < *r[j].TaskID)
+	})
+	return r
+}
+
+// roleOf returns the role of the user who made the request for task t.
+func roleOf(r *http.Request, t *Task) Role {
+	return grants.role(owner(r), t)
+}
+
+// authorize checks that the user who made the request has at least
+// the role need for task t. Tasks which the user can't see are
+// reported as not found, so their existence isn't revealed.
+func authorize(r *http.Request, t *Task, need Role) error {
+	switch role := roleOf(r, t); {
+	case role == RoleNone:
+		return notFoundError(fmt.Errorf("task id: %d doesn't exists", t.ID))
+	case role < need:
+		return &errRequest{fmt.Errorf("task id: %d requires %s role", t.ID, need), http.StatusForbidden}
+	}
+	return nil
+}
+
+// visible returns a Filter matching tasks which the user who made
+// the request has at least the role need for.
+func visible(r *http.Request, need Role) Filter {
+	return func(t *Task) bool { return roleOf(r, t) >= need }
+}
+
+// shareReq is a request for granting a role to a user.
+type shareReq struct {
+	User string `json:"user"`
+	Role Role   `json:"role"`
+}
+
+// decodeShareReq decodes shareReq from the request body.
+func decodeShareReq(r *http.Request) (*shareReq, error) {
+	req := new(shareReq)
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, badRequestError(err)
+	}
+	if req.User == "" {
+		return nil, badRequestError(fmt.Errorf("missing user"))
+	}
+	return req, nil
+}
+
+// writeGrants writes grants to the response.
+func writeGrants(w http.ResponseWriter, grants []*Grant) error {
+	res := struct {
+		Grants []*Grant `json:"grants"`
+	}{
+		grants,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// share handles requests to the sharing of a specific task. The grants
+// are listed by GET, granted by POST and revoked by DELETE of the
+// share/{user} subresource. They can be managed only by owners.
+func share(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	t, err := storage().FindContext(r.Context(), id)
+	if err == ErrFindUnknown {
+		return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
+	}
+	if err != nil {
+		return err
+	}
+	if err := authorize(r, t, RoleOwner); err != nil {
+		return err
+	}
+
+	switch user := strings.TrimPrefix(strings.TrimPrefix(subresource(r), "share"), "/"); {
+	case r.Method == "GET" && user == "":
+		return writeGrants(w, grants.list(func(g *Grant) bool { return g.TaskID != nil && *g.TaskID == id }))
+	case r.Method == "POST" && user == "":
+		req, err := decodeShareReq(r)
+		if err != nil {
+			return err
+		}
+		grants.shareTask(t, req.User, req.Role)
+	case r.Method == "DELETE" && user != "":
+		grants.shareTask(t, user, RoleNone)
+	default:
+		return badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+	}
+	return nil
+}
+
+// ShareAPI is a handler function that handles http requests to the sharing
+// of all tasks of the user who made the request. The grants are listed by
+// GET, granted by POST and revoked by DELETE of the /share/{user} resource.
+func ShareAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	o := owner(r)
+	switch user := r.URL.Path[len(SharePath):]; {
+	case r.Method == "GET" && user == "":
+		err = writeGrants(w, grants.list(func(g *Grant) bool { return g.Owner == o }))
+	case r.Method == "POST" && user == "":
+		var req *shareReq
+		if req, err = decodeShareReq(r); err == nil {
+			grants.shareList(o, req.User, req.Role)
+		}
+	case r.Method == "DELETE" && user != "":
+		grants.shareList(o, user, RoleNone)
+	default:
+		err = badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+	}
+	errorHandler(w, r, err)
+}
@@ -0,0 +1,154 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRoleText(t *testing.T) {
+	for _, r := range []Role{RoleNone, RoleViewer, RoleEditor, RoleOwner} {
+		b, err := r.MarshalText()
+		if err != nil {
+			t.Fatalf("%v.MarshalText(): unexpected error: %v", r, err)
+		}
+		var got Role
+		if err := got.UnmarshalText(b); err != nil || got != r {
+			t.Errorf("UnmarshalText(%q) = %v, %v; want %v, <nil>", b, got, err, r)
+		}
+	}
+	var r Role
+	if err := r.UnmarshalText([]byte("admin")); err == nil {
+		t.Errorf("UnmarshalText(%q): expected error", "admin")
+	}
+}
+
+func TestRole(t *testing.T) {
+	a := newACL()
+	t0 := &Task{ID: 0, Owner: "alice"}
+	t1 := &Task{ID: 1, Owner: "alice"}
+	a.shareList("alice", "bob", RoleViewer)
+	a.shareTask(t1, "bob", RoleEditor)
+	a.shareTask(t0, "carol", RoleOwner)
+
+	for _, test := range []struct {
+		user string
+		task *Task
+		want Role
+	}{
+		{"alice", t0, RoleOwner},
+		{"bob", t0, RoleViewer},
+		{"bob", t1, RoleEditor},
+		{"carol", t0, RoleOwner},
+		{"carol", t1, RoleNone},
+		{"dave", t0, RoleNone},
+	} {
+		if got := a.role(test.user, test.task); got != test.want {
+			t.Errorf("role(%q, %v) = %v; want %v", test.user, test.task, got, test.want)
+		}
+	}
+
+	a.shareList("alice", "bob", RoleNone)
+	a.shareTask(t1, "bob", RoleNone)
+	if got := a.role("bob", t1); got != RoleNone {
+		t.Errorf("role(%q, %v) after revoke = %v; want %v", "bob", t1, got, RoleNone)
+	}
+}
+
+func TestShareReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	grants = newACL()
+	sendAs(t, RestAPI, "alice", "POST", Path, `{"title":"Task 0"}`)
+	sendAs(t, RestAPI, "alice", "POST", Path, `{"title":"Task 1"}`)
+	sendAs(t, RestAPI, "alice", "POST", Path, `{"title":"Task 2"}`)
+
+	// Nothing is shared yet: reads are not found, writes too.
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", Path + "0", "", http.StatusNotFound},
+		{"GET", Path + "0/history", "", http.StatusNotFound},
+		{"PUT", Path + "0", `{"id":0,"title":"Updated"}`, http.StatusNotFound},
+		{"DELETE", Path + "0", "", http.StatusNotFound},
+		{"GET", Path + "0/share", "", http.StatusNotFound},
+	} {
+		if rec := sendAs(t, RestAPI, "bob", test.method, test.path, test.body); rec.Code != test.code {
+			t.Errorf("%s %s as bob without access: got status code %d; want %d", test.method, test.path, rec.Code, test.code)
+		}
+	}
+
+	// Share task 0 for editing and the whole list for viewing.
+	if rec := sendAs(t, RestAPI, "alice", "POST", Path+"0/share", `{"user":"bob","role":"editor"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST %s0/share: got status code %d; want %d\nRecieve body: %q", Path, rec.Code, http.StatusOK, rec.Body)
+	}
+	if rec := sendAs(t, ShareAPI, "alice", "POST", SharePath, `{"user":"bob","role":"viewer"}`); rec.Code != http.StatusOK {
+		t.Fatalf("POST %s: got status code %d; want %d\nRecieve body: %q", SharePath, rec.Code, http.StatusOK, rec.Body)
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{"GET", Path + "1", "", http.StatusOK},
+		{"GET", Path + "1/history", "", http.StatusOK},
+		{"PUT", Path + "1", `{"id":1,"title":"Updated"}`, http.StatusForbidden},
+		{"DELETE", Path + "1", "", http.StatusForbidden},
+		{"POST", Path + "1/share", `{"user":"carol","role":"owner"}`, http.StatusForbidden},
+		{"POST", BulkPath, `{"operations":[{"op":"update","task":{"id":1,"title":"Updated"}}]}`, http.StatusBadRequest},
+		{"PUT", Path + "0", `{"id":0,"title":"Updated"}`, http.StatusOK},
+		{"DELETE", Path + "0", "", http.StatusForbidden},
+	} {
+		if rec := sendAs(t, RestAPI, "bob", test.method, test.path, test.body); rec.Code != test.code {
+			t.Errorf("%s %s as bob with access: got status code %d; want %d", test.method, test.path, rec.Code, test.code)
+		}
+	}
+	if task, _ := tasks.Find(0); task.Owner != "alice" || task.Title != "Updated" {
+		t.Errorf("task updated by editor = %v; want owner alice and title Updated", task)
+	}
+
+	rec := sendAs(t, RestAPI, "bob", "GET", Path, "")
+	res := struct {
+		Tasks []Task `json:"tasks"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(res.Tasks), 3; got != want {
+		t.Errorf("GET %s as bob: got %d tasks; want %d", Path, got, want)
+	}
+
+	// List the grants.
+	rec = sendAs(t, ShareAPI, "alice", "GET", SharePath, "")
+	list := struct {
+		Grants []*Grant `json:"grants"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatal(err)
+	}
+	id := 0
+	want := []*Grant{
+		{Owner: "alice", TaskID: &id, User: "bob", Role: RoleEditor},
+		{Owner: "alice", User: "bob", Role: RoleViewer},
+	}
+	if !reflect.DeepEqual(list.Grants, want) {
+		t.Errorf("GET %s\n got %+v\nwant %+v", SharePath, list.Grants, want)
+	}
+
+	// Revoke the grants.
+	sendAs(t, RestAPI, "alice", "DELETE", Path+"0/share/bob", "")
+	sendAs(t, ShareAPI, "alice", "DELETE", SharePath+"bob", "")
+	if rec := sendAs(t, RestAPI, "bob", "GET", Path+"0", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET %s0 as bob after revoke: got status code %d; want %d", Path, rec.Code, http.StatusNotFound)
+	}
+}
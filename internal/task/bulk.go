@@ -0,0 +1,142 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// BulkPath specifies the path of the bulk operations resource.
+const BulkPath = Path + "_bulk"
+
+// maxBulkOps limits the number of operations in a single bulk request.
+const maxBulkOps = 1000
+
+// errBulkAborted indicates that a bulk transaction was rolled back.
+var errBulkAborted = errors.New("bulk: transaction aborted")
+
+// bulkOp enumerates properties of a single bulk operation.
+type bulkOp struct {
+	Op    string `json:"op"`
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Task  *Task  `json:"task"`
+}
+
+// bulkResult reports the outcome of a single bulk operation.
+type bulkResult struct {
+	Op    string `json:"op"`
+	ID    int    `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// apply applies the operation made by the request to m and returns its
+// result together with the change of the task made by the operation.
+func (op *bulkOp) apply(ctx context.Context, m ContextManager, r *http.Request) (res bulkResult, c change, err error) {
+	res = bulkResult{Op: op.Op, ID: op.ID}
+	switch op.Op {
+	case "create":
+		if c.after, err = createTask(ctx, m, op.Title, owner(r)); err == nil {
+			res.ID = c.after.ID
+		}
+	case "update":
+		if op.Task == nil {
+			err = fmt.Errorf("update: missing task")
+			break
+		}
+		res.ID = op.Task.ID
+		if c.before, err = m.FindContext(ctx, op.Task.ID); err == ErrFindUnknown {
+			err = ErrUpdateUnknown
+		}
+		if err != nil {
+			break
+		}
+		if err = authorize(r, c.before, RoleEditor); err != nil {
+			break
+		}
+		op.Task.Owner, op.Task.Deleted = c.before.Owner, 0
+		if err = m.UpdateContext(ctx, op.Task); err == nil {
+			c.after, err = m.FindContext(ctx, op.Task.ID)
+		}
+	case "delete":
+		if c.before, err = m.FindContext(ctx, op.ID); err == ErrFindUnknown {
+			err = ErrDeleteUnknown
+		}
+		if err != nil {
+			break
+		}
+		if err = authorize(r, c.before, RoleOwner); err != nil {
+			break
+		}
+		if err = m.DeleteContext(ctx, op.ID); err == nil {
+			c.after, err = findDeleted(ctx, m, op.ID)
+		}
+	default:
+		err = fmt.Errorf("%q operation doesn't exists", op.Op)
+	}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res, c, err
+}
+
+// bulk handles requests for the atomic application of multiple
+// create, update and delete operations. Either all operations
+// are applied or none of them.
+func bulk(w http.ResponseWriter, r *http.Request) error {
+	req := struct {
+		Operations []*bulkOp `json:"operations"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return badRequestError(err)
+	}
+	switch n := len(req.Operations); {
+	case n == 0:
+		return badRequestError(fmt.Errorf("no operations"))
+	case n > maxBulkOps:
+		return badRequestError(fmt.Errorf("too many operations: %d > %d", n, maxBulkOps))
+	}
+
+	res := struct {
+		Applied bool         `json:"applied"`
+		Results []bulkResult `json:"results"`
+	}{}
+	var changes []change
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) error {
+		res.Results, changes = res.Results[:0], changes[:0]
+		failed := false
+		for _, op := range req.Operations {
+			result, c, err := op.apply(ctx, m, r)
+			if isContextError(err) {
+				return err
+			}
+			res.Results = append(res.Results, result)
+			changes = append(changes, c)
+			failed = failed || err != nil
+		}
+		if failed {
+			return errBulkAborted
+		}
+		return nil
+	})
+	code := http.StatusOK
+	switch err {
+	case nil:
+		res.Applied = true
+		commit(r, changes...)
+	case errBulkAborted:
+		code = http.StatusBadRequest
+	default:
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(res)
+}
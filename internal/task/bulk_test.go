@@ -0,0 +1,110 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestBulkReq(t *testing.T) {
+	for _, test := range []struct {
+		json    string
+		code    int
+		applied bool
+		ids     []int
+		want    []Task
+	}{
+		{
+			`{"operations":[{"op":"create","title":"Task 2"},{"op":"update","task":{"id":1,"title":"Updated Task 1","done":true}},{"op":"delete","id":0}]}`,
+			http.StatusOK, true, []int{2, 1, 0},
+			[]Task{{ID: 1, Title: "Updated Task 1", Done: true}, {ID: 2, Title: "Task 2"}},
+		},
+		{
+			`{"operations":[{"op":"create","title":"Task 2"},{"op":"delete","id":0},{"op":"delete","id":5}]}`,
+			http.StatusBadRequest, false, []int{2, 0, 5},
+			[]Task{{ID: 0, Title: "Task 0"}, {ID: 1, Title: "Task 1"}},
+		},
+		{
+			`{"operations":[{"op":"create","title":""}]}`,
+			http.StatusBadRequest, false, []int{0},
+			[]Task{{ID: 0, Title: "Task 0"}, {ID: 1, Title: "Task 1"}},
+		},
+		{
+			`{"operations":[{"op":"unknown"}]}`,
+			http.StatusBadRequest, false, []int{0},
+			[]Task{{ID: 0, Title: "Task 0"}, {ID: 1, Title: "Task 1"}},
+		},
+	} {
+		tasks = NewManager()
+		if err := addTasks(tasks, testTasks[:2], t); err != nil {
+			t.Fatalf("cannot initialize test with tasks due to: %v", err)
+		}
+
+		req, err := http.NewRequest("POST", BulkPath, bytes.NewBufferString(test.json))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %v: %v", req, err)
+			t.Errorf("Request body: %v", test.json)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+
+		res := struct {
+			Applied bool         `json:"applied"`
+			Results []bulkResult `json:"results"`
+		}{}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("HTTP request %v: cannot decode response: %v", req, err)
+		}
+		if res.Applied != test.applied {
+			t.Errorf("HTTP request %v: got applied %t; want %t", req, res.Applied, test.applied)
+		}
+		var ids []int
+		for _, r := range res.Results {
+			ids = append(ids, r.ID)
+		}
+		if !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("HTTP request %v: got result IDs %v; want %v", req, ids, test.ids)
+		}
+		if got := ptrToVal(tasks.All()); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("HTTP request %v\n got %v\nwant %v", req, got, test.want)
+		}
+	}
+}
+
+func TestBulkReqError(t *testing.T) {
+	tasks = NewManager()
+	for _, test := range []struct {
+		json string
+		code int
+	}{
+		{`{"operations":}`, http.StatusBadRequest},
+		{`{"operations":[]}`, http.StatusBadRequest},
+		{`{}`, http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest("POST", BulkPath, bytes.NewBufferString(test.json))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %v: %v", req, err)
+			t.Errorf("Request body: %v", test.json)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrFindUnknown indicates attempt to find unknown task.
+var ErrFindUnknown = errors.New("Find: unknown task")
+
+// ContextManager is a variant of Manager whose operations take a context.
+// The context carries request-scoped values, like the acting user, to the
+// storage, and an operation whose context is done fails with the context
+// error. Backends implement it next to Manager to honor the contexts;
+// the other backends are adapted by Contextual.
+type ContextManager interface {
+	// Returns new task with given title.
+	CreateContext(ctx context.Context, title string) (*Task, error)
+
+	// Returns task with given id.
+	// ErrFindUnknown is returned if a task with such an id doesn't exist.
+	FindContext(ctx context.Context, id int) (*Task, error)
+
+	// Returns all stored tasks, except the deleted ones.
+	AllContext(ctx context.Context) ([]*Task, error)
+
+	// Updates given task.
+	UpdateContext(ctx context.Context, task *Task) error
+
+	// Moves task with given id to the trash.
+	DeleteContext(ctx context.Context, id int) error
+
+	// Returns a number of stored tasks, except the deleted ones.
+	CountContext(ctx context.Context) (int, error)
+
+	// Returns all deleted tasks.
+	TrashContext(ctx context.Context) ([]*Task, error)
+
+	// Moves deleted task with given id back from the trash.
+	RestoreContext(ctx context.Context, id int) (*Task, error)
+
+	// Permanently removes deleted task with given id.
+	PurgeContext(ctx context.Context, id int) error
+
+	// Permanently removes tasks deleted before t.
+	// Returns a number of removed tasks.
+	PurgeBeforeContext(ctx context.Context, t time.Time) (int, error)
+
+	// Runs fn within a transaction, like Manager.Tx. The transaction
+	// isn't applied if ctx is done before fn returns.
+	TxContext(ctx context.Context, fn func(ctx context.Context, m ContextManager) error) error
+
+	// Writes all changes to the underlying storage.
+	FlushContext(ctx context.Context) error
+
+	// Checks that the underlying storage is healthy.
+	PingContext(ctx context.Context) error
+}
+
+// ContextBinder is implemented by Managers which pass a context to the
+// storage, like the file backend and the middlewares, so the middlewares
+// decorating a backend honoring contexts don't hide it.
+type ContextBinder interface {
+	// Returns the Manager whose operations take ctx.
+	WithContext(ctx context.Context) Manager
+}
+
+// WithContext returns m whose operations take ctx. A ContextBinder is
+// bound by its WithContext method and a ContextManager is adapted to call
+// its operations with ctx; other Managers are returned as they are.
+func WithContext(ctx context.Context, m Manager) Manager {
+	switch m := m.(type) {
+	case ContextBinder:
+		return m.WithContext(ctx)
+	case ContextManager:
+		return bound{m, ctx}
+	}
+	return m
+}
+
+// Contextual returns m as a ContextManager. If m doesn't implement
+// ContextManager, it's adapted so every operation checks the context
+// before it runs and is made by m bound to the context by WithContext,
+// and transactions whose context is done are rolled back. Reads whose
+// Manager methods don't return errors return the context error if the
+// context is done meanwhile, so it isn't reported as an unknown task.
+func Contextual(m Manager) ContextManager {
+	if cm, ok := m.(ContextManager); ok {
+		return cm
+	}
+	return contextual{m}
+}
+
+// contextual adapts a Manager to ContextManager.
+type contextual struct {
+	m Manager
+}
+
+func (c contextual) CreateContext(ctx context.Context, title string) (*Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return WithContext(ctx, c.m).Create(title)
+}
+
+func (c contextual) FindContext(ctx context.Context, id int) (*Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	t, ok := WithContext(ctx, c.m).Find(id)
+	switch {
+	case ctx.Err() != nil: // The bound Manager reports a done context as an unknown task.
+		return nil, ctx.Err()
+	case !ok:
+		return nil, ErrFindUnknown
+	}
+	return t, nil
+}
+
+func (c contextual) AllContext(ctx context.Context) ([]*Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tasks := WithContext(ctx, c.m).All()
+	return tasks, ctx.Err()
+}
+
+func (c contextual) UpdateContext(ctx context.Context, task *Task) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Update(task)
+}
+
+func (c contextual) DeleteContext(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Delete(id)
+}
+
+func (c contextual) CountContext(ctx context.Context) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	n := WithContext(ctx, c.m).Count()
+	return n, ctx.Err()
+}
+
+func (c contextual) TrashContext(ctx context.Context) ([]*Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	tasks := WithContext(ctx, c.m).Trash()
+	return tasks, ctx.Err()
+}
+
+func (c contextual) RestoreContext(ctx context.Context, id int) (*Task, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return WithContext(ctx, c.m).Restore(id)
+}
+
+func (c contextual) PurgeContext(ctx context.Context, id int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Purge(id)
+}
+
+func (c contextual) PurgeBeforeContext(ctx context.Context, t time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	return WithContext(ctx, c.m).PurgeBefore(t), nil
+}
+
+func (c contextual) TxContext(ctx context.Context, fn func(ctx context.Context, m ContextManager) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Tx(func(m Manager) error {
+		if err := fn(ctx, Contextual(m)); err != nil {
+			return err
+		}
+		return ctx.Err() // Roll back if the context is done meanwhile.
+	})
+}
+
+func (c contextual) FlushContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Flush()
+}
+
+func (c contextual) PingContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return WithContext(ctx, c.m).Ping()
+}
+
+// bound adapts a ContextManager to Manager by calling its operations with
+// ctx. The errors of the operations which don't return errors are dropped.
+type bound struct {
+	cm  ContextManager
+	ctx context.Context
+}
+
+func (b bound) Create(title string) (*Task, error) {
+	return b.cm.CreateContext(b.ctx, title)
+}
+
+func (b bound) Find(id int) (*Task, bool) {
+	t, err := b.cm.FindContext(b.ctx, id)
+	return t, err == nil
+}
+
+func (b bound) All() []*Task {
+	tasks, _ := b.cm.AllContext(b.ctx)
+	return tasks
+}
+
+func (b bound) Update(task *Task) error {
+	return b.cm.UpdateContext(b.ctx, task)
+}
+
+func (b bound) Delete(id int) error {
+	return b.cm.DeleteContext(b.ctx, id)
+}
+
+func (b bound) Count() int {
+	n, _ := b.cm.CountContext(b.ctx)
+	return n
+}
+
+func (b bound) Trash() []*Task {
+	tasks, _ := b.cm.TrashContext(b.ctx)
+	return tasks
+}
+
+func (b bound) Restore(id int) (*Task, error) {
+	return b.cm.RestoreContext(b.ctx, id)
+}
+
+func (b bound) Purge(id int) error {
+	return b.cm.PurgeContext(b.ctx, id)
+}
+
+func (b bound) PurgeBefore(t time.Time) int {
+	n, _ := b.cm.PurgeBeforeContext(b.ctx, t)
+	return n
+}
+
+func (b bound) Tx(fn func(m Manager) error) error {
+	return b.cm.TxContext(b.ctx, func(ctx context.Context, m ContextManager) error {
+		return fn(bound{m, ctx})
+	})
+}
+
+func (b bound) Flush() error {
+	return b.cm.FlushContext(b.ctx)
+}
+
+func (b bound) Ping() error {
+	return b.cm.PingContext(b.ctx)
+}
+
+// storage returns the stored tasks as a ContextManager.
+func storage() ContextManager {
+	return Contextual(tasks)
+}
+
+// isContextError reports whether err was caused by a done context.
+func isContextError(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
@@ -0,0 +1,268 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// nativeManager implements both Manager and ContextManager.
+type nativeManager struct {
+	Manager
+	ContextManager
+}
+
+func TestContextual(t *testing.T) {
+	native := &nativeManager{NewManager(), Contextual(NewManager())}
+	if got := Contextual(native); got != native {
+		t.Errorf("Contextual(ContextManager) = %v; want the ContextManager itself", got)
+	}
+
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	m.Delete(2)
+	cm := Contextual(m)
+	ctx := context.Background()
+	if task, err := cm.FindContext(ctx, 0); err != nil || task.Title != "Task 0" {
+		t.Errorf("FindContext(0) = %v, %v; want Task 0, <nil>", task, err)
+	}
+	if _, err := cm.FindContext(ctx, 2); err != ErrFindUnknown {
+		t.Errorf("FindContext(2): got error %v; want %v", err, ErrFindUnknown)
+	}
+	if n, err := cm.CountContext(ctx); err != nil || n != 2 {
+		t.Errorf("CountContext() = %d, %v; want 2, <nil>", n, err)
+	}
+}
+
+func TestContextualCanceled(t *testing.T) {
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	m.Delete(2)
+	cm := Contextual(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for name, fn := range map[string]func() error{
+		"CreateContext":      func() error { _, err := cm.CreateContext(ctx, "Task 3"); return err },
+		"FindContext":        func() error { _, err := cm.FindContext(ctx, 0); return err },
+		"AllContext":         func() error { _, err := cm.AllContext(ctx); return err },
+		"UpdateContext":      func() error { return cm.UpdateContext(ctx, &Task{ID: 0, Title: "Updated"}) },
+		"DeleteContext":      func() error { return cm.DeleteContext(ctx, 0) },
+		"CountContext":       func() error { _, err := cm.CountContext(ctx); return err },
+		"TrashContext":       func() error { _, err := cm.TrashContext(ctx); return err },
+		"RestoreContext":     func() error { _, err := cm.RestoreContext(ctx, 2); return err },
+		"PurgeContext":       func() error { return cm.PurgeContext(ctx, 2) },
+		"PurgeBeforeContext": func() error { _, err := cm.PurgeBeforeContext(ctx, time.Now().Add(time.Hour)); return err },
+		"FlushContext":       func() error { return cm.FlushContext(ctx) },
+		"PingContext":        func() error { return cm.PingContext(ctx) },
+		"TxContext": func() error {
+			return cm.TxContext(ctx, func(ctx context.Context, m ContextManager) error { return nil })
+		},
+	} {
+		if err := fn(); err != context.Canceled {
+			t.Errorf("%s with canceled context: got error %v; want %v", name, err, context.Canceled)
+		}
+	}
+	if got, want := ptrToVal(m.All()), testTasks[:2]; !reflect.DeepEqual(got, want) {
+		t.Errorf("canceled operations changed the tasks to %v; want %v", got, want)
+	}
+	if len(m.Trash()) != 1 {
+		t.Errorf("canceled operations changed the trash to %v", m.Trash())
+	}
+}
+
+func TestContextualTxCanceled(t *testing.T) {
+	m := NewManager()
+	cm := Contextual(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cm.TxContext(ctx, func(ctx context.Context, tx ContextManager) error {
+		if _, err := tx.CreateContext(ctx, "Task 0"); err != nil {
+			return err
+		}
+		cancel() // The client went away in the middle of the transaction.
+		_, err := tx.CreateContext(ctx, "Task 1")
+		return err
+	})
+	if err != context.Canceled {
+		t.Errorf("TxContext canceled within fn: got error %v; want %v", err, context.Canceled)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	err = cm.TxContext(ctx, func(ctx context.Context, tx ContextManager) error {
+		_, err := tx.CreateContext(ctx, "Task 0")
+		cancel() // Canceled after the last operation.
+		return err
+	})
+	if err != context.Canceled {
+		t.Errorf("TxContext canceled before commit: got error %v; want %v", err, context.Canceled)
+	}
+	if n := m.Count(); n != 0 {
+		t.Errorf("canceled transactions were applied: got %d tasks; want 0", n)
+	}
+}
+
+// ctxKey is the key of a value carried by the contexts in the tests.
+type ctxKey struct{}
+
+// ctxRecorder is a ContextManager recording the values of ctxKey
+// carried by the contexts of its updates.
+type ctxRecorder struct {
+	Manager
+	ContextManager
+	values []interface{}
+}
+
+func (m *ctxRecorder) UpdateContext(ctx context.Context, task *Task) error {
+	m.values = append(m.values, ctx.Value(ctxKey{}))
+	return m.ContextManager.UpdateContext(ctx, task)
+}
+
+func TestWithContextMiddlewares(t *testing.T) {
+	s := NewManager()
+	native := &ctxRecorder{Manager: s, ContextManager: Contextual(s)}
+	m := Wrap(native, Cache(), Logging(slog.New(slog.NewTextHandler(io.Discard, nil))), Hook(Hooks{}), Validate(DefaultRules))
+	if _, err := m.Create("Task 0"); err != nil {
+		t.Fatalf("Create(...): unexpected error: %v", err)
+	}
+
+	cm := Contextual(m)
+	ctx := context.WithValue(context.Background(), ctxKey{}, "request")
+	if err := cm.UpdateContext(ctx, &Task{ID: 0, Title: "Updated"}); err != nil {
+		t.Errorf("UpdateContext(...): unexpected error: %v", err)
+	}
+	err := cm.TxContext(ctx, func(ctx context.Context, tx ContextManager) error {
+		return tx.UpdateContext(ctx, &Task{ID: 0, Title: "Updated again"})
+	})
+	if err != nil {
+		t.Errorf("TxContext(...): unexpected error: %v", err)
+	}
+	if want := []interface{}{"request"}; !reflect.DeepEqual(native.values, want) {
+		t.Errorf("the native ContextManager got context values %v; want %v", native.values, want)
+	}
+	if task, _ := m.Find(0); task.Title != "Updated again" {
+		t.Errorf("Find(0) = %v; want the updated task", task)
+	}
+}
+
+// cancelingManager is a ContextManager whose reads cancel
+// their context before they return its error, if cancel is set.
+type cancelingManager struct {
+	Manager
+	ContextManager
+	cancel context.CancelFunc
+}
+
+func (m *cancelingManager) FindContext(ctx context.Context, id int) (*Task, error) {
+	if m.cancel == nil {
+		return m.ContextManager.FindContext(ctx, id)
+	}
+	m.cancel()
+	return nil, ctx.Err()
+}
+
+func (m *cancelingManager) AllContext(ctx context.Context) ([]*Task, error) {
+	m.cancel()
+	return nil, ctx.Err()
+}
+
+func TestContextualDoneRead(t *testing.T) {
+	s := NewManager()
+	s.Create("Task 0")
+	native := &cancelingManager{Manager: s, ContextManager: Contextual(s)}
+	cm := Contextual(Wrap(native, Logging(slog.New(slog.NewTextHandler(io.Discard, nil))), Validate(DefaultRules)))
+
+	var ctx context.Context
+	ctx, native.cancel = context.WithCancel(context.Background())
+	if _, err := cm.FindContext(ctx, 0); err != context.Canceled {
+		t.Errorf("FindContext(...) canceled meanwhile: got error %v; want %v", err, context.Canceled)
+	}
+	ctx, native.cancel = context.WithCancel(context.Background())
+	if _, err := cm.AllContext(ctx); err != context.Canceled {
+		t.Errorf("AllContext(...) canceled meanwhile: got error %v; want %v", err, context.Canceled)
+	}
+	native.cancel = nil
+	if _, err := cm.FindContext(context.Background(), 1); err != ErrFindUnknown {
+		t.Errorf("FindContext(...) of unknown task: got error %v; want %v", err, ErrFindUnknown)
+	}
+}
+
+func TestFileManagerContext(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	m, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	bm := WithContext(ctx, Wrap(m, Logging(slog.New(slog.NewTextHandler(io.Discard, nil))), Validate(DefaultRules)))
+	if _, err := bm.Create("Task 0"); err != context.Canceled {
+		t.Errorf("Create(...) with canceled context: got error %v; want %v", err, context.Canceled)
+	}
+	err = WithContext(context.Background(), m).Tx(func(tx Manager) error {
+		_, err := tx.Create("Task 0")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Tx(...) with background context: unexpected error: %v", err)
+	}
+	if err := bm.Ping(); err != context.Canceled {
+		t.Errorf("Ping() with canceled context: got error %v; want %v", err, context.Canceled)
+	}
+
+	r, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	if got := ptrToVal(r.All()); !reflect.DeepEqual(got, []Task{{ID: 0, Title: "Task 0"}}) {
+		t.Errorf("saved tasks = %v; want only Task 0", got)
+	}
+}
+
+func TestCanceledReq(t *testing.T) {
+	tasks = NewManager()
+	if err := addTasks(tasks, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		method, path, body string
+	}{
+		{"GET", Path, ""},
+		{"GET", Path + "0", ""},
+		{"POST", Path, `{"title":"Task 3"}`},
+		{"PUT", Path + "0", `{"id":0,"title":"Updated Task 0"}`},
+		{"DELETE", Path + "0", ""},
+		{"POST", BulkPath, `{"operations":[{"op":"create","title":"Task 3"},{"op":"delete","id":1}]}`},
+	} {
+		req, err := http.NewRequestWithContext(ctx, test.method, test.path, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusServiceUnavailable); err != nil {
+			t.Errorf("%s %s with canceled context: %v\nRecieve body: %q", test.method, test.path, err, rec.Body)
+		}
+	}
+	if got, want := ptrToVal(tasks.All()), testTasks[:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("canceled requests changed the tasks to %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// dateLayout is the layout of the dates of all-day tasks.
+const dateLayout = "2006-01-02"
+
+// locations caches the time zones loaded by loadLocation by their names.
+var locations sync.Map
+
+// loadLocation returns the time zone with the given name like
+// time.LoadLocation, but reads the time zone database only once
+// for each known name.
+func loadLocation(name string) (*time.Location, error) {
+	if loc, ok := locations.Load(name); ok {
+		return loc.(*time.Location), nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// Location returns the time zone of the task, or UTC
+// if the task has no time zone or it is unknown.
+func (t *Task) Location() *time.Location {
+	if t.TimeZone == "" {
+		return time.UTC
+	}
+	loc, err := loadLocation(t.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// Time returns the date of the task in its time zone.
+// The zero Time is returned if the task isn't scheduled.
+func (t *Task) Time() time.Time {
+	if t.Date == 0 {
+		return time.Time{}
+	}
+	return time.Unix(t.Date, 0).In(t.Location())
+}
+
+// day returns the midnight in loc of the day of the all-day task.
+func (t *Task) day(loc *time.Location) time.Time {
+	y, m, d := t.Time().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// jsonTask is the JSON form of Task with a date in any of the accepted
+// forms, and with the date in the RFC 3339 format and the fields derived
+// from the note, which are only written.
+type jsonTask struct {
+	*plainTask
+	Date       json.RawMessage `json:"date"`
+	DateString string          `json:"dateString,omitempty"`
+	noteFields
+}
+
+// plainTask is Task without the JSON methods.
+type plainTask Task
+
+// MarshalJSON implements json.Marshaler. The date is written as Unix time
+// in seconds, and as dateString in the RFC 3339 format in the time zone of
+// the task, or without the time if the task is all-day. The dateString of
+// a task which isn't scheduled is omitted. The fields derived from the
+// note are written by noteFieldsOf.
+func (t Task) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.toJSON())
+}
+
+// toJSON returns the JSON form of the task.
+func (t *Task) toJSON() jsonTask {
+	j := jsonTask{plainTask: (*plainTask)(t), Date: json.RawMessage(strconv.FormatInt(t.Date, 10))}
+	switch {
+	case t.Date == 0:
+	case t.AllDay:
+		j.DateString = t.Time().Format(dateLayout)
+	default:
+		j.DateString = t.Time().Format(time.RFC3339)
+	}
+	j.noteFields = noteFieldsOf(t.Note)
+	return j
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The date may be given in the
+// RFC 3339 format, as a day of the year like "2006-01-02" in the time zone
+// of the task, or in the integer form as Unix time in seconds. Integers
+// after the end of the year 9999 in seconds, which is the latest valid
+// date, can't be seconds, so they're taken as Unix time in milliseconds.
+// The date of an all-day task is moved to the midnight in its time zone.
+// The dateString is only written, so it's ignored.
+func (t *Task) UnmarshalJSON(b []byte) error {
+	var j jsonTask
+	j.plainTask = (*plainTask)(t)
+	if err := json.Unmarshal(b, &j); err != nil {
+		return err
+	}
+	var err error
+	if t.Date, err = parseDate(j.Date, t.Location()); err != nil {
+		return err
+	}
+	if t.AllDay && t.Date != 0 {
+		t.Date = t.day(t.Location()).Unix()
+	}
+	return nil
+}
+
+// parseDate parses the JSON date b as the Unix time in seconds.
+// The days without the time are taken in loc.
+func parseDate(b json.RawMessage, loc *time.Location) (int64, error) {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 || string(b) == "null" || string(b) == `""` {
+		return 0, nil
+	}
+	if b[0] != '"' {
+		var n int64
+		if err := json.Unmarshal(b, &n); err != nil {
+			return 0, fmt.Errorf("date: %v", err)
+		}
+		if n > maxDate { // Milliseconds; see UnmarshalJSON.
+			n /= 1000
+		}
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return 0, fmt.Errorf("date: %v", err)
+	}
+	if d, err := time.ParseInLocation(dateLayout, s, loc); err == nil {
+		return d.Unix(), nil
+	}
+	d, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return 0, fmt.Errorf("date: %q isn't in the RFC 3339 format", s)
+	}
+	return d.Unix(), nil
+}
+
+// dateFilters are the filters whose result depends on
+// the current time in the time zone of the user.
+var dateFilters = map[string]func(now time.Time) Filter{
+	"today": func(now time.Time) Filter {
+		start := midnight(now)
+		return func(t *Task) bool { return t.Date != 0 && within(t, start, start.AddDate(0, 0, 1)) }
+	},
+	"overdue": func(now time.Time) Filter {
+		start := midnight(now)
+		return func(t *Task) bool {
+			if t.Done || t.Date == 0 {
+				return false
+			}
+			if t.AllDay {
+				return t.day(now.Location()).Before(start)
+			}
+			return t.Date < now.Unix()
+		}
+	},
+	"thisWeek": func(now time.Time) Filter {
+		start := midnight(now)
+		start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7) // Weeks start on Monday.
+		return func(t *Task) bool { return t.Date != 0 && within(t, start, start.AddDate(0, 0, 7)) }
+	},
+}
+
+// Overdue returns the filter of the not done tasks scheduled before now.
+// All-day tasks are overdue after their day ends in the location of now.
+func Overdue(now time.Time) Filter {
+	return dateFilters["overdue"](now)
+}
+
+// midnight returns the start of the day of t in its location.
+func midnight(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// within reports whether the task is scheduled within [start, end).
+// An all-day task is within if its day starts within in the location of start.
+func within(t *Task, start, end time.Time) bool {
+	d := time.Unix(t.Date, 0)
+	if t.AllDay {
+		d = t.day(start.Location())
+	}
+	return !d.Before(start) && d.Before(end)
+}
+
+// location returns the time zone of the user given by
+// the tz query parameter of the request, or UTC.
+func location(r *http.Request) (*time.Location, error) {
+	tz := r.URL.Query().Get("tz")
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := loadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q", tz)
+	}
+	return loc, nil
+}
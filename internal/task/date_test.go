@@ -0,0 +1,180 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalDate(t *testing.T) {
+	for _, test := range []struct {
+		task Task
+		date string
+	}{
+		{Task{Title: "Task 0"}, `"date":0}`},
+		{Task{Title: "Task 0", Date: 1426691590}, `"date":1426691590,"dateString":"2015-03-18T15:13:10Z"`},
+		{Task{Title: "Task 0", Date: 1426691590, TimeZone: "Europe/Bratislava"}, `"date":1426691590,"dateString":"2015-03-18T16:13:10+01:00"`},
+		{Task{Title: "Task 0", Date: 1426651200, TimeZone: "America/New_York", AllDay: true}, `"date":1426651200,"dateString":"2015-03-18"`},
+	} {
+		b, err := json.Marshal(&test.task)
+		if err != nil {
+			t.Errorf("Marshal(%v): unexpected error: %v", test.task, err)
+			continue
+		}
+		if !strings.Contains(string(b), test.date) {
+			t.Errorf("Marshal(%v) = %s; want %s", test.task, b, test.date)
+		}
+		var got Task
+		if err := json.Unmarshal(b, &got); err != nil || !reflect.DeepEqual(got, test.task) {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v, <nil>", b, got, err, test.task)
+		}
+	}
+}
+
+func TestUnmarshalDate(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		date int64
+		ok   bool
+	}{
+		{`{"title":"Task 0"}`, 0, true},
+		{`{"date":null}`, 0, true},
+		{`{"date":0}`, 0, true},
+		{`{"date":""}`, 0, true},
+		{`{"date":1426691590}`, 1426691590, true},
+		{`{"date":1426691590000}`, 1426691590, true},
+		{`{"date":253402300799}`, maxDate, true},                            // The latest date in seconds.
+		{`{"date":253402300800}`, 253402300, true},                          // Milliseconds after it.
+		{`{"date":1426691590,"dateString":"2000-01-01"}`, 1426691590, true}, // Only written.
+		{`{"date":"2015-03-18T16:13:10+01:00"}`, 1426691590, true},
+		{`{"date":"2015-03-18T15:13:10.5Z"}`, 1426691590, true},
+		{`{"date":"2015-03-18"}`, 1426636800, true},
+		{`{"date":"2015-03-18","timeZone":"America/New_York"}`, 1426651200, true},
+		{`{"timeZone":"America/New_York","allDay":true,"date":"2015-03-18T23:30:00-04:00"}`, 1426651200, true},
+		{`{"allDay":true,"date":1426691590}`, 1426636800, true},
+		{`{"date":"tomorrow"}`, 0, false},
+		{`{"date":"18.03.2015"}`, 0, false},
+		{`{"date":true}`, 0, false},
+	} {
+		var got Task
+		err := json.Unmarshal([]byte(test.in), &got)
+		if (err == nil) != test.ok {
+			t.Errorf("Unmarshal(%s): got error %v; want error: %t", test.in, err, !test.ok)
+			continue
+		}
+		if err == nil && got.Date != test.date {
+			t.Errorf("Unmarshal(%s): got date %d; want %d", test.in, got.Date, test.date)
+		}
+	}
+}
+
+func TestDateFilters(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) } // Wed 2015-03-18T15:13:10Z.
+
+	date := func(s string) int64 {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d.Unix()
+	}
+	tasks = NewManager()
+	if err := addTasks(tasks, []Task{
+		{ID: 0, Title: "A", Date: date("2015-03-18T10:00:00Z")},
+		{ID: 1, Title: "B", Date: date("2015-03-19T02:00:00Z")},
+		{ID: 2, Title: "C", Date: date("2015-03-17T00:00:00Z"), AllDay: true},
+		{ID: 3, Title: "D", Date: date("2015-03-18T00:00:00Z"), AllDay: true},
+		{ID: 4, Title: "E", Date: date("2015-03-23T08:00:00Z")},
+		{ID: 5, Title: "F", Date: date("2015-03-16T06:00:00Z")},
+		{ID: 6, Title: "G", Date: date("2015-03-17T12:00:00Z"), Done: true},
+		{ID: 7, Title: "H"},
+	}, t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	for _, test := range []struct {
+		query string
+		want  string
+	}{
+		{"filter=today", "AD"},
+		{"filter=today&tz=America/Los_Angeles", "ABD"},
+		{"filter=overdue", "ACF"},
+		{"filter=overdue&tz=America/Los_Angeles", "ACF"},
+		{"filter=overdue&tz=Pacific/Kiritimati", "ACDF"}, // It's already March 19 there.
+		{"filter=thisWeek", "ABCDFG"},
+		{"filter=thisWeek&tz=America/Los_Angeles", "ABCDG"},
+	} {
+		req, err := http.NewRequest("GET", Path+"?"+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("GET %s?%s: %v\nRecieve body: %q", Path, test.query, err, rec.Body)
+			continue
+		}
+		var res struct {
+			Tasks []*Task `json:"tasks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("GET %s?%s: cannot decode the response: %v", Path, test.query, err)
+		}
+		var got string
+		for _, t := range res.Tasks {
+			got += t.Title
+		}
+		if got != test.want {
+			t.Errorf("GET %s?%s: got tasks %s; want %s", Path, test.query, got, test.want)
+		}
+	}
+
+	req, err := http.NewRequest("GET", Path+"?filter=today&tz=Mars/Olympus_Mons", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusBadRequest); err != nil {
+		t.Errorf("GET with unknown time zone: %v\nRecieve body: %q", err, rec.Body)
+	}
+}
+
+func TestTaskTime(t *testing.T) {
+	task := Task{Date: 1426691590, TimeZone: "Europe/Bratislava"}
+	want := time.Date(2015, 3, 18, 16, 13, 10, 0, task.Location())
+	if got := task.Time(); !got.Equal(want) || got.Location().String() != "Europe/Bratislava" {
+		t.Errorf("Time() = %v; want %v", got, want)
+	}
+	if got := (&Task{TimeZone: "Unknown/Zone"}).Location(); got != time.UTC {
+		t.Errorf("Location() of unknown time zone = %v; want UTC", got)
+	}
+	if got := (&Task{}).Time(); !reflect.DeepEqual(got, time.Time{}) {
+		t.Errorf("Time() of unscheduled task = %v; want zero Time", got)
+	}
+}
+
+func TestLoadLocation(t *testing.T) {
+	first, err := loadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("loadLocation(%q): unexpected error: %v", "America/New_York", err)
+	}
+	if got, _ := loadLocation("America/New_York"); got != first {
+		t.Errorf("loadLocation(%q) loaded the time zone again", "America/New_York")
+	}
+	if _, err := loadLocation("Unknown/Zone"); err == nil {
+		t.Errorf("loadLocation(%q): expected error", "Unknown/Zone")
+	}
+	if _, ok := locations.Load("Unknown/Zone"); ok {
+		t.Errorf("loadLocation(%q) cached an unknown time zone", "Unknown/Zone")
+	}
+}
@@ -0,0 +1,692 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DAVPath specifies the path of the CalDAV resources. It is the
+// principal of the user and the home of its calendar collection.
+const DAVPath = "/dav/"
+
+// DAVCalendarPath specifies the path of the calendar collection
+// whose members are the tasks named by their UIDs, like <UID>.ics.
+const DAVCalendarPath = DAVPath + "tasks/"
+
+// maxDAVBodySize is the maximum size of the body of a CalDAV request.
+const maxDAVBodySize = 1 << 20
+
+// XML namespaces of the CalDAV properties.
+const (
+	nsDAV    = "DAV:"
+	nsCalDAV = "urn:ietf:params:xml:ns:caldav"
+	nsCS     = "http://calendarserver.org/ns/"
+)
+
+// davPrefixes maps the XML namespaces to the prefixes used in the responses.
+var davPrefixes = map[string]string{nsDAV: "d", nsCalDAV: "c", nsCS: "cs"}
+
+// errPreconditionFailed indicates that the ETag of a task resource
+// doesn't match the If-Match or If-None-Match request header.
+var errPreconditionFailed = &errRequest{errors.New("resource changed"), http.StatusPreconditionFailed}
+
+// Names of the CalDAV properties.
+var (
+	propResourceType = xml.Name{Space: nsDAV, Local: "resourcetype"}
+	propDisplayName  = xml.Name{Space: nsDAV, Local: "displayname"}
+	propETag         = xml.Name{Space: nsDAV, Local: "getetag"}
+	propContentType  = xml.Name{Space: nsDAV, Local: "getcontenttype"}
+	propPrincipal    = xml.Name{Space: nsDAV, Local: "current-user-principal"}
+	propPrincipalURL = xml.Name{Space: nsDAV, Local: "principal-URL"}
+	propReportSet    = xml.Name{Space: nsDAV, Local: "supported-report-set"}
+	propSyncToken    = xml.Name{Space: nsDAV, Local: "sync-token"}
+	propCTag         = xml.Name{Space: nsCS, Local: "getctag"}
+	propHomeSet      = xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}
+	propComponentSet = xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}
+	propCalendarData = xml.Name{Space: nsCalDAV, Local: "calendar-data"}
+)
+
+// defaultDAVProps are the properties requested by default.
+var defaultDAVProps = []xml.Name{propResourceType, propDisplayName, propETag, propContentType}
+
+// Names of the supported reports.
+var (
+	reportQuery    = xml.Name{Space: nsCalDAV, Local: "calendar-query"}
+	reportMultiget = xml.Name{Space: nsCalDAV, Local: "calendar-multiget"}
+	reportSync     = xml.Name{Space: nsDAV, Local: "sync-collection"}
+	davReports     = map[xml.Name]bool{reportQuery: true, reportMultiget: true, reportSync: true}
+)
+
+// davCalendarContent is the content type of the task resources.
+const davCalendarContent = "text/calendar; charset=utf-8; component=VTODO"
+
+// davResource is a resource served to the CalDAV clients.
+type davResource struct {
+	href     string
+	calendar bool   // The calendar collection.
+	token    string // Sync token of the calendar collection.
+	task     *Task  // Task of the task resource, nil for the collections.
+	body     string // iCalendar object of the task.
+	etag     string
+}
+
+// newDAVTask returns the resource of the task. Its DTSTAMP is the
+// creation time of the task, so the iCalendar object and its ETag
+// depend only on the task and change only together with it.
+func newDAVTask(t *Task) *davResource {
+	body := icalBegin + FormatICal(t, "VTODO", time.Unix(t.Created, 0)) + icalEnd
+	sum := sha256.Sum256([]byte(body))
+	return &davResource{href: davHref(t), task: t, body: body, etag: fmt.Sprintf(`"%x"`, sum[:12])}
+}
+
+// davHref returns the path of the resource of the task.
+func davHref(t *Task) string {
+	return DAVCalendarPath + url.PathEscape(CalendarUID(t)) + ".ics"
+}
+
+// prop returns the XML value of the property of the resource,
+// or false if the resource doesn't have the property.
+func (res *davResource) prop(name xml.Name) (string, bool) {
+	home := "<d:href>" + DAVPath + "</d:href>"
+	switch name {
+	case propResourceType:
+		switch {
+		case res.task != nil:
+			return "", true
+		case res.calendar:
+			return "<d:collection/><c:calendar/>", true
+		}
+		return "<d:collection/><d:principal/>", true
+	case propDisplayName:
+		switch {
+		case res.task != nil:
+			return xmlEscape(res.task.Title), true
+		case res.calendar:
+			return "Tasks", true
+		}
+		return "todo", true
+	case propPrincipal, propPrincipalURL:
+		return home, true
+	case propHomeSet:
+		return home, res.task == nil && !res.calendar
+	case propComponentSet:
+		return `<c:comp name="VTODO"/>`, res.calendar
+	case propReportSet:
+		var b strings.Builder
+		for _, n := range []xml.Name{reportQuery, reportMultiget, reportSync} {
+			b.WriteString("<d:supported-report><d:report>" + davElement(n, "") + "</d:report></d:supported-report>")
+		}
+		return b.String(), res.calendar
+	case propSyncToken, propCTag:
+		return xmlEscape(res.token), res.calendar
+	case propETag:
+		return xmlEscape(res.etag), res.task != nil
+	case propContentType:
+		return davCalendarContent, res.task != nil
+	case propCalendarData:
+		return xmlEscape(res.body), res.task != nil
+	}
+	return "", false
+}
+
+// xmlEscape returns s escaped for the XML text.
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// davElement returns the XML element with given name and inner XML.
+func davElement(name xml.Name, inner string) string {
+	p, ok := davPrefixes[name.Space]
+	if !ok {
+		ns := xmlEscape(name.Space)
+		if inner == "" {
+			return `<x:` + name.Local + ` xmlns:x="` + ns + `"/>`
+		}
+		return `<x:` + name.Local + ` xmlns:x="` + ns + `">` + inner + `</x:` + name.Local + `>`
+	}
+	if inner == "" {
+		return "<" + p + ":" + name.Local + "/>"
+	}
+	return "<" + p + ":" + name.Local + ">" + inner + "</" + p + ":" + name.Local + ">"
+}
+
+// multistatus builds the body of a WebDAV multi-status response.
+type multistatus struct {
+	b strings.Builder
+}
+
+// props adds the response with the properties of the resource.
+func (ms *multistatus) props(res *davResource, names []xml.Name) {
+	var found, missing strings.Builder
+	for _, n := range names {
+		if v, ok := res.prop(n); ok {
+			found.WriteString(davElement(n, v))
+		} else {
+			missing.WriteString(davElement(n, ""))
+		}
+	}
+	ms.b.WriteString("<d:response><d:href>" + xmlEscape(res.href) + "</d:href>")
+	if found.Len() > 0 {
+		ms.b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop><d:status>HTTP/1.1 200 OK</d:status></d:propstat>")
+	}
+	if missing.Len() > 0 {
+		ms.b.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop><d:status>HTTP/1.1 404 Not Found</d:status></d:propstat>")
+	}
+	ms.b.WriteString("</d:response>")
+}
+
+// notFound adds the response reporting that the resource doesn't exist.
+func (ms *multistatus) notFound(href string) {
+	ms.b.WriteString("<d:response><d:href>" + xmlEscape(href) + "</d:href><d:status>HTTP/1.1 404 Not Found</d:status></d:response>")
+}
+
+// write writes the response with the multi-status body ended by extra.
+func (ms *multistatus) write(w http.ResponseWriter, extra string) error {
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.WriteHeader(http.StatusMultiStatus)
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+		`<d:multistatus xmlns:d="DAV:" xmlns:c="%s" xmlns:cs="%s">%s%s</d:multistatus>`+"\n",
+		nsCalDAV, nsCS, ms.b.String(), extra)
+	return err
+}
+
+// davAny is an XML element of any name.
+type davAny struct {
+	XMLName xml.Name
+}
+
+// davReq is the body of the PROPFIND and REPORT requests.
+type davReq struct {
+	XMLName xml.Name
+	AllProp *struct{} `xml:"DAV: allprop"`
+	Prop    *struct {
+		Names []davAny `xml:",any"`
+	} `xml:"DAV: prop"`
+	Hrefs     []string       `xml:"DAV: href"`
+	SyncToken string         `xml:"DAV: sync-token"`
+	Filter    *davCompFilter `xml:"urn:ietf:params:xml:ns:caldav filter>comp-filter"`
+}
+
+// props returns the names of the requested properties.
+// All properties except the calendar data are requested by default.
+func (req *davReq) props() []xml.Name {
+	if req.Prop == nil || req.AllProp != nil {
+		return defaultDAVProps
+	}
+	var names []xml.Name
+	for _, n := range req.Prop.Names {
+		names = append(names, n.XMLName)
+	}
+	return names
+}
+
+// davCompFilter is the CalDAV filter of the calendar components.
+type davCompFilter struct {
+	Name      string          `xml:"name,attr"`
+	TimeRange *davTimeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	Comps     []davCompFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// davTimeRange is the CalDAV time range with the bounds in UTC.
+type davTimeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+// matches reports whether the VCALENDAR of the task matches the filter.
+// The unscheduled tasks match every time range.
+func (f *davCompFilter) matches(t *Task) (bool, error) {
+	if f.Name != "VCALENDAR" {
+		return false, nil
+	}
+	for _, c := range f.Comps {
+		if c.Name != "VTODO" {
+			return false, nil
+		}
+		if c.TimeRange == nil || t.Date == 0 {
+			continue
+		}
+		for _, b := range []struct {
+			v     string
+			after bool
+		}{{c.TimeRange.Start, true}, {c.TimeRange.End, false}} {
+			if b.v == "" {
+				continue
+			}
+			d, err := time.Parse(icalDateTime, b.v)
+			if err != nil {
+				return false, fmt.Errorf("time-range: %q isn't a UTC date-time", b.v)
+			}
+			if b.after && t.Date < d.Unix() || !b.after && t.Date >= d.Unix() {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+// decodeDAVReq decodes davReq from the request body.
+// An empty body is decoded as a request for all properties.
+func decodeDAVReq(r *http.Request) (*davReq, error) {
+	body, err := readDAVBody(r)
+	if err != nil {
+		return nil, err
+	}
+	req := new(davReq)
+	if len(bytes.TrimSpace(body)) == 0 {
+		return req, nil
+	}
+	if err := xml.Unmarshal(body, req); err != nil {
+		return nil, badRequestError(err)
+	}
+	return req, nil
+}
+
+// readDAVBody reads the request body up to maxDAVBodySize.
+func readDAVBody(r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxDAVBodySize+1))
+	if err != nil {
+		return nil, badRequestError(err)
+	}
+	if len(body) > maxDAVBodySize {
+		return nil, &errRequest{fmt.Errorf("request body is larger than %d bytes", maxDAVBodySize), http.StatusRequestEntityTooLarge}
+	}
+	return body, nil
+}
+
+// syncToken returns the sync token of the calendar collection after
+// the revision rev. Tokens of the other histories aren't valid, so
+// the clients resynchronize after the restart of the server.
+func syncToken(rev int) string {
+	return fmt.Sprintf("urn:todo:sync:%d:%d", revisions.epoch, rev)
+}
+
+// parseSyncToken returns the revision of the sync token.
+// The empty token is the revision before all changes.
+func parseSyncToken(token string) (int, bool) {
+	if token == "" {
+		return 0, true
+	}
+	epoch, rev, ok := strings.Cut(strings.TrimPrefix(token, "urn:todo:sync:"), ":")
+	n, err := strconv.Atoi(rev)
+	_, seq := revisions.since(n)
+	return n, ok && epoch == strconv.FormatInt(revisions.epoch, 10) && err == nil && n >= 0 && n <= seq
+}
+
+// DAVAPI is a handler function that serves the tasks as VTODO resources
+// to the CalDAV clients. It implements the subset of CalDAV needed for
+// the synchronization: PROPFIND, the calendar-query, calendar-multiget
+// and sync-collection REPORTs, and GET, PUT and DELETE of the tasks with
+// the ETag preconditions. The sync-collection reports the changes of the
+// tasks recorded in their history; the changes of sharing are found only
+// by the full synchronization.
+func DAVAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case "OPTIONS":
+		w.Header().Set("Allow", "OPTIONS, PROPFIND, REPORT, GET, HEAD, PUT, DELETE")
+		w.Header().Set("DAV", "1, 3, calendar-access")
+	case "PROPFIND":
+		err = propfind(w, r)
+	case "REPORT":
+		err = report(w, r)
+	case "GET", "HEAD":
+		err = davRead(w, r)
+	case "PUT":
+		err = davPut(w, r)
+	case "DELETE":
+		err = davRemove(w, r)
+	default:
+		err = &errRequest{fmt.Errorf("%s doesn't implemented", r.Method), http.StatusMethodNotAllowed}
+	}
+	errorHandler(w, r, err)
+}
+
+// davTasks returns the tasks visible to the request.
+func davTasks(ctx context.Context, m ContextManager, r *http.Request) ([]*Task, error) {
+	all, err := m.AllContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return visible(r, RoleViewer).Tasks(all), nil
+}
+
+// davFind returns the task of the task resource requested by r.
+func davFind(ctx context.Context, m ContextManager, r *http.Request) (*Task, error) {
+	name, ok := davName(r.URL.Path)
+	if !ok {
+		return nil, ErrFindUnknown
+	}
+	tasks, err := davTasks(ctx, m, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range tasks {
+		if CalendarUID(t) == name {
+			return t, nil
+		}
+	}
+	return nil, ErrFindUnknown
+}
+
+// davName returns the name of the task resource at the path, which
+// is its UID, or false if the path isn't the one of a task resource.
+func davName(path string) (string, bool) {
+	name := strings.TrimPrefix(path, DAVCalendarPath)
+	if name == path || !strings.HasSuffix(name, ".ics") || strings.Contains(name, "/") {
+		return "", false
+	}
+	return strings.TrimSuffix(name, ".ics"), true
+}
+
+// calendar returns the calendar collection.
+func calendar() *davResource {
+	_, seq := revisions.since(0)
+	return &davResource{href: DAVCalendarPath, calendar: true, token: syncToken(seq)}
+}
+
+// propfind handles requests for the properties of the CalDAV resources.
+// Depth other than 0 is taken as 1.
+func propfind(w http.ResponseWriter, r *http.Request) error {
+	req, err := decodeDAVReq(r)
+	if err != nil {
+		return err
+	}
+	depth := r.Header.Get("Depth") != "0"
+	ctx := r.Context()
+	var ms multistatus
+	switch r.URL.Path {
+	case DAVPath:
+		ms.props(&davResource{href: DAVPath}, req.props())
+		if depth {
+			ms.props(calendar(), req.props())
+		}
+	case DAVCalendarPath:
+		ms.props(calendar(), req.props())
+		if !depth {
+			break
+		}
+		tasks, err := davTasks(ctx, storage(), r)
+		if err != nil {
+			return err
+		}
+		for _, t := range tasks {
+			ms.props(newDAVTask(t), req.props())
+		}
+	default:
+		t, err := davFind(ctx, storage(), r)
+		if err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("%s doesn't exists", r.URL.Path))
+		}
+		if err != nil {
+			return err
+		}
+		ms.props(newDAVTask(t), req.props())
+	}
+	return ms.write(w, "")
+}
+
+// report handles the REPORT requests of the calendar collection.
+func report(w http.ResponseWriter, r *http.Request) error {
+	if r.URL.Path != DAVCalendarPath {
+		return &errRequest{fmt.Errorf("%s doesn't support reports", r.URL.Path), http.StatusForbidden}
+	}
+	req, err := decodeDAVReq(r)
+	if err != nil {
+		return err
+	}
+	if !davReports[req.XMLName] {
+		return &errRequest{fmt.Errorf("unsupported report %s", req.XMLName.Local), http.StatusForbidden}
+	}
+	ctx := r.Context()
+	var seq int
+	var revs []*Revision
+	if req.XMLName == reportSync {
+		rev, ok := parseSyncToken(req.SyncToken)
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+			w.WriteHeader(http.StatusForbidden)
+			_, err := io.WriteString(w, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+`<d:error xmlns:d="DAV:"><d:valid-sync-token/></d:error>`+"\n")
+			return err
+		}
+		revs, seq = revisions.since(rev)
+	}
+	tasks, err := davTasks(ctx, storage(), r)
+	if err != nil {
+		return err
+	}
+
+	var ms multistatus
+	switch req.XMLName {
+	case reportQuery:
+		if req.Filter == nil {
+			return badRequestError(fmt.Errorf("missing filter"))
+		}
+		for _, t := range tasks {
+			ok, err := req.Filter.matches(t)
+			if err != nil {
+				return badRequestError(err)
+			}
+			if ok {
+				ms.props(newDAVTask(t), req.props())
+			}
+		}
+	case reportMultiget:
+		byName := make(map[string]*Task)
+		for _, t := range tasks {
+			byName[CalendarUID(t)] = t
+		}
+		for _, href := range req.Hrefs {
+			u, err := url.Parse(href)
+			if err != nil {
+				ms.notFound(href)
+				continue
+			}
+			name, _ := davName(u.Path)
+			if t, ok := byName[name]; ok {
+				ms.props(newDAVTask(t), req.props())
+			} else {
+				ms.notFound(href)
+			}
+		}
+	case reportSync:
+		current := make(map[int]*Task)
+		for _, t := range tasks {
+			current[t.ID] = t
+		}
+		for _, rev := range revs {
+			if t, ok := current[rev.TaskID]; ok {
+				ms.props(newDAVTask(t), req.props())
+				continue
+			}
+			if t := lastState(rev.TaskID); t != nil && roleOf(r, t) >= RoleViewer {
+				ms.notFound(davHref(t)) // Deleted or purged.
+			}
+		}
+		return ms.write(w, "<d:sync-token>"+xmlEscape(syncToken(seq))+"</d:sync-token>")
+	}
+	return ms.write(w, "")
+}
+
+// lastState returns the last recorded state of the task with given id
+// which isn't purged, or nil if there isn't any.
+func lastState(id int) *Task {
+	revs := revisions.task(id)
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].Task != nil {
+			return revs[i].Task
+		}
+	}
+	return nil
+}
+
+// davMatch reports whether the task resource, which is nil if it doesn't
+// exist, satisfies the If-Match and If-None-Match request headers.
+func davMatch(r *http.Request, res *davResource) bool {
+	matches := func(h string) bool {
+		for _, tag := range strings.Split(h, ",") {
+			if tag = strings.TrimSpace(tag); res != nil && (tag == "*" || tag == res.etag) {
+				return true
+			}
+		}
+		return false
+	}
+	if h := r.Header.Get("If-Match"); h != "" && !matches(h) {
+		return false
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" && matches(h) {
+		return false
+	}
+	return true
+}
+
+// davRead handles requests for the iCalendar objects of the tasks.
+func davRead(w http.ResponseWriter, r *http.Request) error {
+	t, err := davFind(r.Context(), storage(), r)
+	if err == ErrFindUnknown {
+		return notFoundError(fmt.Errorf("%s doesn't exists", r.URL.Path))
+	}
+	if err != nil {
+		return err
+	}
+	res := newDAVTask(t)
+	w.Header().Set("ETag", res.etag)
+	if r.Header.Get("If-None-Match") != "" && !davMatch(r, res) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+	w.Header().Set("Content-Type", davCalendarContent)
+	_, err = io.WriteString(w, res.body)
+	return err
+}
+
+// davPut handles requests for the creation and the updates of the tasks
+// from the iCalendar objects. The UID of a created task must be the name
+// of its resource, not used by any other task nor in the form of the UIDs
+// derived from the IDs of the tasks. The updated task keeps its UID, and
+// its time zone if the date in the object doesn't have one.
+func davPut(w http.ResponseWriter, r *http.Request) error {
+	name, ok := davName(r.URL.Path)
+	if !ok {
+		return &errRequest{fmt.Errorf("%s isn't a task resource", r.URL.Path), http.StatusMethodNotAllowed}
+	}
+	body, err := readDAVBody(r)
+	if err != nil {
+		return err
+	}
+	u, err := ParseICal(string(body))
+	if err != nil {
+		return badRequestError(err)
+	}
+
+	var c change
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		t, err := davFind(ctx, m, r)
+		if err == ErrFindUnknown {
+			if !davMatch(r, nil) {
+				return errPreconditionFailed
+			}
+			if u.UID == "" {
+				u.UID = name
+			}
+			if u.UID != name {
+				return badRequestError(fmt.Errorf("UID %q isn't the name of the resource %q", u.UID, name))
+			}
+			if isDerivedUID(name) { // It may belong to a task created later.
+				return &errRequest{fmt.Errorf("UID %q is reserved for the tasks created by the server", name), http.StatusConflict}
+			}
+			c.after, err = createTaskFrom(ctx, m, u, owner(r))
+			if errors.Is(err, errUIDUsed) {
+				return &errRequest{err, http.StatusConflict}
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if !davMatch(r, newDAVTask(t)) {
+			return errPreconditionFailed
+		}
+		if err := authorize(r, t, RoleEditor); err != nil {
+			return err
+		}
+		if u.UID != "" && u.UID != CalendarUID(t) {
+			return badRequestError(fmt.Errorf("UID %q isn't the name of the resource %q", u.UID, name))
+		}
+		u.ID, u.Owner, u.UID = t.ID, t.Owner, t.UID
+		if u.TimeZone == "" && u.Date != 0 && t.TimeZone != "" {
+			u.TimeZone = t.TimeZone
+			if u.AllDay {
+				d := time.Unix(u.Date, 0).UTC()
+				u.Date = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, u.Location()).Unix()
+			}
+		}
+		if err := m.UpdateContext(ctx, u); err != nil {
+			return err
+		}
+		c.before = t
+		c.after, err = m.FindContext(ctx, u.ID)
+		return err
+	})
+	if err == ErrCreateEmptyTitle {
+		return badRequestError(err)
+	}
+	if err != nil {
+		return err
+	}
+	commit(r, c)
+	w.Header().Set("ETag", newDAVTask(c.after).etag)
+	if c.before == nil {
+		w.WriteHeader(http.StatusCreated)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	return nil
+}
+
+// davRemove handles requests for the deletion of the tasks.
+// The deleted tasks are moved to the trash.
+func davRemove(w http.ResponseWriter, r *http.Request) error {
+	var c change
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = davFind(ctx, m, r); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("%s doesn't exists", r.URL.Path))
+		}
+		if err != nil {
+			return err
+		}
+		if !davMatch(r, newDAVTask(c.before)) {
+			return errPreconditionFailed
+		}
+		if err := authorize(r, c.before, RoleOwner); err != nil {
+			return err
+		}
+		if err := m.DeleteContext(ctx, c.before.ID); err != nil {
+			return err
+		}
+		c.after, err = findDeleted(ctx, m, c.before.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	commit(r, c)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,280 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// davClient is a minimal CalDAV client of the in-process server.
+type davClient struct {
+	t   *testing.T
+	srv *httptest.Server
+}
+
+// do sends the request with the headers given as name, value pairs and
+// checks its status code. It returns the response with the read body.
+func (c *davClient) do(method, path, body string, code int, headers ...string) (*http.Response, string) {
+	req, err := http.NewRequest(method, c.srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := c.srv.Client().Do(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatalf("%s %s: cannot read the response: %v", method, path, err)
+	}
+	if err := checkStatusCode(resp.StatusCode, code); err != nil {
+		c.t.Fatalf("%s %s: %v\nRecieve body: %q", method, path, err, b)
+	}
+	return resp, string(b)
+}
+
+// davResponse is a response of the multi-status body with
+// the found properties and the names of the missing ones.
+type davResponse struct {
+	status  string
+	props   map[string]string // Values of the found properties by their local names.
+	missing []string
+}
+
+// multistatus sends the request and returns its responses by their hrefs and the sync token.
+func (c *davClient) multistatus(method, path, depth, body string) (map[string]davResponse, string) {
+	_, b := c.do(method, path, body, http.StatusMultiStatus, "Depth", depth, "Content-Type", "application/xml")
+	var ms struct {
+		Responses []struct {
+			Href     string `xml:"DAV: href"`
+			Status   string `xml:"DAV: status"`
+			Propstat []struct {
+				Prop struct {
+					Props []struct {
+						XMLName xml.Name
+						Value   string `xml:",chardata"`
+						Inner   string `xml:",innerxml"`
+					} `xml:",any"`
+				} `xml:"DAV: prop"`
+				Status string `xml:"DAV: status"`
+			} `xml:"DAV: propstat"`
+		} `xml:"DAV: response"`
+		SyncToken string `xml:"DAV: sync-token"`
+	}
+	if err := xml.Unmarshal([]byte(b), &ms); err != nil {
+		c.t.Fatalf("%s %s: cannot decode the multi-status: %v\n%s", method, path, err, b)
+	}
+	res := make(map[string]davResponse)
+	for _, r := range ms.Responses {
+		dr := davResponse{status: r.Status, props: make(map[string]string)}
+		for _, ps := range r.Propstat {
+			for _, p := range ps.Prop.Props {
+				if strings.Contains(ps.Status, "200") {
+					v := p.Value
+					if strings.Contains(p.Inner, "<") {
+						v = p.Inner
+					}
+					dr.props[p.XMLName.Local] = v
+				} else {
+					dr.missing = append(dr.missing, p.XMLName.Local)
+				}
+			}
+		}
+		res[r.Href] = dr
+	}
+	return res, ms.SyncToken
+}
+
+// hrefs returns the sorted hrefs of the responses.
+func hrefs(res map[string]davResponse) []string {
+	var h []string
+	for href := range res {
+		h = append(h, href)
+	}
+	sort.Strings(h)
+	return h
+}
+
+func vtodo(uid, extra string) string {
+	return "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Test//EN\r\nBEGIN:VTODO\r\nUID:" + uid +
+		"\r\nDTSTAMP:20150318T151310Z\r\nSUMMARY:Task " + uid + "\r\n" + extra + "END:VTODO\r\nEND:VCALENDAR\r\n"
+}
+
+func syncReq(token string) string {
+	return `<?xml version="1.0"?><d:sync-collection xmlns:d="DAV:"><d:sync-token>` + token +
+		`</d:sync-token><d:sync-level>1</d:sync-level><d:prop><d:getetag/></d:prop></d:sync-collection>`
+}
+
+func TestDAV(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	c := &davClient{t, httptest.NewServer(http.HandlerFunc(DAVAPI))}
+	defer c.srv.Close()
+
+	resp, _ := c.do("OPTIONS", DAVPath, "", http.StatusOK)
+	if got := resp.Header.Get("DAV"); !strings.Contains(got, "calendar-access") {
+		t.Errorf("OPTIONS %s: got DAV header %q; want calendar-access", DAVPath, got)
+	}
+
+	// Discovery of the calendar.
+	res, _ := c.multistatus("PROPFIND", DAVPath, "0", `<?xml version="1.0"?><d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav">`+
+		`<d:prop><d:current-user-principal/><c:calendar-home-set/></d:prop></d:propfind>`)
+	if p := res[DAVPath].props; p["current-user-principal"] != "<d:href>/dav/</d:href>" || p["calendar-home-set"] != "<d:href>/dav/</d:href>" {
+		t.Errorf("PROPFIND %s: got properties %v; want principal and home %s", DAVPath, p, DAVPath)
+	}
+	res, _ = c.multistatus("PROPFIND", DAVPath, "1", "")
+	if got, want := hrefs(res), []string{DAVPath, DAVCalendarPath}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PROPFIND %s: got hrefs %v; want %v", DAVPath, got, want)
+	}
+	res, _ = c.multistatus("PROPFIND", DAVCalendarPath, "0", `<?xml version="1.0"?>`+
+		`<d:propfind xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:x="urn:x">`+
+		`<d:prop><d:resourcetype/><c:supported-calendar-component-set/><d:sync-token/><x:unknown/></d:prop></d:propfind>`)
+	cal := res[DAVCalendarPath]
+	if cal.props["resourcetype"] != "<d:collection/><c:calendar/>" || !strings.Contains(cal.props["supported-calendar-component-set"], "VTODO") ||
+		cal.props["sync-token"] == "" || !reflect.DeepEqual(cal.missing, []string{"unknown"}) {
+		t.Errorf("PROPFIND %s: got %v; want calendar of VTODOs with sync token and missing unknown property", DAVCalendarPath, cal)
+	}
+
+	// Creation of tasks.
+	resp, _ = c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("abc", "DUE;VALUE=DATE:20150320\r\n"), http.StatusCreated, "If-None-Match", "*")
+	etag := resp.Header.Get("ETag")
+	if etag == "" {
+		t.Fatalf("PUT %sabc.ics: missing ETag", DAVCalendarPath)
+	}
+	c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("abc", ""), http.StatusPreconditionFailed, "If-None-Match", "*")
+	c.do("PUT", DAVCalendarPath+"def.ics", vtodo("abc", ""), http.StatusBadRequest)
+	c.do("PUT", DAVCalendarPath+"def.ics", "BEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n", http.StatusBadRequest)
+	c.do("PUT", DAVCalendarPath+"def.ics", vtodo("def", ""), http.StatusPreconditionFailed, "If-Match", etag)
+	c.do("PUT", DAVCalendarPath, vtodo("def", ""), http.StatusMethodNotAllowed)
+	c.do("PUT", DAVCalendarPath+"task-7@todo.ics", vtodo("task-7@todo", ""), http.StatusConflict)
+	c.do("PUT", DAVCalendarPath+"task-7@todo.ics", vtodo("", ""), http.StatusConflict)
+
+	res, token := c.multistatus("REPORT", DAVCalendarPath, "1", syncReq(""))
+	if got, want := hrefs(res), []string{DAVCalendarPath + "abc.ics"}; !reflect.DeepEqual(got, want) || res[want[0]].props["getetag"] != etag {
+		t.Errorf("REPORT sync-collection: got %v; want %v with ETag %s", res, want, etag)
+	}
+
+	resp, body := c.do("GET", DAVCalendarPath+"abc.ics", "", http.StatusOK)
+	if resp.Header.Get("ETag") != etag || !strings.Contains(body, "UID:abc\r\n") || !strings.Contains(body, "DUE;VALUE=DATE:20150320\r\n") {
+		t.Errorf("GET %sabc.ics: got ETag %s and body %q; want ETag %s and the task", DAVCalendarPath, resp.Header.Get("ETag"), body, etag)
+	}
+	c.do("GET", DAVCalendarPath+"abc.ics", "", http.StatusNotModified, "If-None-Match", etag)
+	h := revisions
+	revisions = newHistory() // The history, lost by a restart, doesn't change the ETag.
+	c.do("GET", DAVCalendarPath+"abc.ics", "", http.StatusNotModified, "If-None-Match", etag)
+	revisions = h
+	c.do("GET", DAVCalendarPath+"unknown.ics", "", http.StatusNotFound)
+
+	// Updates from the client and from the REST API.
+	c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("abc", "DUE;VALUE=DATE:20150320\r\nSTATUS:COMPLETED\r\n"), http.StatusPreconditionFailed, "If-Match", `"stale"`)
+	resp, _ = c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("abc", "DUE;VALUE=DATE:20150320\r\nSTATUS:COMPLETED\r\n"), http.StatusNoContent, "If-Match", etag)
+	if resp.Header.Get("ETag") == etag {
+		t.Errorf("PUT %sabc.ics: the ETag didn't change", DAVCalendarPath)
+	}
+	etag = resp.Header.Get("ETag")
+	if task, ok := tasks.Find(0); !ok || !task.Done || task.UID != "abc" {
+		t.Errorf("PUT %sabc.ics: got task %v, %t; want done task with UID abc", DAVCalendarPath, task, ok)
+	}
+	c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("xyz", ""), http.StatusBadRequest, "If-Match", etag)
+	send(t, "POST", Path, "", `{"title":"Task 1"}`)
+
+	res, token = c.multistatus("REPORT", DAVCalendarPath, "1", syncReq(token))
+	if got, want := hrefs(res), []string{DAVCalendarPath + "abc.ics", DAVCalendarPath + "task-1@todo.ics"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("REPORT sync-collection: got hrefs %v; want %v", got, want)
+	}
+	res, _ = c.multistatus("REPORT", DAVCalendarPath, "1", syncReq(token))
+	if len(res) != 0 {
+		t.Errorf("REPORT sync-collection without changes: got %v; want no responses", res)
+	}
+
+	// Queries.
+	res, _ = c.multistatus("REPORT", DAVCalendarPath, "1", `<?xml version="1.0"?>`+
+		`<c:calendar-multiget xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/><c:calendar-data/></d:prop>`+
+		`<d:href>`+DAVCalendarPath+`task-1%40todo.ics</d:href><d:href>`+DAVCalendarPath+`unknown.ics</d:href></c:calendar-multiget>`)
+	if p := res[DAVCalendarPath+"task-1@todo.ics"].props; !strings.Contains(p["calendar-data"], "SUMMARY:Task 1\r\n") || p["getetag"] == "" {
+		t.Errorf("REPORT calendar-multiget: got properties %v; want calendar data of Task 1", p)
+	}
+	if s := res[DAVCalendarPath+"unknown.ics"].status; !strings.Contains(s, "404") {
+		t.Errorf("REPORT calendar-multiget: got status %q of unknown resource; want 404", s)
+	}
+	for _, test := range []struct {
+		filter string
+		hrefs  []string
+	}{
+		{`<c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"/></c:comp-filter>`,
+			[]string{DAVCalendarPath + "abc.ics", DAVCalendarPath + "task-1@todo.ics"}},
+		{`<c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"><c:time-range start="20150320T000000Z" end="20150321T000000Z"/></c:comp-filter></c:comp-filter>`,
+			[]string{DAVCalendarPath + "abc.ics", DAVCalendarPath + "task-1@todo.ics"}},
+		{`<c:comp-filter name="VCALENDAR"><c:comp-filter name="VTODO"><c:time-range start="20150321T000000Z"/></c:comp-filter></c:comp-filter>`,
+			[]string{DAVCalendarPath + "task-1@todo.ics"}},
+		{`<c:comp-filter name="VCALENDAR"><c:comp-filter name="VEVENT"/></c:comp-filter>`, nil},
+	} {
+		res, _ := c.multistatus("REPORT", DAVCalendarPath, "1", `<?xml version="1.0"?>`+
+			`<c:calendar-query xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav"><d:prop><d:getetag/></d:prop>`+
+			`<c:filter>`+test.filter+`</c:filter></c:calendar-query>`)
+		if got := hrefs(res); !reflect.DeepEqual(got, test.hrefs) {
+			t.Errorf("REPORT calendar-query %s: got hrefs %v; want %v", test.filter, got, test.hrefs)
+		}
+	}
+
+	// Deletion.
+	c.do("DELETE", DAVCalendarPath+"abc.ics", "", http.StatusPreconditionFailed, "If-Match", `"stale"`)
+	c.do("DELETE", DAVCalendarPath+"abc.ics", "", http.StatusNoContent, "If-Match", etag)
+	c.do("DELETE", DAVCalendarPath+"abc.ics", "", http.StatusNotFound)
+	res, _ = c.multistatus("REPORT", DAVCalendarPath, "1", syncReq(token))
+	if r, ok := res[DAVCalendarPath+"abc.ics"]; len(res) != 1 || !ok || !strings.Contains(r.status, "404") {
+		t.Errorf("REPORT sync-collection after deletion: got %v; want 404 status of abc.ics", res)
+	}
+
+	// Errors.
+	_, body = c.do("REPORT", DAVCalendarPath, syncReq("urn:todo:sync:1:1"), http.StatusForbidden)
+	if !strings.Contains(body, "valid-sync-token") {
+		t.Errorf("REPORT sync-collection with invalid token: got body %q; want valid-sync-token error", body)
+	}
+	c.do("REPORT", DAVPath, syncReq(""), http.StatusForbidden)
+	c.do("REPORT", DAVCalendarPath, `<d:unknown xmlns:d="DAV:"/>`, http.StatusForbidden)
+	c.do("PROPFIND", DAVCalendarPath, "<d:propfind", http.StatusBadRequest)
+	c.do("MKCALENDAR", DAVCalendarPath, "", http.StatusMethodNotAllowed)
+}
+
+func TestDAVUIDConflict(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	defer func() { tasks = NewManager() }()
+	for _, u := range []Task{{Title: "Task 0", UID: "abc", Owner: "bob"}, {Title: "Task 1", UID: "def"}} {
+		c, err := tasks.Create(u.Title)
+		if err != nil {
+			t.Fatal(err)
+		}
+		u.ID = c.ID
+		if err := tasks.Update(&u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tasks.Delete(1); err != nil {
+		t.Fatal(err)
+	}
+	c := &davClient{t, httptest.NewServer(http.HandlerFunc(DAVAPI))}
+	defer c.srv.Close()
+
+	c.do("PUT", DAVCalendarPath+"abc.ics", vtodo("abc", ""), http.StatusConflict) // Task of another user.
+	c.do("PUT", DAVCalendarPath+"def.ics", vtodo("def", ""), http.StatusConflict) // Deleted task.
+	c.do("PUT", DAVCalendarPath+"task-2@todo.ics", vtodo("task-2@todo", ""), http.StatusConflict)
+	c.do("PUT", DAVCalendarPath+"task-02@todo.ics", vtodo("task-02@todo", ""), http.StatusCreated)
+	if task, ok := tasks.Find(2); !ok || CalendarUID(task) != "task-02@todo" {
+		t.Errorf("PUT %stask-02@todo.ics: got task %v, %t; want task with UID task-02@todo", DAVCalendarPath, task, ok)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// errNoChange rolls back a change which changed nothing,
+// so the file isn't saved needlessly.
+var errNoChange = errors.New("no change")
+
+// fileData is the content of the storage file.
+type fileData struct {
+	NextID int     `json:"nextId"`
+	Tasks  []*Task `json:"tasks"`
+	Trash  []*Task `json:"trash"`
+}
+
+// inFile allows manage tasks in memory and saves them to a JSON file
+// after every change. A change is applied to a copy of the stored tasks
+// and replaces them only after the copy is saved, so the tasks in memory
+// never differ from the file because of a failed saving.
+type inFile struct {
+	*fileStore
+	ctx context.Context // Context of the operations; nil if they have none.
+}
+
+// fileStore holds the tasks of an inFile shared by its contexts.
+type fileStore struct {
+	*inMemory
+	path string
+	mu   sync.Mutex // Serializes saving.
+	err  error      // Error of the last saving.
+}
+
+// NewFileManager returns a new Manager storing tasks in the file
+// at path. The tasks are loaded from the file if it exists.
+func NewFileManager(path string) (Manager, error) {
+	m := &inFile{fileStore: &fileStore{inMemory: &inMemory{}, path: path}}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, m.Flush()
+	}
+	if err != nil {
+		return nil, err
+	}
+	var d fileData
+	if err := json.Unmarshal(b, &d); err != nil {
+		return nil, fmt.Errorf("task: %s: %v", path, err)
+	}
+	m.tasks, m.trash, m.nextID = d.Tasks, d.Trash, d.NextID
+	return m, nil
+}
+
+// save writes d to the file. The file is replaced
+// atomically, so it's never left partially written.
+func (m *inFile) save(d fileData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.err = m.write(d)
+	return m.err
+}
+
+// write writes d to a temporary file and renames
+// it to the path of the storage file.
+func (m *inFile) write(d fileData) error {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(m.path), filepath.Base(m.path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), m.path)
+}
+
+// WithContext returns the Manager whose operations fail with the error
+// of ctx if it's done before they start or before their changes are saved.
+func (m *inFile) WithContext(ctx context.Context) Manager {
+	return &inFile{m.fileStore, ctx}
+}
+
+// done returns the error of the context of the operations, if any.
+func (m *inFile) done() error {
+	if m.ctx == nil {
+		return nil
+	}
+	return m.ctx.Err()
+}
+
+// change runs fn on a private copy of the stored tasks, saves the copy
+// and replaces the stored tasks with it if both fn and the saving succeed.
+// The context is checked after waiting for the other changes and before
+// the saving, so the changes made for done contexts aren't saved.
+func (m *inFile) change(fn func(m Manager) error) error {
+	return m.inMemory.Tx(func(tx Manager) error {
+		if err := m.done(); err != nil {
+			return err
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+		if err := m.done(); err != nil {
+			return err
+		}
+		d := tx.(*inMemory)
+		return m.save(fileData{d.nextID, d.tasks, d.trash})
+	})
+}
+
+// Create stores and returns new task with given title.
+// An error is returned if the title is empty or the tasks can't be saved.
+func (m *inFile) Create(title string) (t *Task, err error) {
+	err = m.change(func(tx Manager) error {
+		t, err = tx.Create(title)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Update updates given task.
+// Returns error if such a task doesn't exist or the tasks can't be saved.
+func (m *inFile) Update(task *Task) error {
+	return m.change(func(tx Manager) error { return tx.Update(task) })
+}
+
+// Delete moves task with given id to the trash.
+// Returns an error if a task with such id doesn't exist or the tasks can't be saved.
+func (m *inFile) Delete(id int) error {
+	return m.change(func(tx Manager) error { return tx.Delete(id) })
+}
+
+// Restore moves deleted task with given id back from the trash.
+// Returns an error if such a task isn't in the trash or the tasks can't be saved.
+func (m *inFile) Restore(id int) (t *Task, err error) {
+	err = m.change(func(tx Manager) error {
+		t, err = tx.Restore(id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Purge permanently removes deleted task with given id.
+// Returns an error if such a task isn't in the trash or the tasks can't be saved.
+func (m *inFile) Purge(id int) error {
+	return m.change(func(tx Manager) error { return tx.Purge(id) })
+}
+
+// PurgeBefore permanently removes tasks deleted before t.
+// Returns a number of removed tasks, which is 0 if the
+// tasks can't be saved; the error is reported by Ping.
+func (m *inFile) PurgeBefore(t time.Time) (n int) {
+	err := m.change(func(tx Manager) error {
+		if n = tx.PurgeBefore(t); n == 0 {
+			return errNoChange
+		}
+		return nil
+	})
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// Tx runs fn on a private copy of the stored tasks, saves the copy
+// and replaces the stored tasks with it if fn and the saving succeed.
+func (m *inFile) Tx(fn func(m Manager) error) error {
+	return m.change(fn)
+}
+
+// Flush saves the stored tasks to the file.
+func (m *inFile) Flush() error {
+	if err := m.done(); err != nil {
+		return err
+	}
+	m.inMemory.mu.RLock()
+	defer m.inMemory.mu.RUnlock()
+	return m.save(fileData{m.nextID, m.tasks, m.trash})
+}
+
+// Ping checks that the last saving succeeded and the file still exists.
+func (m *inFile) Ping() error {
+	if err := m.done(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	err := m.err
+	m.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(m.path)
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileManager(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) }
+
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	m, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("NewFileManager(%q) didn't create the file: %v", path, err)
+	}
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	if err := m.Delete(1); err != nil {
+		t.Fatalf("Delete(1): unexpected error: %v", err)
+	}
+	m.Tx(func(tx Manager) error {
+		_, err := tx.Create("Task 3")
+		return err
+	})
+
+	// Reopen the file and check that all changes were saved.
+	r, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q) of existing file: unexpected error: %v", path, err)
+	}
+	if got, want := ptrToVal(r.All()), ptrToVal(m.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("All() after reopen = %v; want %v", got, want)
+	}
+	if got, want := ptrToVal(r.Trash()), ptrToVal(m.Trash()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Trash() after reopen = %v; want %v", got, want)
+	}
+	if task, _ := r.Create("Task 4"); task.ID != 4 {
+		t.Errorf("Create(...) after reopen: got ID %d; want 4", task.ID)
+	}
+
+	if err := os.WriteFile(path, []byte("garbage"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileManager(path); err == nil {
+		t.Errorf("NewFileManager(%q) of corrupted file: expected error", path)
+	}
+}
+
+func TestFileManagerSaveError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	m, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	if err := addTasks(m, testTasks[:2], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	want := ptrToVal(m.All())
+
+	f := m.(*inFile)
+	f.path = filepath.Join(path, "missing") // The directory doesn't exist.
+	if _, err := m.Create("Task 2"); err == nil {
+		t.Errorf("Create(...) failing to save: expected error")
+	}
+	u := *m.All()[0]
+	u.Title = "Updated"
+	if err := m.Update(&u); err == nil {
+		t.Errorf("Update(...) failing to save: expected error")
+	}
+	if err := m.Delete(0); err == nil {
+		t.Errorf("Delete(0) failing to save: expected error")
+	}
+	if err := m.Tx(func(tx Manager) error { return tx.Delete(1) }); err == nil {
+		t.Errorf("Tx(...) failing to save: expected error")
+	}
+	if got := ptrToVal(m.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("All() after failed saving = %v; want %v", got, want)
+	}
+	if len(m.Trash()) != 0 {
+		t.Errorf("Trash() after failed saving = %v; want none", m.Trash())
+	}
+	if err := m.Ping(); err == nil {
+		t.Errorf("Ping() after failed saving: expected error")
+	}
+
+	f.path = path
+	if task, err := m.Create("Task 2"); err != nil || task.ID != 2 {
+		t.Errorf("Create(...) after failed saving = %v, %v; want ID 2, <nil>", task, err)
+	}
+	if err := m.Ping(); err != nil {
+		t.Errorf("Ping() after successful saving: unexpected error: %v", err)
+	}
+}
@@ -5,11 +5,17 @@
 package task
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"mime"
 	"net/http"
 	"strconv"
+	"strings"
+
+	"github.com/mrekucci/todo/internal/auth"
+	"github.com/mrekucci/todo/internal/logging"
 )
 
 // Path specifies the task resource path.
@@ -36,6 +42,12 @@ type handler func(http.ResponseWriter, *http.Request) error
 
 var tasks = NewManager()
 
+// SetManager sets the Manager storing the tasks served by the handlers.
+// It must be called before the handlers serve any request.
+func SetManager(m Manager) {
+	tasks = m
+}
+
 var filters = map[string]Filter{
 	"isDone":      func(t *Task) bool { return t.Done },
 	"isNotDone":   func(t *Task) bool { return !t.Done },
@@ -52,58 +64,165 @@ var sorters = map[string]Sort{
 // RestAPI is a handler function that handles http requests to the task resources.
 func RestAPI(w http.ResponseWriter, r *http.Request) {
 	var err error
-	switch r.Method {
-	case "GET":
-		w.Header().Set("Content-Type", "application/json")
-		if len(r.URL.Path) > len(Path) {
-			err = read(w, r)
-		} else {
-			err = readAll(w, r)
-		}
-	case "POST":
-		err = create(w, r)
-	case "PUT":
-		if len(r.URL.Path) > len(Path) {
-			err = update(w, r)
-		}
-	case "DELETE":
-		if len(r.URL.Path) > len(Path) {
-			err = delete(w, r)
-		}
+	switch sub := subresource(r); {
+	case sub == "history" && r.Method == "GET":
+		err = readHistory(w, r)
+	case sub == "revert" && r.Method == "POST":
+		err = revert(w, r)
+	case sub == "share" || strings.HasPrefix(sub, "share/"):
+		err = share(w, r)
+	case strings.HasPrefix(sub, "checklist/") && r.Method == "POST":
+		err = idempotent(checkItem)(w, r)
+	case sub != "":
+		err = notFoundError(fmt.Errorf("%s %s doesn't exists", r.Method, r.URL.Path))
 	default:
-		err = badRequestError(fmt.Errorf("%s doesn't implemented", r.Method))
+		switch r.Method {
+		case "GET":
+			w.Header().Set("Content-Type", "application/json")
+			if len(r.URL.Path) > len(Path) {
+				err = read(w, r)
+			} else {
+				err = readAll(w, r)
+			}
+		case "POST":
+			switch r.URL.Path {
+			case BulkPath:
+				err = idempotent(bulk)(w, r)
+			case ImportPath:
+				err = idempotent(importTasks)(w, r)
+			case StreamImportPath:
+				err = importStream(w, r)
+			case Path:
+				err = idempotent(create)(w, r)
+			default:
+				err = badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+			}
+		case "PUT":
+			if len(r.URL.Path) > len(Path) {
+				err = update(w, r)
+			} else {
+				err = badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+			}
+		case "DELETE":
+			if len(r.URL.Path) > len(Path) {
+				err = remove(w, r)
+			} else {
+				err = badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+			}
+		default:
+			err = badRequestError(fmt.Errorf("%s doesn't implemented", r.Method))
+		}
 	}
-	errorHandler(w, err)
+	errorHandler(w, r, err)
 }
 
 // errorHandler handles error responses.
-func errorHandler(w http.ResponseWriter, err error) {
+func errorHandler(w http.ResponseWriter, r *http.Request, err error) {
 	if err == nil {
 		return
 	}
+	if isContextError(err) {
+		logging.FromContext(r.Context()).Debug("request canceled", "err", err)
+		http.Error(w, fmt.Sprintf("%d %v", http.StatusServiceUnavailable, err), http.StatusServiceUnavailable)
+		return
+	}
+	var invalid *ValidationError
+	if errors.As(err, &invalid) {
+		logging.FromContext(r.Context()).Debug("request failed", "status", http.StatusUnprocessableEntity, "err", err)
+		res := struct {
+			Error  string       `json:"error"`
+			Fields []FieldError `json:"fields"`
+		}{
+			invalid.Error(),
+			invalid.Fields,
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(res)
+		return
+	}
+	var veto *VetoError
+	if errors.As(err, &veto) {
+		err = &errRequest{veto, http.StatusUnprocessableEntity}
+	}
 	switch e := err.(type) {
 	case *errRequest:
+		logging.FromContext(r.Context()).Debug("request failed", "status", e.code, "err", e.error)
 		http.Error(w, e.Error(), e.code)
 	default:
-		log.Println(e)
-		http.Error(w, "internal server error", http.StatusInternalServerError)
+		logging.FromContext(r.Context()).Error("internal server error", "err", e)
+		msg := "internal server error"
+		if id := logging.RequestID(r.Context()); id != "" {
+			msg += " (request id: " + id + ")"
+		}
+		http.Error(w, msg, http.StatusInternalServerError)
 	}
 }
 
 // create handles requests for the creation of a new task.
+// The created task is written to the response.
 func create(w http.ResponseWriter, r *http.Request) error {
 	req := struct {
-		Title string `json:"title"`
+		Title    string `json:"title"`
+		QuickAdd bool   `json:"quickAdd"`
 	}{}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		return badRequestError(err)
 	}
-	_, err := tasks.Create(req.Title)
+	if req.QuickAdd {
+		return quickCreate(w, r, req.Title)
+	}
+	var t *Task
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		t, err = createTask(ctx, m, req.Title, owner(r))
+		return err
+	})
+	if err == ErrCreateEmptyTitle {
+		return badRequestError(err)
+	}
+	if err != nil {
+		return err
+	}
+	commit(r, change{nil, t})
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(t)
+}
+
+// quickCreate handles requests for the creation of a new task from
+// the quick-add text. The created task is written to the response
+// together with the parts of the text which were recognized.
+func quickCreate(w http.ResponseWriter, r *http.Request, text string) error {
+	loc, err := location(r)
 	if err != nil {
 		return badRequestError(err)
 	}
-	return nil
+	parsed, rec := ParseQuickAdd(text, now().In(loc))
+	var t *Task
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		t, err = createTaskFrom(ctx, m, parsed, owner(r))
+		return err
+	})
+	if err == ErrCreateEmptyTitle {
+		return badRequestError(err)
+	}
+	if err != nil {
+		return err
+	}
+	commit(r, change{nil, t})
+	if rec == nil {
+		rec = []Recognized{}
+	}
+	res := struct {
+		Task       *Task        `json:"task"`
+		Recognized []Recognized `json:"recognized"`
+	}{
+		t,
+		rec,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
 }
 
 // read handles requests for the reads of a specific task.
@@ -112,35 +231,143 @@ func read(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return badRequestError(err)
 	}
-	t, ok := tasks.Find(id)
-	if !ok {
+	t, err := storage().FindContext(r.Context(), id)
+	if err == ErrFindUnknown {
 		return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
 	}
+	if err != nil {
+		return err
+	}
+	if err := authorize(r, t, RoleViewer); err != nil {
+		return err
+	}
+	rendered, err := renderNotes(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	if rendered {
+		return json.NewEncoder(w).Encode((*htmlTask)(t))
+	}
 	return json.NewEncoder(w).Encode(t)
 }
 
 // readAll handles requests for the reads of all tasks.
 func readAll(w http.ResponseWriter, r *http.Request) error {
-	t := tasks.All()
+	t, err := selectTasks(r)
+	if err != nil {
+		return err
+	}
+	rendered, err := renderNotes(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	w.Header().Add("Vary", "Accept")
+	mt, ok := formats[r.URL.Query().Get("format")]
+	if !ok {
+		mt = negotiate(r.Header.Get("Accept"), "application/json", "application/x-ndjson", "text/csv", "text/plain")
+	}
+	if rendered && mt == "application/json" {
+		return writeHTMLJSON(w, t)
+	}
+	return taskWriters[mt](w, t)
+}
+
+// formats maps the values of the format query parameter to the media types.
+var formats = map[string]string{
+	"json":    "application/json",
+	"ndjson":  "application/x-ndjson",
+	"csv":     "text/csv",
+	"todotxt": "text/plain",
+}
+
+// taskWriters maps the media types to the functions writing the tasks in them.
+var taskWriters = map[string]func(w http.ResponseWriter, tasks []*Task) error{
+	"application/json":     writeJSON,
+	"application/x-ndjson": writeNDJSON,
+	"text/csv":             writeCSV,
+	"text/plain":           writeTodoTxt,
+}
+
+// writeJSON writes the tasks to the response as a JSON object.
+func writeJSON(w http.ResponseWriter, tasks []*Task) error {
+	res := struct {
+		Tasks []*Task `json:"tasks"`
+	}{
+		tasks,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// negotiate returns the offered media type with the highest quality in the
+// Accept header, the first one of those with the same quality. The first
+// offer is returned if there isn't any Accept header or acceptable offer.
+func negotiate(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		q, specificity := 0.0, 0
+		for _, part := range strings.Split(accept, ",") {
+			mt, params, err := mime.ParseMediaType(part)
+			if err != nil {
+				continue
+			}
+			s := 0
+			switch {
+			case mt == offer:
+				s = 3
+			case strings.HasSuffix(mt, "/*") && strings.HasPrefix(offer, mt[:len(mt)-1]):
+				s = 2
+			case mt == "*/*":
+				s = 1
+			}
+			if s <= specificity {
+				continue
+			}
+			q, specificity = 1, s
+			if v, err := strconv.ParseFloat(params["q"], 64); err == nil {
+				q = v
+			}
+		}
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// selectTasks returns the tasks visible to the request
+// filtered and sorted by the request query parameters.
+func selectTasks(r *http.Request) ([]*Task, error) {
+	all, err := storage().AllContext(r.Context())
+	if err != nil {
+		return nil, err
+	}
+	t := visible(r, RoleViewer).Tasks(all)
 
 	// Apply filter.
-	byFieldEq, ok := filters[r.URL.Query().Get("filter")]
+	filter := r.URL.Query().Get("filter")
+	byFieldEq, ok := filters[filter]
 	if ok {
 		t = Filter(byFieldEq).Tasks(t)
 	}
+	byDate, ok := dateFilters[filter]
+	if ok {
+		loc, err := location(r)
+		if err != nil {
+			return nil, badRequestError(err)
+		}
+		t = byDate(now().In(loc)).Tasks(t)
+	}
 
 	// Apply sorter.
 	byField, ok := sorters[r.URL.Query().Get("sortBy")]
 	if ok {
 		Sort(byField).Tasks(t)
 	}
-
-	res := struct {
-		Tasks []*Task `json:"tasks"`
-	}{
-		t,
-	}
-	return json.NewEncoder(w).Encode(res)
+	return t, nil
 }
 
 // update handles requests for the updates of a specific task.
@@ -156,22 +383,152 @@ func update(w http.ResponseWriter, r *http.Request) error {
 	if t.ID != id {
 		return badRequestError(fmt.Errorf("inconsistent task IDs"))
 	}
-	if _, ok := tasks.Find(id); !ok {
-		return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
+	return updateTask(r, t)
+}
+
+// updateTask stores the changes of task t made by the request.
+func updateTask(r *http.Request, t *Task) error {
+	t.Deleted = 0
+	var c change
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = m.FindContext(ctx, t.ID); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("task id: %d doesn't exists", t.ID))
+		}
+		if err != nil {
+			return err
+		}
+		if err := authorize(r, c.before, RoleEditor); err != nil {
+			return err
+		}
+		t.Owner = c.before.Owner
+		if err := m.UpdateContext(ctx, t); err != nil {
+			return err
+		}
+		c.after, err = m.FindContext(ctx, t.ID)
+		return err
+	})
+	if err != nil {
+		return err
 	}
-	return tasks.Update(t)
+	commit(r, c)
+	return nil
 }
 
-// delete handles requests for the deletion of a specific task.
-func delete(w http.ResponseWriter, r *http.Request) error {
+// remove handles requests for the deletion of a specific task.
+func remove(w http.ResponseWriter, r *http.Request) error {
 	id, err := parseID(r)
 	if err != nil {
 		return badRequestError(err)
 	}
-	return tasks.Delete(id)
+	var c change
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = m.FindContext(ctx, id); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
+		}
+		if err != nil {
+			return err
+		}
+		if err := authorize(r, c.before, RoleOwner); err != nil {
+			return err
+		}
+		if err := m.DeleteContext(ctx, id); err != nil {
+			return err
+		}
+		c.after, err = findDeleted(ctx, m, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	commit(r, c)
+	return nil
 }
 
 // parseID extracts an task id from the request.
 func parseID(r *http.Request) (int, error) {
-	return strconv.Atoi(r.URL.Path[len(Path):])
+	id := r.URL.Path[len(Path):]
+	if i := strings.IndexByte(id, '/'); i >= 0 {
+		id = id[:i]
+	}
+	return strconv.Atoi(id)
+}
+
+// subresource extracts the part of the request path following the task id.
+func subresource(r *http.Request) string {
+	id := r.URL.Path[len(Path):]
+	if i := strings.IndexByte(id, '/'); i >= 0 {
+		return id[i+1:]
+	}
+	return ""
+}
+
+// owner returns the name of the user who made the request.
+// The requests which aren't authenticated share the tasks without an owner.
+func owner(r *http.Request) string {
+	if u, ok := auth.FromContext(r.Context()); ok {
+		return u.Name
+	}
+	return ""
+}
+
+// createTask creates in m a new task with given title owned by owner.
+func createTask(ctx context.Context, m ContextManager, title, owner string) (*Task, error) {
+	t, err := m.CreateContext(ctx, title)
+	if err != nil || owner == "" {
+		return t, err
+	}
+	c := *t // Copy the task to set its owner.
+	c.Owner = owner
+	if err := m.UpdateContext(ctx, &c); err != nil {
+		return nil, err
+	}
+	return m.FindContext(ctx, c.ID)
+}
+
+// createTaskFrom creates in m a new task with the fields of t owned by owner.
+// A UID of the form derived from the task IDs, like in the exports of this
+// server, is dropped so the task gets its own. A UID of another task is
+// rejected, so no two tasks share a CalDAV resource.
+func createTaskFrom(ctx context.Context, m ContextManager, t *Task, owner string) (*Task, error) {
+	uid := t.UID
+	if isDerivedUID(uid) {
+		uid = ""
+	}
+	if uid != "" {
+		if err := checkUID(ctx, m, uid); err != nil {
+			return nil, err
+		}
+	}
+	c, err := createTask(ctx, m, t.Title, owner)
+	if err != nil {
+		return nil, err
+	}
+	u := *t // Copy the task to keep the fields set by the creation.
+	u.ID, u.Title, u.Owner, u.Deleted, u.UID = c.ID, c.Title, c.Owner, 0, uid
+	if err := m.UpdateContext(ctx, &u); err != nil {
+		return nil, err
+	}
+	return m.FindContext(ctx, c.ID)
+}
+
+// errUIDUsed indicates that the UID of a created task is used by another task.
+var errUIDUsed = errors.New("UID is used by another task")
+
+// checkUID returns an error wrapping errUIDUsed if uid is the UID
+// of a task, including the deleted and invisible ones.
+func checkUID(ctx context.Context, m ContextManager, uid string) error {
+	all, err := m.AllContext(ctx)
+	if err != nil {
+		return err
+	}
+	trash, err := m.TrashContext(ctx)
+	if err != nil {
+		return err
+	}
+	for _, t := range append(all, trash...) {
+		if CalendarUID(t) == uid {
+			return fmt.Errorf("%w: %q", errUIDUsed, uid)
+		}
+	}
+	return nil
 }
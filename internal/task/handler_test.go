@@ -13,7 +13,11 @@ import (
 	"net/http/httptest"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/mrekucci/todo/internal/auth"
+	"github.com/mrekucci/todo/internal/logging"
 )
 
 func checkStatusCode(got, want int) error {
@@ -24,11 +28,19 @@ func checkStatusCode(got, want int) error {
 }
 
 func TestErrorHandlerInternalError(t *testing.T) {
+	req, err := http.NewRequest("GET", Path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(logging.NewContext(req.Context(), "req-1"))
 	rec := httptest.NewRecorder()
-	errorHandler(rec, errors.New("Internal Error"))
+	errorHandler(rec, req, errors.New("Internal Error"))
 	if err := checkStatusCode(rec.Code, http.StatusInternalServerError); err != nil {
 		t.Error(err)
 	}
+	if body := rec.Body.String(); !strings.Contains(body, "req-1") || strings.Contains(body, "Internal Error") {
+		t.Errorf("Recieve body %q; want the request id without the error", body)
+	}
 }
 
 func TestCreateReq(t *testing.T) {
@@ -114,6 +126,29 @@ func TestReadReqError(t *testing.T) {
 	}
 }
 
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "text/csv", "application/x-ndjson"}
+	for _, test := range []struct {
+		accept, want string
+	}{
+		{"", "application/json"},
+		{"text/csv", "text/csv"},
+		{"text/*", "text/csv"},
+		{"*/*", "application/json"},
+		{"image/png", "application/json"},
+		{"text/csv;q=0.5, application/x-ndjson", "application/x-ndjson"},
+		{"text/csv, application/x-ndjson", "text/csv"},
+		{"text/*;q=0.9, text/csv;q=0.1, */*;q=0.5", "application/json"},
+		{"text/csv;q=0, application/*;q=0.2", "application/json"},
+		{"text/csv;q=bad", "text/csv"},
+		{"text/;;, text/csv", "text/csv"},
+	} {
+		if got := negotiate(test.accept, offers...); got != test.want {
+			t.Errorf("negotiate(%q) = %q; want %q", test.accept, got, test.want)
+		}
+	}
+}
+
 func TestReadAllReq(t *testing.T) {
 	tasks = NewManager()
 	var tt []*Task
@@ -267,3 +302,72 @@ func TestUnknownReq(t *testing.T) {
 		t.Errorf("Recieve body: %q", rec.Body)
 	}
 }
+
+// sendAs sends a request with the given body on behalf of user to handler h.
+func sendAs(t *testing.T, h http.HandlerFunc, user, method, path, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req = req.WithContext(auth.NewContext(req.Context(), &auth.User{Name: user}))
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestOwnershipReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	sendAs(t, RestAPI, "alice", "POST", Path, `{"title":"Alice's task"}`)
+	sendAs(t, RestAPI, "bob", "POST", Path, `{"title":"Bob's task"}`)
+
+	if task, _ := tasks.Find(0); task.Owner != "alice" {
+		t.Errorf("POST %s: got owner %q; want %q", Path, task.Owner, "alice")
+	}
+
+	for _, test := range []struct {
+		h      http.HandlerFunc
+		method string
+		path   string
+		body   string
+		code   int
+	}{
+		{RestAPI, "GET", Path + "0", "", http.StatusNotFound},
+		{RestAPI, "PUT", Path + "0", `{"id":0,"title":"Stolen"}`, http.StatusNotFound},
+		{RestAPI, "DELETE", Path + "0", "", http.StatusNotFound},
+		{RestAPI, "GET", Path + "0/history", "", http.StatusNotFound},
+		{RestAPI, "POST", BulkPath, `{"operations":[{"op":"delete","id":0}]}`, http.StatusBadRequest},
+		{RestAPI, "GET", Path + "1", "", http.StatusOK},
+		{RestAPI, "PUT", Path + "1", `{"id":1,"title":"Updated","owner":"alice"}`, http.StatusOK},
+	} {
+		rec := sendAs(t, test.h, "bob", test.method, test.path, test.body)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %s %s as bob: %v", test.method, test.path, err)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+	}
+	if task, _ := tasks.Find(1); task.Owner != "bob" {
+		t.Errorf("PUT %s1: got owner %q; want %q", Path, task.Owner, "bob")
+	}
+
+	rec := sendAs(t, RestAPI, "bob", "GET", Path, "")
+	res := struct {
+		Tasks []Task `json:"tasks"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Task{{ID: 1, Title: "Updated", Owner: "bob"}}; !reflect.DeepEqual(res.Tasks, want) {
+		t.Errorf("GET %s as bob\n got %v\nwant %v", Path, res.Tasks, want)
+	}
+
+	// Deleted tasks are scoped too.
+	sendAs(t, RestAPI, "alice", "DELETE", Path+"0", "")
+	if rec := sendAs(t, TrashAPI, "bob", "POST", TrashPath+"0"+restoreSuffix, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("POST restore as bob: got status code %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	if rec := sendAs(t, TrashAPI, "alice", "POST", TrashPath+"0"+restoreSuffix, ""); rec.Code != http.StatusOK {
+		t.Errorf("POST restore as alice: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+}
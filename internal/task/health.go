@@ -0,0 +1,69 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// HealthzPath specifies the path of the liveness probe.
+const HealthzPath = "/healthz"
+
+// ReadyzPath specifies the path of the readiness probe.
+const ReadyzPath = "/readyz"
+
+// errShuttingDown is reported by the readiness probe during the shutdown.
+var errShuttingDown = errors.New("shutting down")
+
+// draining is set when the server stops accepting new requests.
+var draining atomic.Bool
+
+// Drain makes the readiness probe fail, so no new requests are routed
+// to the server while it shuts down.
+func Drain() {
+	draining.Store(true)
+}
+
+// Flush writes all changes of the tasks to the storage.
+func Flush() error {
+	return tasks.Flush()
+}
+
+// writeStatus writes the status of a probe to the response.
+func writeStatus(w http.ResponseWriter, err error) {
+	res := struct {
+		Status string `json:"status"`
+		Error  string `json:"error,omitempty"`
+	}{
+		Status: "ok",
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err != nil {
+		res.Status, res.Error = "unavailable", err.Error()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(res)
+}
+
+// HealthAPI is a handler function of the liveness probe. It fails
+// if the storage is unhealthy, as the server can't recover without
+// a restart.
+func HealthAPI(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, storage().PingContext(r.Context()))
+}
+
+// ReadyAPI is a handler function of the readiness probe. It fails
+// if the storage is unhealthy or the server is shutting down.
+func ReadyAPI(w http.ResponseWriter, r *http.Request) {
+	err := storage().PingContext(r.Context())
+	if err == nil && draining.Load() {
+		err = errShuttingDown
+	}
+	writeStatus(w, err)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestProbeReq(t *testing.T) {
+	defer draining.Store(false)
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	m, err := NewFileManager(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks = m
+
+	check := func(name string, h http.HandlerFunc, want int, status string) {
+		rec := serve(t, h, "GET", "/")
+		if err := checkStatusCode(rec.Code, want); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		var res struct{ Status string }
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Status != status {
+			t.Errorf("%s: got status %q (%v); want %q", name, res.Status, err, status)
+		}
+	}
+	check("healthz", HealthAPI, http.StatusOK, "ok")
+	check("readyz", ReadyAPI, http.StatusOK, "ok")
+
+	Drain()
+	check("healthz while draining", HealthAPI, http.StatusOK, "ok")
+	check("readyz while draining", ReadyAPI, http.StatusServiceUnavailable, "unavailable")
+	draining.Store(false)
+
+	// The storage fails once its file is gone.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	check("healthz of failed storage", HealthAPI, http.StatusServiceUnavailable, "unavailable")
+	check("readyz of failed storage", ReadyAPI, http.StatusServiceUnavailable, "unavailable")
+
+	// Flush writes the file again.
+	if err := Flush(); err != nil {
+		t.Fatalf("Flush(): unexpected error: %v", err)
+	}
+	check("readyz after flush", ReadyAPI, http.StatusOK, "ok")
+}
@@ -0,0 +1,300 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// anonymous is the actor of requests which aren't authenticated.
+const anonymous = "anonymous"
+
+// system is the actor of the changes made by the server itself.
+const system = "system"
+
+// Revision is an immutable record of a single change of a task.
+type Revision struct {
+	Rev     int      `json:"rev"` // Sequence number, increasing across all tasks.
+	TaskID  int      `json:"taskId"`
+	Op      string   `json:"op"` // One of create, update, delete, restore or purge.
+	Time    int64    `json:"time"`
+	Actor   string   `json:"actor"`
+	Changes []Change `json:"changes,omitempty"`
+	Task    *Task    `json:"task,omitempty"` // State of the task after the change.
+}
+
+// Change describes a change of a single task field.
+type Change struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// change describes a change of a task from the state before to the state after.
+// Before is nil for a created task and after is nil for a purged task.
+type change struct {
+	before, after *Task
+}
+
+// id returns the id of the changed task.
+func (c change) id() int {
+	if c.after != nil {
+		return c.after.ID
+	}
+	return c.before.ID
+}
+
+// op returns the name of the operation which made the change.
+func (c change) op() string {
+	switch {
+	case c.before == nil:
+		return "create"
+	case c.after == nil:
+		return "purge"
+	case c.before.Deleted == 0 && c.after.Deleted != 0:
+		return "delete"
+	case c.before.Deleted != 0 && c.after.Deleted == 0:
+		return "restore"
+	}
+	return "update"
+}
+
+// snapshot returns a copy of c which isn't affected by
+// later modifications of the changed tasks.
+func (c change) snapshot() change {
+	if c.before != nil {
+		t := *c.before
+		c.before = &t
+	}
+	if c.after != nil {
+		t := *c.after
+		c.after = &t
+	}
+	return c
+}
+
+// diff returns the changes of the task fields between t1 and t2.
+// A nil task is treated as a task with zero fields.
+func diff(t1, t2 *Task) []Change {
+	var v1, v2 reflect.Value
+	if t1 != nil {
+		v1 = reflect.ValueOf(*t1)
+	} else {
+		v1 = reflect.ValueOf(Task{})
+	}
+	if t2 != nil {
+		v2 = reflect.ValueOf(*t2)
+	} else {
+		v2 = reflect.ValueOf(Task{})
+	}
+
+	var r []Change
+	for i := 0; i < v1.NumField(); i++ {
+		f := v1.Type().Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "id" || name == "-" {
+			continue
+		}
+		if o, n := v1.Field(i).Interface(), v2.Field(i).Interface(); !reflect.DeepEqual(o, n) {
+			r = append(r, Change{Field: name, Old: o, New: n})
+		}
+	}
+	return r
+}
+
+// history stores revisions of tasks. It is safe for concurrent use.
+type history struct {
+	mu    sync.RWMutex
+	revs  map[int][]*Revision
+	seq   int
+	epoch int64     // Time of the creation, which tells apart the sequences of different histories.
+	log   io.Writer // Receives the recorded revisions as JSON lines, if not nil.
+}
+
+// newHistory returns a new empty history.
+func newHistory() *history {
+	return &history{revs: make(map[int][]*Revision), epoch: time.Now().UnixNano()}
+}
+
+var revisions = newHistory()
+
+// OpenHistory loads the revisions from the file at path and appends
+// the revisions recorded later to it. The file is created if it doesn't
+// exist. It holds a revision per line in JSON.
+func OpenHistory(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	h := newHistory()
+	d := json.NewDecoder(f)
+	for {
+		rev := new(Revision)
+		if err := d.Decode(rev); err == io.EOF {
+			break
+		} else if err != nil {
+			f.Close()
+			return fmt.Errorf("task: %s: %v", path, err)
+		}
+		h.revs[rev.TaskID] = append(h.revs[rev.TaskID], rev)
+		if rev.Rev > h.seq {
+			h.seq = rev.Rev
+		}
+	}
+	h.log = f
+	revisions = h
+	return nil
+}
+
+// record records the changes made by actor as new revisions.
+func (h *history) record(actor string, changes ...change) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, c := range changes {
+		h.seq++
+		rev := &Revision{
+			Rev:     h.seq,
+			TaskID:  c.id(),
+			Op:      c.op(),
+			Time:    now().Unix(),
+			Actor:   actor,
+			Changes: diff(c.before, c.after),
+		}
+		rev.Task = c.snapshot().after // Copy the task so the revision is immutable.
+		h.revs[rev.TaskID] = append(h.revs[rev.TaskID], rev)
+		if h.log != nil {
+			if err := json.NewEncoder(h.log).Encode(rev); err != nil {
+				slog.Error("cannot write revision", "rev", rev.Rev, "err", err)
+			}
+		}
+	}
+}
+
+// task returns all revisions of task with given id.
+func (h *history) task(id int) []*Revision {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return append([]*Revision(nil), h.revs[id]...)
+}
+
+// since returns the latest revisions of the tasks changed after the
+// revision rev ordered by their sequence numbers, and the sequence
+// number of the latest revision of all tasks.
+func (h *history) since(rev int) ([]*Revision, int) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var r []*Revision
+	for _, revs := range h.revs {
+		if last := revs[len(revs)-1]; last.Rev > rev {
+			r = append(r, last)
+		}
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].Rev < r[j].Rev })
+	return r, h.seq
+}
+
+// latest returns the latest state of task with given id
+// recorded in its revisions, and false if it has none.
+func (h *history) latest(id int) (*Task, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	revs := h.revs[id]
+	for i := len(revs) - 1; i >= 0; i-- {
+		if revs[i].Task != nil {
+			return revs[i].Task, true
+		}
+	}
+	return nil, false
+}
+
+// find returns the revision rev of task with given id.
+func (h *history) find(id, rev int) (*Revision, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, r := range h.revs[id] {
+		if r.Rev == rev {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// actor returns the actor of the request which is the authenticated user.
+func actor(r *http.Request) string {
+	if o := owner(r); o != "" {
+		return o
+	}
+	return anonymous
+}
+
+// commit records the changes made by the request in the history
+// and in the undo journal of the request session.
+func commit(r *http.Request, changes ...change) {
+	revisions.record(actor(r), changes...)
+	if id := session(r); id != "" {
+		s := make([]change, len(changes))
+		for i, c := range changes {
+			s[i] = c.snapshot()
+		}
+		sessions.record(id, s)
+	}
+}
+
+// readHistory handles requests for the reads of all revisions of a specific task.
+func readHistory(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	t, ok := revisions.latest(id)
+	if !ok {
+		return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
+	}
+	if err := authorize(r, t, RoleViewer); err != nil {
+		return err
+	}
+	revs := revisions.task(id)
+	res := struct {
+		Revisions []*Revision `json:"revisions"`
+	}{
+		revs,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// revert handles requests for reverting a specific task to one of its
+// previous revisions. The revision is given by the rev query parameter.
+func revert(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	n, err := strconv.Atoi(r.URL.Query().Get("rev"))
+	if err != nil {
+		return badRequestError(err)
+	}
+	rev, ok := revisions.find(id, n)
+	if !ok || rev.Task == nil {
+		return notFoundError(fmt.Errorf("task id: %d revision: %d doesn't exists", id, n))
+	}
+	if err := authorize(r, rev.Task, RoleEditor); err != nil {
+		return err
+	}
+	t := *rev.Task
+	t.Deleted = 0
+	return updateTask(r, &t)
+}
@@ -0,0 +1,215 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDiff(t *testing.T) {
+	for _, test := range []struct {
+		t1, t2 *Task
+		want   []Change
+	}{
+		{&testTasks[0], &testTasks[0], nil},
+		{nil, &Task{ID: 1, Title: "Task 1"}, []Change{{"title", "", "Task 1"}}},
+		{
+			&Task{ID: 1, Title: "Task 1", Priority: 1},
+			&Task{ID: 1, Title: "Task 1", Priority: 2, Done: true},
+			[]Change{{"priority", byte(1), byte(2)}, {"done", false, true}},
+		},
+	} {
+		if got := diff(test.t1, test.t2); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("diff(%v, %v) = %v; want %v", test.t1, test.t2, got, test.want)
+		}
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	h := newHistory()
+	t0, t1 := &Task{ID: 0, Title: "Task 0"}, &Task{ID: 1, Title: "Task 1"}
+	h.record("alice", change{nil, t0}, change{nil, t1})
+	h.record("alice", change{t0, &Task{ID: 0, Title: "Updated Task 0"}})
+	h.record("alice", change{t1, nil})
+	for _, test := range []struct {
+		rev  int
+		want []int // Sequence numbers of the returned revisions.
+	}{
+		{0, []int{3, 4}},
+		{2, []int{3, 4}},
+		{3, []int{4}},
+		{4, nil},
+	} {
+		revs, seq := h.since(test.rev)
+		var got []int
+		for _, r := range revs {
+			got = append(got, r.Rev)
+		}
+		if !reflect.DeepEqual(got, test.want) || seq != 4 {
+			t.Errorf("since(%d) = %v, %d; want %v, 4", test.rev, got, seq, test.want)
+		}
+	}
+}
+
+// send sends a request with the given body on behalf of user to RestAPI.
+func send(t *testing.T, method, path, user, body string) *httptest.ResponseRecorder {
+	rec := sendAs(t, RestAPI, user, method, path, body)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HTTP request %s %s: got status code %d; want %d\nRecieve body: %q", method, path, rec.Code, http.StatusOK, rec.Body)
+	}
+	return rec
+}
+
+func TestHistoryReq(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) }
+	tasks = NewManager()
+	revisions = newHistory()
+
+	grants = newACL()
+
+	send(t, "POST", Path, "alice", `{"title":"Task 0"}`)
+	send(t, "POST", Path+"0/share", "alice", `{"user":"bob","role":"editor"}`)
+	send(t, "PUT", Path+"0", "bob", `{"id":0,"title":"Task 0","priority":2,"owner":"alice"}`)
+	send(t, "DELETE", Path+"0", "alice", "")
+
+	rec := send(t, "GET", Path+"0/history", "bob", "")
+	res := struct {
+		Revisions []*Revision `json:"revisions"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range res.Revisions {
+		got = append(got, strconv.Itoa(r.Rev)+" "+r.Op+" "+r.Actor)
+	}
+	if want := []string{"1 create alice", "2 update bob", "3 delete alice"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GET %s0/history\n got %q\nwant %q", Path, got, want)
+	}
+	if got, want := res.Revisions[1].Changes, []Change{{"priority", 0.0, 2.0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GET %s0/history: got update changes %v; want %v", Path, got, want)
+	}
+	if got, want := res.Revisions[2].Time, now().Unix(); got != want {
+		t.Errorf("GET %s0/history: got delete time %d; want %d", Path, got, want)
+	}
+}
+
+func TestRevertReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+
+	send(t, "POST", Path, "", `{"title":"Task 0"}`)
+	send(t, "PUT", Path+"0", "", `{"id":0,"title":"Updated Task 0","note":"Note"}`)
+	send(t, "PUT", Path+"0", "", `{"id":0,"title":"Updated Task 0","done":true}`)
+	send(t, "POST", Path+"0/revert?rev=2", "", "")
+
+	want := &Task{ID: 0, Title: "Updated Task 0", Note: "Note"}
+	if got, _ := tasks.Find(0); !reflect.DeepEqual(got, want) {
+		t.Errorf("revert to revision 2\n got %v\nwant %v", got, want)
+	}
+	revs := revisions.task(0)
+	if got := revs[len(revs)-1]; got.Op != "update" || got.Actor != anonymous {
+		t.Errorf("revert recorded revision %+v; want update by %s", got, anonymous)
+	}
+}
+
+func TestHistoryReqError(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	send(t, "POST", Path, "", `{"title":"Task 0"}`)
+	send(t, "POST", Path, "", `{"title":"Task 1"}`)
+	send(t, "DELETE", Path+"1", "", "")
+
+	for _, test := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", Path + "5/history", http.StatusNotFound},
+		{"GET", Path + "wrongID/history", http.StatusBadRequest},
+		{"POST", Path + "0/revert?rev=5", http.StatusNotFound},
+		{"POST", Path + "0/revert?rev=x", http.StatusBadRequest},
+		{"POST", Path + "1/revert?rev=2", http.StatusNotFound},
+		{"GET", Path + "0/unknown", http.StatusNotFound},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %v: %v", req, err)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+	}
+}
+
+func TestHistoryReqAccess(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	grants = newACL()
+	revisions.record("alice", change{nil, &Task{ID: 0, Title: "Task 0", Owner: "alice"}})
+	revisions.record("bob", change{&Task{ID: 0, Title: "Task 0", Owner: "alice"}, &Task{ID: 0, Title: "Task 0", Owner: "bob"}})
+
+	for _, test := range []struct {
+		user string
+		code int
+	}{
+		{"bob", http.StatusOK},
+		{"alice", http.StatusNotFound},
+	} {
+		rec := sendAs(t, RestAPI, test.user, "GET", Path+"0/history", "")
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("GET %s0/history as %s: %v\nRecieve body: %q", Path, test.user, err, rec.Body)
+		}
+	}
+}
+
+func TestOpenHistory(t *testing.T) {
+	defer func(h *history) { revisions = h }(revisions)
+	path := filepath.Join(t.TempDir(), "todo.json.history")
+	if err := OpenHistory(path); err != nil {
+		t.Fatalf("OpenHistory(%q): unexpected error: %v", path, err)
+	}
+	t0 := &Task{ID: 0, Title: "Task 0", Date: 1426691590}
+	revisions.record("alice", change{nil, t0}, change{nil, &Task{ID: 1, Title: "Task 1"}})
+	revisions.record("bob", change{t0, nil})
+	want := append(revisions.task(0), revisions.task(1)...)
+
+	if err := OpenHistory(path); err != nil {
+		t.Fatalf("OpenHistory(%q) again: unexpected error: %v", path, err)
+	}
+	got := append(revisions.task(0), revisions.task(1)...)
+	if len(got) != len(want) {
+		t.Fatalf("OpenHistory(%q) loaded %d revisions; want %d", path, len(got), len(want))
+	}
+	for i := range got {
+		if got[i].Rev != want[i].Rev || got[i].Actor != want[i].Actor || got[i].Op != want[i].Op || !reflect.DeepEqual(got[i].Task, want[i].Task) {
+			t.Errorf("OpenHistory(%q) loaded revision %+v; want %+v", path, got[i], want[i])
+		}
+	}
+	revisions.record("carol", change{nil, &Task{ID: 2, Title: "Task 2"}})
+	if revs := revisions.task(2); revs[0].Rev != 4 {
+		t.Errorf("got revision %d after the loaded ones; want 4", revs[0].Rev)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := OpenHistory(path); err == nil {
+		t.Errorf("OpenHistory(%q) of a malformed file: expected error", path)
+	}
+}
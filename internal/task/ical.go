@@ -0,0 +1,444 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// CalendarPath specifies the path of the iCalendar feed of the tasks.
+const CalendarPath = "/calendar.ics"
+
+// Layouts of the iCalendar dates and times.
+const (
+	icalDate      = "20060102"
+	icalDateTime  = "20060102T150405Z"
+	icalLocalTime = "20060102T150405"
+)
+
+// Beginning and end of the iCalendar objects.
+const (
+	icalBegin = "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//mrekucci//todo//EN\r\nCALSCALE:GREGORIAN\r\n"
+	icalEnd   = "END:VCALENDAR\r\n"
+)
+
+// icalPriorities maps the priorities to the iCalendar priorities.
+var icalPriorities = map[byte]int{PriorityHigh: 1, PriorityMedium: 5, PriorityLow: 9}
+
+// icalEscaper escapes the iCalendar text values.
+var icalEscaper = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\r", "", "\n", `\n`)
+
+// CalendarUID returns the UID of the task in the calendars. It is the UID
+// the task was imported with, or one derived from its ID which never changes.
+func CalendarUID(t *Task) string {
+	if t.UID != "" {
+		return t.UID
+	}
+	return fmt.Sprintf("task-%d@todo", t.ID)
+}
+
+// isDerivedUID reports whether uid has the form of
+// the UIDs derived from the IDs of the tasks.
+func isDerivedUID(uid string) bool {
+	var id int
+	n, _ := fmt.Sscanf(uid, "task-%d@todo", &id)
+	return n == 1 && uid == fmt.Sprintf("task-%d@todo", id)
+}
+
+// FormatICal returns the task as an iCalendar component, which is either
+// VTODO or VEVENT, in the RFC 5545 format with the CRLF line endings. The
+// date is written as DUE of the VTODO and DTSTART of the VEVENT, as a day
+// in the time zone of the task if it's all-day and in UTC otherwise. An
+// all-day VEVENT ends the next day. The tags and the contexts prefixed
+// with @ are written as CATEGORIES, the done state only to the VTODO.
+// The stamp is the time of the creation of the iCalendar object.
+func FormatICal(t *Task, component string, stamp time.Time) string {
+	var b strings.Builder
+	prop := func(name, value string) { b.WriteString(foldICal(name + ":" + value)) }
+	utc := func(sec int64) string { return time.Unix(sec, 0).UTC().Format(icalDateTime) }
+
+	prop("BEGIN", component)
+	prop("UID", icalEscaper.Replace(CalendarUID(t)))
+	prop("DTSTAMP", stamp.UTC().Format(icalDateTime))
+	if t.Created != 0 {
+		prop("CREATED", utc(t.Created))
+	}
+	prop("SUMMARY", icalEscaper.Replace(t.Title))
+	if t.Note != "" {
+		prop("DESCRIPTION", icalEscaper.Replace(t.Note))
+	}
+	date := "DUE"
+	if component == "VEVENT" {
+		date = "DTSTART"
+	}
+	switch {
+	case t.Date == 0:
+	case t.AllDay:
+		prop(date+";VALUE=DATE", t.Time().Format(icalDate))
+		if component == "VEVENT" {
+			prop("DTEND;VALUE=DATE", t.Time().AddDate(0, 0, 1).Format(icalDate))
+		}
+	default:
+		prop(date, utc(t.Date))
+	}
+	if p := icalPriorities[t.Priority]; p != 0 {
+		prop("PRIORITY", strconv.Itoa(p))
+	}
+	var categories []string
+	for _, tag := range t.Tags {
+		categories = append(categories, icalEscaper.Replace(tag))
+	}
+	for _, c := range t.Contexts {
+		categories = append(categories, icalEscaper.Replace("@"+c))
+	}
+	if len(categories) > 0 {
+		prop("CATEGORIES", strings.Join(categories, ","))
+	}
+	if component == "VEVENT" {
+		prop("TRANSP", "TRANSPARENT") // Tasks don't make the time busy.
+	} else {
+		status := "NEEDS-ACTION"
+		if t.Done {
+			status = "COMPLETED"
+		}
+		prop("STATUS", status)
+		if t.Done && t.Completed != 0 {
+			prop("COMPLETED", utc(t.Completed))
+		}
+	}
+	prop("END", component)
+	return b.String()
+}
+
+// foldICal returns the content line folded into lines of at most 75 octets
+// ended by CRLF. The UTF-8 sequences aren't split across the lines.
+func foldICal(line string) string {
+	var b strings.Builder
+	for max := 75; len(line) > max; max = 74 { // The continuation lines start with a space.
+		i := max
+		for !utf8.RuneStart(line[i]) {
+			i--
+		}
+		b.WriteString(line[:i])
+		b.WriteString("\r\n ")
+		line = line[i:]
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// ParseICal parses the iCalendar text with a single VTODO or VEVENT
+// component into a task. It is the reverse of FormatICal. The date-times
+// with the TZID parameter are taken in that time zone and the floating
+// ones in UTC. The VTODO without DUE is scheduled at its DTSTART.
+func ParseICal(text string) (*Task, error) {
+	parsed, err := readICal(strings.NewReader(text))
+	if err != nil {
+		return nil, err
+	}
+	if len(parsed) != 1 {
+		return nil, fmt.Errorf("got %d components; want a single VTODO or VEVENT", len(parsed))
+	}
+	return parsed[0].task, parsed[0].err
+}
+
+// icalLine is an unfolded iCalendar content line.
+type icalLine struct {
+	n    int // Number of the first folded line.
+	text string
+}
+
+// unfoldICal reads the unfolded content lines. The blank lines are skipped.
+func unfoldICal(r io.Reader) ([]icalLine, error) {
+	var lines []icalLine
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		l := strings.TrimSuffix(s.Text(), "\r")
+		switch {
+		case l == "":
+		case (l[0] == ' ' || l[0] == '\t') && len(lines) > 0:
+			lines[len(lines)-1].text += l[1:]
+		default:
+			lines = append(lines, icalLine{n, l})
+		}
+	}
+	return lines, s.Err()
+}
+
+// icalProp is a property of an iCalendar component.
+type icalProp struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// parseICalProp parses the content line into a property.
+func parseICalProp(line string) (icalProp, error) {
+	head, value, ok := cutUnquoted(line, ':')
+	if !ok {
+		return icalProp{}, fmt.Errorf("%q isn't a content line", line)
+	}
+	name, rest, more := cutUnquoted(head, ';')
+	p := icalProp{strings.ToUpper(name), make(map[string]string), value}
+	for more {
+		var param string
+		param, rest, more = cutUnquoted(rest, ';')
+		k, v, _ := strings.Cut(param, "=")
+		p.params[strings.ToUpper(k)] = strings.Trim(v, `"`)
+	}
+	return p, nil
+}
+
+// cutUnquoted slices s around the first sep which isn't in double quotes.
+func cutUnquoted(s string, sep byte) (before, after string, found bool) {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+// readICal reads the tasks from the VTODO and VEVENT components of the
+// iCalendar object. The other components, like the VALARM ones nested
+// in the tasks, are skipped.
+func readICal(r io.Reader) ([]parsedTask, error) {
+	lines, err := unfoldICal(r)
+	if err != nil {
+		return nil, err
+	}
+	var parsed []parsedTask
+	var comp *parsedTask
+	var kind string
+	var props []icalProp
+	nested := 0
+	for _, l := range lines {
+		p, err := parseICalProp(l.text)
+		if comp == nil {
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", l.n, err)
+			}
+			if v := strings.ToUpper(p.value); p.name == "BEGIN" && (v == "VTODO" || v == "VEVENT") {
+				comp, kind, props = &parsedTask{line: l.n}, v, nil
+			}
+			continue
+		}
+		switch {
+		case err != nil:
+			if comp.err == nil {
+				comp.err = fmt.Errorf("line %d: %v", l.n, err)
+			}
+		case p.name == "BEGIN":
+			nested++
+		case p.name == "END" && nested > 0:
+			nested--
+		case p.name == "END":
+			if comp.err == nil {
+				comp.task, comp.err = icalTask(kind, props)
+			}
+			parsed = append(parsed, *comp)
+			comp = nil
+		case nested == 0:
+			props = append(props, p)
+		}
+	}
+	if comp != nil {
+		return nil, fmt.Errorf("line %d: %s isn't ended", comp.line, kind)
+	}
+	return parsed, nil
+}
+
+// icalTask returns the task with the properties of the component.
+func icalTask(kind string, props []icalProp) (*Task, error) {
+	t := new(Task)
+	var due, start *icalProp
+	for i, p := range props {
+		switch p.name {
+		case "UID":
+			t.UID = unescapeICal(p.value)
+		case "SUMMARY":
+			t.Title = unescapeICal(p.value)
+		case "DESCRIPTION":
+			t.Note = unescapeICal(p.value)
+		case "PRIORITY":
+			n, err := strconv.Atoi(p.value)
+			if err != nil || n < 0 || n > 9 {
+				return nil, fmt.Errorf("PRIORITY: %q isn't between 0 and 9", p.value)
+			}
+			t.Priority = icalPriority(n)
+		case "STATUS":
+			t.Done = t.Done || strings.EqualFold(p.value, "COMPLETED")
+		case "COMPLETED", "CREATED":
+			d, _, _, err := parseICalTime(p)
+			if err != nil {
+				return nil, err
+			}
+			if p.name == "CREATED" {
+				t.Created = d.Unix()
+			} else {
+				t.Completed, t.Done = d.Unix(), true
+			}
+		case "CATEGORIES":
+			for _, c := range splitICal(p.value) {
+				if c = unescapeICal(c); len(c) > 1 && c[0] == '@' {
+					t.Contexts = appendNew(t.Contexts, c[1:])
+				} else if c != "" {
+					t.Tags = appendNew(t.Tags, c)
+				}
+			}
+		case "DUE":
+			due = &props[i]
+		case "DTSTART":
+			start = &props[i]
+		}
+	}
+	if kind == "VEVENT" || due == nil {
+		due = start
+	}
+	if due != nil {
+		d, allDay, zone, err := parseICalTime(*due)
+		if err != nil {
+			return nil, err
+		}
+		t.Date, t.AllDay, t.TimeZone = d.Unix(), allDay, zone
+	}
+	return t, nil
+}
+
+// icalPriority returns the priority of the iCalendar priority,
+// where 1 is the highest, 9 the lowest and 0 undefined.
+func icalPriority(n int) byte {
+	switch {
+	case n == 0:
+		return PriorityNone
+	case n < 5:
+		return PriorityHigh
+	case n == 5:
+		return PriorityMedium
+	}
+	return PriorityLow
+}
+
+// parseICalTime parses the date or date-time value of the property.
+// It returns the time, whether it's a date and the name of its time
+// zone if it isn't in UTC.
+func parseICalTime(p icalProp) (d time.Time, date bool, zone string, err error) {
+	loc := time.UTC
+	if tzid := p.params["TZID"]; tzid != "" {
+		if loc, err = loadLocation(tzid); err != nil || tzid == "Local" {
+			return time.Time{}, false, "", fmt.Errorf("%s: unknown time zone %q", p.name, tzid)
+		}
+		if loc != time.UTC {
+			zone = loc.String()
+		}
+	}
+	switch {
+	case p.params["VALUE"] == "DATE" || len(p.value) == len(icalDate):
+		d, err = time.ParseInLocation(icalDate, p.value, loc)
+		date = true
+	case strings.HasSuffix(p.value, "Z"):
+		d, err = time.Parse(icalDateTime, p.value)
+		zone = ""
+	default:
+		d, err = time.ParseInLocation(icalLocalTime, p.value, loc)
+	}
+	if err != nil {
+		return time.Time{}, false, "", fmt.Errorf("%s: %q isn't an iCalendar date or date-time", p.name, p.value)
+	}
+	return d, date, zone, nil
+}
+
+// splitICal splits the list value at the commas which aren't escaped.
+func splitICal(v string) []string {
+	var values []string
+	start := 0
+	for i := 0; i < len(v); i++ {
+		switch v[i] {
+		case '\\':
+			i++
+		case ',':
+			values = append(values, v[start:i])
+			start = i + 1
+		}
+	}
+	return append(values, v[start:])
+}
+
+// unescapeICal returns the iCalendar text value without the escapes.
+func unescapeICal(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+1 < len(v) {
+			i++
+			if v[i] == 'n' || v[i] == 'N' {
+				b.WriteByte('\n')
+				continue
+			}
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+// CalendarAPI is a handler function that serves the scheduled tasks as an
+// iCalendar feed which can be subscribed to in the calendar apps. The tasks
+// are filtered and sorted by the same query parameters as in RestAPI. They
+// are written as events, or as to-dos with the component=VTODO parameter.
+func CalendarAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case "GET", "HEAD":
+		err = readCalendar(w, r)
+	default:
+		err = &errRequest{fmt.Errorf("%s doesn't implemented", r.Method), http.StatusMethodNotAllowed}
+	}
+	errorHandler(w, r, err)
+}
+
+// readCalendar handles requests for the iCalendar feed of the tasks.
+func readCalendar(w http.ResponseWriter, r *http.Request) error {
+	component := strings.ToUpper(r.URL.Query().Get("component"))
+	switch component {
+	case "":
+		component = "VEVENT"
+	case "VEVENT", "VTODO":
+	default:
+		return badRequestError(fmt.Errorf("unknown component %q, want VEVENT or VTODO", component))
+	}
+	t, err := selectTasks(r)
+	if err != nil {
+		return err
+	}
+	t = filters["isScheduled"].Tasks(t)
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	bw.WriteString(icalBegin)
+	bw.WriteString("X-WR-CALNAME:todo\r\n")
+	stamp := now()
+	for _, task := range t {
+		if _, err := bw.WriteString(FormatICal(task, component, stamp)); err != nil {
+			return err
+		}
+	}
+	bw.WriteString(icalEnd)
+	return bw.Flush()
+}
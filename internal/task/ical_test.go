@@ -0,0 +1,280 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestICal(t *testing.T) {
+	stamp := time.Date(2015, 3, 18, 15, 13, 10, 0, time.UTC)
+	for _, test := range []struct {
+		task Task
+		ical string
+	}{
+		{Task{Title: "Buy milk", UID: "task-0@todo"},
+			"BEGIN:VTODO\r\nUID:task-0@todo\r\nDTSTAMP:20150318T151310Z\r\nSUMMARY:Buy milk\r\nSTATUS:NEEDS-ACTION\r\nEND:VTODO\r\n"},
+		{Task{Title: "Pay rent; now, please", Note: "Line 1\nC:\\rent", Date: unix(t, "2015-03-20T09:00:00+01:00"), Priority: PriorityHigh,
+			Tags: []string{"finance"}, Contexts: []string{"home"}, UID: "a1b2c3"},
+			"BEGIN:VTODO\r\nUID:a1b2c3\r\nDTSTAMP:20150318T151310Z\r\nSUMMARY:Pay rent\\; now\\, please\r\nDESCRIPTION:Line 1\\nC:\\\\rent\r\n" +
+				"DUE:20150320T080000Z\r\nPRIORITY:1\r\nCATEGORIES:finance,@home\r\nSTATUS:NEEDS-ACTION\r\nEND:VTODO\r\n"},
+		{Task{Title: "Review plan", Done: true, Priority: PriorityLow, Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true,
+			Created: unix(t, "2015-03-10T08:00:00Z"), Completed: unix(t, "2015-03-18T10:30:00Z"), UID: "task-2@todo"},
+			"BEGIN:VTODO\r\nUID:task-2@todo\r\nDTSTAMP:20150318T151310Z\r\nCREATED:20150310T080000Z\r\nSUMMARY:Review plan\r\n" +
+				"DUE;VALUE=DATE:20150320\r\nPRIORITY:9\r\nSTATUS:COMPLETED\r\nCOMPLETED:20150318T103000Z\r\nEND:VTODO\r\n"},
+	} {
+		got := FormatICal(&test.task, "VTODO", stamp)
+		if got != test.ical {
+			t.Errorf("FormatICal(%v) = %q; want %q", test.task, got, test.ical)
+		}
+		task, err := ParseICal(got)
+		if err != nil || !reflect.DeepEqual(*task, test.task) {
+			t.Errorf("ParseICal(%q) = %v, %v; want %v, <nil>", got, task, err, test.task)
+		}
+	}
+}
+
+func TestFormatICalEvent(t *testing.T) {
+	stamp := time.Date(2015, 3, 18, 15, 13, 10, 0, time.UTC)
+	for _, test := range []struct {
+		task Task
+		ical string
+	}{
+		{Task{ID: 7, Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00+01:00"), AllDay: true, TimeZone: "Europe/Bratislava", Done: true},
+			"BEGIN:VEVENT\r\nUID:task-7@todo\r\nDTSTAMP:20150318T151310Z\r\nSUMMARY:Pay rent\r\n" +
+				"DTSTART;VALUE=DATE:20150320\r\nDTEND;VALUE=DATE:20150321\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n"},
+		{Task{ID: 8, Title: "Call mom", Date: unix(t, "2015-03-20T21:45:00-04:00"), TimeZone: "America/New_York"},
+			"BEGIN:VEVENT\r\nUID:task-8@todo\r\nDTSTAMP:20150318T151310Z\r\nSUMMARY:Call mom\r\n" +
+				"DTSTART:20150321T014500Z\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n"},
+	} {
+		if got := FormatICal(&test.task, "VEVENT", stamp); got != test.ical {
+			t.Errorf("FormatICal(%v, VEVENT) = %q; want %q", test.task, got, test.ical)
+		}
+	}
+}
+
+func TestFoldICal(t *testing.T) {
+	for _, line := range []string{
+		"SUMMARY:Buy milk",
+		"SUMMARY:" + strings.Repeat("x", 67),
+		"SUMMARY:" + strings.Repeat("x", 68),
+		"DESCRIPTION:" + strings.Repeat("x", 500),
+		"SUMMARY:" + strings.Repeat("ž", 100),
+		"SUMMARY:x" + strings.Repeat("日本語", 40),
+	} {
+		got := foldICal(line)
+		if !strings.HasSuffix(got, "\r\n") {
+			t.Errorf("foldICal(%.20q...) = %q; doesn't end with CRLF", line, got)
+			continue
+		}
+		lines := strings.Split(strings.TrimSuffix(got, "\r\n"), "\r\n")
+		for i, l := range lines {
+			if len(l) > 75 {
+				t.Errorf("foldICal(%.20q...): line %d is %d octets long; want at most 75", line, i, len(l))
+			}
+			if i > 0 && (l == " " || l[0] != ' ') {
+				t.Errorf("foldICal(%.20q...): continuation line %d is %q", line, i, l)
+			}
+			if !utf8.ValidString(l) {
+				t.Errorf("foldICal(%.20q...): line %d splits a UTF-8 sequence", line, i)
+			}
+		}
+		unfolded, err := unfoldICal(strings.NewReader(got))
+		if err != nil || len(unfolded) != 1 || unfolded[0].text != line {
+			t.Errorf("unfoldICal(foldICal(%.20q...)) = %v, %v; want the line", line, unfolded, err)
+		}
+	}
+}
+
+func TestParseICal(t *testing.T) {
+	for _, test := range []struct {
+		ical string
+		task Task
+		ok   bool
+	}{
+		{"BEGIN:VTODO\nSUMMARY:Pay\n  rent\nDUE;TZID=Europe/Bratislava:20150320T090000\nEND:VTODO",
+			Task{Title: "Pay rent", Date: unix(t, "2015-03-20T09:00:00+01:00"), TimeZone: "Europe/Bratislava"}, true},
+		{"BEGIN:VTODO\r\nSUMMARY:Pay rent\r\nDUE;TZID=\"America/New_York\";VALUE=DATE:20150320\r\nEND:VTODO\r\n",
+			Task{Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00-04:00"), AllDay: true, TimeZone: "America/New_York"}, true},
+		{"BEGIN:VTODO\nSUMMARY:Pay rent\nDTSTART:20150320T090000\nPRIORITY:3\nEND:VTODO",
+			Task{Title: "Pay rent", Date: unix(t, "2015-03-20T09:00:00Z"), Priority: PriorityHigh}, true},
+		{"BEGIN:VEVENT\nSUMMARY:Pay rent\nDTSTART:20150320\nDTEND:20150321\nDUE:20150401\nPRIORITY:6\nEND:VEVENT",
+			Task{Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true, Priority: PriorityLow}, true},
+		{"BEGIN:VTODO\nsummary:Pay rent\nCATEGORIES:a\\,b,,@,@home\nBEGIN:VALARM\nSUMMARY:Alarm\nEND:VALARM\nX-UNKNOWN;P=\"a:b\":c\nEND:VTODO",
+			Task{Title: "Pay rent", Tags: []string{"a,b", "@"}, Contexts: []string{"home"}}, true},
+		{"BEGIN:VTODO\nSUMMARY:Pay rent\nDUE;TZID=Mars/Olympus:20150320T090000\nEND:VTODO", Task{}, false},
+		{"BEGIN:VTODO\nSUMMARY:Pay rent\nDUE:tomorrow\nEND:VTODO", Task{}, false},
+		{"BEGIN:VTODO\nSUMMARY:Pay rent\nPRIORITY:10\nEND:VTODO", Task{}, false},
+		{"BEGIN:VTODO\nSUMMARY Pay rent\nEND:VTODO", Task{}, false},
+		{"BEGIN:VTODO\nSUMMARY:Pay rent", Task{}, false},
+		{"BEGIN:VTODO\nEND:VTODO\nBEGIN:VTODO\nEND:VTODO", Task{}, false},
+		{"BEGIN:VCALENDAR\nEND:VCALENDAR", Task{}, false},
+	} {
+		got, err := ParseICal(test.ical)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseICal(%q): got error %v; want error: %t", test.ical, err, !test.ok)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*got, test.task) {
+			t.Errorf("ParseICal(%q) = %v; want %v", test.ical, *got, test.task)
+		}
+	}
+}
+
+func TestCalendarReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	defer func(fn func() time.Time) { now = fn }(now)
+	now = func() time.Time { return time.Date(2015, 3, 18, 15, 13, 10, 0, time.UTC) }
+
+	body := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Example//EN\r\n" +
+		"BEGIN:VTODO\r\nUID:abc@example.com\r\nSUMMARY:Pay rent\r\nDUE;VALUE=DATE:20150320\r\nSTATUS:COMPLETED\r\nEND:VTODO\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:Europe/Bratislava\r\nBEGIN:STANDARD\r\nDTSTART:19701025T030000\r\nEND:STANDARD\r\nEND:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\nUID:def@example.com\r\nSUMMARY:Call mom\r\nDTSTART;TZID=Europe/Bratislava:20150319T180000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VTODO\r\nSUMMARY:Buy milk\r\nEND:VTODO\r\n" +
+		"END:VCALENDAR\r\n"
+	req, err := http.NewRequest("POST", ImportPath, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/calendar; charset=utf-8")
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s: %v\nRecieve body: %q", ImportPath, err, rec.Body)
+	}
+	var res struct {
+		Applied bool           `json:"applied"`
+		Results []importResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("POST %s: cannot decode the response: %v", ImportPath, err)
+	}
+	if want := []importResult{{Line: 4, ID: 0}, {Line: 16, ID: 1}, {Line: 21, ID: 2}}; !res.Applied || !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("POST %s: got %v, %v; want true, %v", ImportPath, res.Applied, res.Results, want)
+	}
+
+	for _, test := range []struct {
+		query string
+		code  int
+		uids  []string
+	}{
+		{"", http.StatusOK, []string{"abc@example.com", "def@example.com"}},
+		{"?sortBy=dateAsc&component=vtodo", http.StatusOK, []string{"def@example.com", "abc@example.com"}},
+		{"?filter=isNotDone", http.StatusOK, []string{"def@example.com"}},
+		{"?component=VJOURNAL", http.StatusBadRequest, nil},
+	} {
+		req, err := http.NewRequest("GET", CalendarPath+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		CalendarAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("GET %s%s: %v\nRecieve body: %q", CalendarPath, test.query, err, rec.Body)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		if got, want := rec.Header().Get("Content-Type"), "text/calendar; charset=utf-8"; got != want {
+			t.Errorf("GET %s%s: got content type %q; want %q", CalendarPath, test.query, got, want)
+		}
+		got := rec.Body.String()
+		if !strings.HasPrefix(got, "BEGIN:VCALENDAR\r\n") || !strings.HasSuffix(got, "END:VCALENDAR\r\n") {
+			t.Errorf("GET %s%s: got body %q; want a VCALENDAR", CalendarPath, test.query, got)
+		}
+		var uids []string
+		for _, l := range strings.Split(got, "\r\n") {
+			if uid, ok := strings.CutPrefix(l, "UID:"); ok {
+				uids = append(uids, uid)
+			}
+		}
+		if !reflect.DeepEqual(uids, test.uids) {
+			t.Errorf("GET %s%s: got UIDs %v; want %v", CalendarPath, test.query, uids, test.uids)
+		}
+		component := "BEGIN:VEVENT"
+		if strings.Contains(test.query, "vtodo") {
+			component = "BEGIN:VTODO"
+		}
+		if n := strings.Count(got, component); n != len(test.uids) {
+			t.Errorf("GET %s%s: got %d %s components; want %d", CalendarPath, test.query, n, component, len(test.uids))
+		}
+	}
+
+	req, err = http.NewRequest("POST", CalendarPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	CalendarAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusMethodNotAllowed); err != nil {
+		t.Errorf("POST %s: %v", CalendarPath, err)
+	}
+}
+
+func TestCalendarImportFeedReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+
+	if err := addTasks(tasks, []Task{{ID: 0, Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true}}, t); err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("GET", CalendarPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	CalendarAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("GET %s: %v\nRecieve body: %q", CalendarPath, err, rec.Body)
+	}
+	feed := rec.Body.String()
+
+	// The derived UIDs of the feed are dropped, so the imported tasks get their own.
+	req, err = http.NewRequest("POST", ImportPath, bytes.NewBufferString(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/calendar")
+	rec = httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s of the feed: %v\nRecieve body: %q", ImportPath, err, rec.Body)
+	}
+	got := ptrToVal(tasks.All())
+	if len(got) != 2 || got[1].UID != "" || got[1].Title != "Pay rent" || got[1].Date != got[0].Date {
+		t.Fatalf("imported feed: got tasks %v; want a copy of task 0 without UID", got)
+	}
+	if a, b := CalendarUID(&got[0]), CalendarUID(&got[1]); a == b {
+		t.Errorf("imported feed: got tasks with the same UID %q", a)
+	}
+
+	// A UID of another task is rejected.
+	got[1].UID = "abc@example.com"
+	tasks.Update(&got[1])
+	body := "BEGIN:VCALENDAR\r\nBEGIN:VTODO\r\nUID:abc@example.com\r\nSUMMARY:Copy\r\nEND:VTODO\r\nEND:VCALENDAR\r\n"
+	req, err = http.NewRequest("POST", ImportPath, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/calendar")
+	rec = httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusBadRequest); err != nil {
+		t.Errorf("POST %s of a used UID: %v\nRecieve body: %q", ImportPath, err, rec.Body)
+	}
+	if n := tasks.Count(); n != 2 {
+		t.Errorf("got %d tasks after importing a used UID; want 2", n)
+	}
+}
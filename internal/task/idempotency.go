@@ -0,0 +1,215 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header carrying a client generated
+// key which makes retries of the request safe.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLen limits the length of an idempotency key.
+const maxIdempotencyKeyLen = 255
+
+// maxIdempotentBodySize limits the size of a request body
+// which can be remembered under an idempotency key.
+const maxIdempotentBodySize = 1 << 20
+
+// idempotencySweep specifies how often the expired responses are removed.
+const idempotencySweep = time.Minute
+
+// replayedHeaders lists the response headers written by the handlers which
+// are stored and replayed. The other headers, like the request id or the
+// CORS headers, are set for each request by the outer middleware.
+var replayedHeaders = []string{"Content-Type", "Location", "ETag"}
+
+// idempotentResponse is a stored response to a request with an idempotency key.
+type idempotentResponse struct {
+	sum     [sha256.Size]byte // Checksum of the request method, URL, content type and body.
+	done    bool              // False while the first request is being handled.
+	code    int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// idempotencyKey is an idempotency key of a user.
+type idempotencyKey struct {
+	owner, key string
+}
+
+// idempotencyStore stores responses under their idempotency keys,
+// separately for each user. It is safe for concurrent use.
+type idempotencyStore struct {
+	mu        sync.Mutex
+	window    time.Duration
+	responses map[idempotencyKey]*idempotentResponse
+	swept     time.Time // Time of the last removal of the expired responses.
+	now       func() time.Time
+}
+
+// newIdempotencyStore returns a new store which
+// keeps the responses for the given time window.
+func newIdempotencyStore(window time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		window:    window,
+		responses: make(map[idempotencyKey]*idempotentResponse),
+		now:       time.Now,
+	}
+}
+
+var idempotencyKeys = newIdempotencyStore(24 * time.Hour)
+
+// SetIdempotencyWindow sets for how long the responses to requests
+// with an idempotency key are replayed. The default is 24 hours.
+func SetIdempotencyWindow(d time.Duration) {
+	idempotencyKeys.mu.Lock()
+	idempotencyKeys.window = d
+	idempotencyKeys.mu.Unlock()
+}
+
+// begin reserves the key for a request with the given checksum.
+// It returns the stored response if the request was already handled.
+// An error is returned if the key is used by a different request or
+// if the first request with the same key is still being handled.
+func (s *idempotencyStore) begin(key idempotencyKey, sum [sha256.Size]byte) (*idempotentResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if now.Sub(s.swept) >= idempotencySweep {
+		for k, r := range s.responses {
+			if r.done && now.After(r.expires) {
+				delete(s.responses, k)
+			}
+		}
+		s.swept = now
+	}
+	r, ok := s.responses[key]
+	switch {
+	case !ok || r.done && now.After(r.expires):
+		s.responses[key] = &idempotentResponse{sum: sum}
+		return nil, nil
+	case r.sum != sum:
+		return nil, &errRequest{fmt.Errorf("idempotency key %q was used with a different request", key.key), http.StatusUnprocessableEntity}
+	case !r.done:
+		return nil, &errRequest{fmt.Errorf("request with idempotency key %q is in progress", key.key), http.StatusConflict}
+	}
+	return r, nil
+}
+
+// finish stores the response with the replayedHeaders of header
+// under the reserved key.
+func (s *idempotencyStore) finish(key idempotencyKey, code int, header http.Header, body []byte) {
+	stored := make(http.Header)
+	for _, k := range replayedHeaders {
+		if v := header.Values(k); len(v) > 0 {
+			stored[k] = append([]string(nil), v...)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.responses[key]; ok {
+		r.done, r.code, r.header, r.body = true, code, stored, body
+		r.expires = s.now().Add(s.window)
+	}
+}
+
+// release frees the reserved key so the request can be retried.
+// The stored response of a finished request is kept.
+func (s *idempotencyStore) release(key idempotencyKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.responses[key]; ok && !r.done {
+		delete(s.responses, key)
+	}
+}
+
+// responseRecorder passes the response to the wrapped
+// http.ResponseWriter and records its status code and body.
+type responseRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+// WriteHeader is part of http.ResponseWriter.
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Write is part of http.ResponseWriter.
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.code == 0 {
+		r.code = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent wraps fn so the response to a request carrying
+// an idempotency key is stored and replayed on its retries.
+// Requests which failed are not stored and can be retried.
+func idempotent(fn handler) handler {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		key := idempotencyKey{owner(r), r.Header.Get(IdempotencyKeyHeader)}
+		if key.key == "" {
+			return fn(w, r)
+		}
+		if len(key.key) > maxIdempotencyKeyLen {
+			return badRequestError(fmt.Errorf("idempotency key is longer than %d bytes", maxIdempotencyKeyLen))
+		}
+
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+		if err != nil {
+			return badRequestError(err)
+		}
+		if len(body) > maxIdempotentBodySize {
+			return &errRequest{fmt.Errorf("request body is larger than %d bytes", maxIdempotentBodySize), http.StatusRequestEntityTooLarge}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		h := sha256.New()
+		fmt.Fprintf(h, "%s %s\n%s\n", r.Method, r.URL.RequestURI(), r.Header.Get("Content-Type"))
+		h.Write(body)
+		var sum [sha256.Size]byte
+		copy(sum[:], h.Sum(nil))
+
+		res, err := idempotencyKeys.begin(key, sum)
+		switch {
+		case err != nil:
+			return err
+		case res != nil: // Replay the stored response.
+			for k, v := range res.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(res.code)
+			_, err := w.Write(res.body)
+			return err
+		}
+
+		defer idempotencyKeys.release(key) // Frees the key unless the response is stored, even on panics.
+		rec := &responseRecorder{ResponseWriter: w}
+		if err := fn(rec, r); err != nil || rec.code >= http.StatusBadRequest {
+			return err
+		}
+		if rec.code == 0 {
+			rec.code = http.StatusOK
+		}
+		idempotencyKeys.finish(key, rec.code, w.Header(), rec.body.Bytes())
+		return nil
+	}
+}
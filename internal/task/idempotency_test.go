@@ -0,0 +1,257 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mrekucci/todo/internal/auth"
+)
+
+// postWithKey sends a POST request with an idempotency key to RestAPI.
+func postWithKey(t *testing.T, path, key, json string) *httptest.ResponseRecorder {
+	return postWithKeyAs(t, "", path, key, "application/json", json)
+}
+
+// postWithKeyAs sends a POST request with an idempotency key
+// and the body of the content type on behalf of user to RestAPI.
+func postWithKeyAs(t *testing.T, user, path, key, contentType, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("POST", path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set(IdempotencyKeyHeader, key)
+	if user != "" {
+		req = req.WithContext(auth.NewContext(req.Context(), &auth.User{Name: user}))
+	}
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	return rec
+}
+
+func TestIdempotentCreateReq(t *testing.T) {
+	tasks = NewManager()
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+
+	first := postWithKey(t, Path, "key-1", `{"title":"new"}`)
+	if err := checkStatusCode(first.Code, http.StatusOK); err != nil {
+		t.Fatalf("first request: %v", err)
+	}
+	retry := postWithKey(t, Path, "key-1", `{"title":"new"}`)
+	if err := checkStatusCode(retry.Code, http.StatusOK); err != nil {
+		t.Fatalf("retried request: %v", err)
+	}
+	if got, want := retry.Body.String(), first.Body.String(); got != want {
+		t.Errorf("retried request\n got body %q\nwant body %q", got, want)
+	}
+	if got := retry.Header().Get("Idempotent-Replayed"); got != "true" {
+		t.Errorf("retried request: got Idempotent-Replayed header %q; want %q", got, "true")
+	}
+	if got, want := tasks.Count(), 1; got != want {
+		t.Errorf("got %d tasks after retry; want %d", got, want)
+	}
+
+	// A different key creates another task.
+	if rec := postWithKey(t, Path, "key-2", `{"title":"new"}`); rec.Code != http.StatusOK {
+		t.Errorf("request with another key: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+	if got, want := tasks.Count(), 2; got != want {
+		t.Errorf("got %d tasks after request with another key; want %d", got, want)
+	}
+}
+
+func TestIdempotentReqError(t *testing.T) {
+	tasks = NewManager()
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+
+	// A key reused with a different body is rejected.
+	postWithKey(t, Path, "key", `{"title":"new"}`)
+	rec := postWithKey(t, Path, "key", `{"title":"other"}`)
+	if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+		t.Errorf("reused key: %v", err)
+	}
+
+	// A key reused with a different path is rejected.
+	rec = postWithKey(t, BulkPath, "key", `{"title":"new"}`)
+	if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+		t.Errorf("reused key: %v", err)
+	}
+
+	// A key reused with a different query or content type is rejected.
+	rec = postWithKey(t, Path+"?tz=UTC", "key", `{"title":"new"}`)
+	if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+		t.Errorf("reused key with a query: %v", err)
+	}
+	rec = postWithKeyAs(t, "", ImportPath, "import", "text/plain", "Buy milk")
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Errorf("import: %v", err)
+	}
+	rec = postWithKeyAs(t, "", ImportPath, "import", "text/markdown", "Buy milk")
+	if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+		t.Errorf("reused key with a content type: %v", err)
+	}
+
+	// A failed request isn't stored and can be retried.
+	if rec := postWithKey(t, Path, "empty", `{"title":""}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("failed request: got status code %d; want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := postWithKey(t, Path, "empty", `{"title":"retried"}`); rec.Code != http.StatusOK {
+		t.Errorf("retried failed request: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestIdempotentOwnerReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+
+	alice := postWithKeyAs(t, "alice", Path, "key", "application/json", `{"title":"new"}`)
+	if err := checkStatusCode(alice.Code, http.StatusOK); err != nil {
+		t.Fatalf("alice's request: %v", err)
+	}
+	// Requests of other users with alice's key aren't replayed nor rejected.
+	for _, test := range []struct{ user, body string }{
+		{"bob", `{"title":"new"}`},
+		{"carol", `{"title":"other"}`},
+	} {
+		rec := postWithKeyAs(t, test.user, Path, "key", "application/json", test.body)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("%s's request %q: %v", test.user, test.body, err)
+		}
+		if rec.Header().Get("Idempotent-Replayed") != "" || rec.Body.String() == alice.Body.String() {
+			t.Errorf("%s's request %q: got alice's response replayed %q", test.user, test.body, rec.Body)
+		}
+	}
+	if got, want := tasks.Count(), 3; got != want {
+		t.Errorf("got %d tasks; want %d", got, want)
+	}
+}
+
+func TestIdempotentReplayHeaders(t *testing.T) {
+	tasks = NewManager()
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+
+	// The outer middleware sets the request id and the CORS headers.
+	send := func(origin, id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		rec.Header().Set("X-Request-ID", id)
+		rec.Header().Set("Access-Control-Allow-Origin", origin)
+		rec.Header().Set("Vary", "Origin")
+		fn := idempotent(func(w http.ResponseWriter, r *http.Request) error {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", Path+"0")
+			_, err := w.Write([]byte(`{"id":0}`))
+			return err
+		})
+		req, err := http.NewRequest("POST", Path, bytes.NewBufferString(`{"title":"new"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(IdempotencyKeyHeader, "key")
+		if err := fn(rec, req); err != nil {
+			t.Fatalf("request from %s: %v", origin, err)
+		}
+		return rec
+	}
+	send("http://a.example.com", "req-1")
+	rec := send("http://b.example.com", "req-2")
+	for k, want := range map[string]string{
+		"Idempotent-Replayed":         "true",
+		"X-Request-ID":                "req-2",
+		"Access-Control-Allow-Origin": "http://b.example.com",
+		"Vary":                        "Origin",
+		"Content-Type":                "application/json",
+		"Location":                    Path + "0",
+	} {
+		if got := rec.Header().Values(k); len(got) != 1 || got[0] != want {
+			t.Errorf("replayed response: got %s header %q; want %q", k, got, want)
+		}
+	}
+}
+
+func TestIdempotentPanicReq(t *testing.T) {
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+	fn := idempotent(func(w http.ResponseWriter, r *http.Request) error { panic("handler failed") })
+	req, err := http.NewRequest("POST", Path, bytes.NewBufferString(`{"title":"new"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(IdempotencyKeyHeader, "key")
+	func() {
+		defer func() { recover() }()
+		fn(httptest.NewRecorder(), req)
+	}()
+	if rec := postWithKey(t, Path, "key", `{"title":"new"}`); rec.Code != http.StatusOK {
+		t.Errorf("request retried after a panic: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Unix(1426691590, 0)
+	s := newIdempotencyStore(time.Minute)
+	s.now = func() time.Time { return now }
+	sum := sha256.Sum256([]byte("request"))
+	key := idempotencyKey{"alice", "key"}
+
+	if res, err := s.begin(key, sum); res != nil || err != nil {
+		t.Fatalf("begin(%v) = %v, %v; want <nil>, <nil>", key, res, err)
+	}
+	if _, err := s.begin(key, sum); err == nil || err.(*errRequest).code != http.StatusConflict {
+		t.Errorf("begin(%v) in progress: got error %v; want %d", key, err, http.StatusConflict)
+	}
+	s.finish(key, http.StatusOK, nil, []byte("response"))
+	if res, err := s.begin(key, sum); err != nil || res == nil || string(res.body) != "response" {
+		t.Errorf("begin(%v) = %v, %v; want stored response", key, res, err)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if res, err := s.begin(key, sum); res != nil || err != nil {
+		t.Errorf("begin(%v) after window = %v, %v; want <nil>, <nil>", key, res, err)
+	}
+
+	// The expired responses are removed at most once per idempotencySweep.
+	other := idempotencyKey{"bob", "key"}
+	s.begin(other, sum)
+	s.finish(other, http.StatusOK, nil, nil)
+	now = now.Add(time.Minute + time.Second)
+	s.begin(key, sum)
+	if _, ok := s.responses[other]; ok {
+		t.Errorf("expired response of %v wasn't removed", other)
+	}
+	s.responses[other] = &idempotentResponse{done: true, expires: now.Add(-time.Second)}
+	s.begin(key, sum)
+	if _, ok := s.responses[other]; !ok {
+		t.Errorf("expired response of %v was removed before %v", other, idempotencySweep)
+	}
+}
+
+func TestIdempotentConcurrentReq(t *testing.T) {
+	tasks = NewManager()
+	idempotencyKeys = newIdempotencyStore(time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			switch rec := postWithKey(t, Path, "key", `{"title":"new"}`); rec.Code {
+			case http.StatusOK, http.StatusConflict:
+			default:
+				t.Errorf("got status code %d; want %d or %d", rec.Code, http.StatusOK, http.StatusConflict)
+			}
+		}()
+	}
+	wg.Wait()
+	if got, want := tasks.Count(), 1; got != want {
+		t.Errorf("got %d tasks after concurrent requests; want %d", got, want)
+	}
+}
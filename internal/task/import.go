@@ -0,0 +1,206 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ImportPath specifies the path of the import resource.
+const ImportPath = Path + "_import"
+
+// maxImportBodySize is the maximum size of the body of an import request.
+const maxImportBodySize = 8 << 20
+
+// parsedTask is a task read from an import or the error of its reading.
+type parsedTask struct {
+	line     int // Line where the task starts.
+	task     *Task
+	err      error
+	skip     string   // Reason why the task isn't imported, like it's deleted.
+	warnings []string // Data of the task which can't be imported.
+}
+
+// importReaders maps the media types of the import formats
+// to the functions reading the tasks from them.
+var importReaders = map[string]func(r io.Reader) ([]parsedTask, error){
+	"text/plain":       readTodoTxt,
+	"text/calendar":    readICal,
+	"text/markdown":    readMarkdown,
+	"application/json": readJSON,
+}
+
+// readJSON reads the tasks from the JSON export of another app,
+// telling the Trello board by its cards from the Taskwarrior tasks.
+func readJSON(r io.Reader) ([]parsedTask, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var board struct {
+		Cards json.RawMessage `json:"cards"`
+	}
+	if json.NewDecoder(bytes.NewReader(data)).Decode(&board) == nil && board.Cards != nil {
+		return readTrello(data)
+	}
+	return readTaskwarrior(data)
+}
+
+// decodeJSONArray calls elem for each element of the JSON array decoded by
+// dec from data, with the line where the element starts. An element which
+// doesn't fit its Go value doesn't stop the decoding.
+func decodeJSONArray(dec *json.Decoder, data []byte, elem func(line int) error) error {
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('[') {
+		return fmt.Errorf("got %v; want an array", tok)
+	}
+	for dec.More() {
+		if err := elem(jsonLine(data, dec.InputOffset())); err != nil {
+			return err
+		}
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// jsonLine returns the line of the JSON value following the offset in data.
+func jsonLine(data []byte, off int64) int {
+	for off < int64(len(data)) && bytes.IndexByte([]byte(" \t\r\n,"), data[off]) >= 0 {
+		off++
+	}
+	return bytes.Count(data[:off], []byte("\n")) + 1
+}
+
+// isTypeError reports whether err is the error of a JSON value
+// which doesn't fit its Go value, after which decoding goes on.
+func isTypeError(err error) bool {
+	_, ok := err.(*json.UnmarshalTypeError)
+	return ok
+}
+
+// importResult reports the outcome of the import of a single task.
+type importResult struct {
+	Line     int      `json:"line"`
+	ID       int      `json:"id"`
+	Skipped  string   `json:"skipped,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// importSummary counts the outcomes of the import of all tasks.
+type importSummary struct {
+	Tasks   int `json:"tasks"`
+	Created int `json:"created"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// importTasks handles requests for the creation of tasks from the request
+// body in one of the import formats selected by its content type. Either
+// all tasks are created or none of them, except for those which are skipped.
+// The response reports the outcome of each task and sums them up.
+func importTasks(w http.ResponseWriter, r *http.Request) error {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	read, ok := importReaders[mt]
+	if !ok {
+		var types []string
+		for t := range importReaders {
+			types = append(types, t)
+		}
+		sort.Strings(types)
+		return &errRequest{fmt.Errorf("unsupported content type %q, want one of %s", mt, strings.Join(types, ", ")), http.StatusUnsupportedMediaType}
+	}
+	parsed, err := read(http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		return &errRequest{fmt.Errorf("request body is larger than %d bytes", maxImportBodySize), http.StatusRequestEntityTooLarge}
+	case err != nil:
+		return badRequestError(err)
+	}
+	switch {
+	case len(parsed) == 0:
+		return badRequestError(fmt.Errorf("no tasks"))
+	case len(parsed) > maxBulkOps:
+		return badRequestError(fmt.Errorf("too many tasks: > %d", maxBulkOps))
+	}
+
+	var res struct {
+		Applied bool           `json:"applied"`
+		Summary importSummary  `json:"summary"`
+		Results []importResult `json:"results"`
+	}
+	failed := false
+	for _, p := range parsed {
+		result := importResult{Line: p.line, Skipped: p.skip, Warnings: p.warnings}
+		if p.err != nil && p.skip == "" {
+			result.Error, failed = p.err.Error(), true
+		}
+		res.Results = append(res.Results, result)
+	}
+
+	var changes []change
+	err = errBulkAborted
+	if !failed {
+		err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) error {
+			changes = changes[:0]
+			for i, p := range parsed {
+				if p.skip != "" {
+					continue
+				}
+				t, err := createTaskFrom(ctx, m, p.task, owner(r))
+				if isContextError(err) {
+					return err
+				}
+				if err != nil {
+					res.Results[i].Error, failed = err.Error(), true
+					continue
+				}
+				res.Results[i].ID = t.ID
+				changes = append(changes, change{nil, t})
+			}
+			if failed {
+				return errBulkAborted
+			}
+			return nil
+		})
+	}
+	code := http.StatusOK
+	switch err {
+	case nil:
+		res.Applied = true
+		res.Summary.Created = len(changes)
+		if len(changes) > 0 { // All tasks may be skipped.
+			commit(r, changes...)
+		}
+	case errBulkAborted:
+		code = http.StatusBadRequest
+	default:
+		return err
+	}
+	res.Summary.Tasks = len(res.Results)
+	for _, result := range res.Results {
+		switch {
+		case result.Skipped != "":
+			res.Summary.Skipped++
+		case result.Error != "":
+			res.Summary.Failed++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	return json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,119 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestImportReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	for _, test := range []struct {
+		body, contentType string
+		code              int
+		summary           importSummary
+		results           []importResult
+	}{
+		{`[{"description":"Pay rent","status":"pending","recur":"monthly"},` + "\n" +
+			`{"description":"Old task","status":"deleted"},` + "\n" +
+			`{"description":"Review plan","status":"completed"}]`, "application/json", http.StatusOK,
+			importSummary{Tasks: 3, Created: 2, Skipped: 1},
+			[]importResult{{Line: 1, ID: 0, Warnings: []string{"recur isn't imported"}}, {Line: 2, Skipped: "deleted"}, {Line: 3, ID: 1}}},
+		{`{"cards":[{"name":"Call mom","idList":"l1"},{"name":"Old card","closed":true}],"lists":[{"id":"l1","name":"Done"}]}`,
+			"application/json; charset=utf-8", http.StatusOK,
+			importSummary{Tasks: 2, Created: 1, Skipped: 1},
+			[]importResult{{Line: 1, ID: 2}, {Line: 1, Skipped: "archived"}}},
+		{"- [ ] x marks the spot\n- [ ] (A) due:tomorrow\n", "text/markdown", http.StatusOK,
+			importSummary{Tasks: 2, Created: 2},
+			[]importResult{{Line: 1, ID: 3}, {Line: 2, ID: 4}}},
+		{"- [ ] Buy milk\n- [x]\n", "text/markdown", http.StatusBadRequest,
+			importSummary{Tasks: 2, Failed: 1},
+			[]importResult{{Line: 1, ID: 5}, {Line: 2, Error: ErrCreateEmptyTitle.Error()}}},
+	} {
+		req, err := http.NewRequest("POST", ImportPath, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("POST %s %q: %v\nRecieve body: %q", ImportPath, test.body, err, rec.Body)
+			continue
+		}
+		var res struct {
+			Applied bool           `json:"applied"`
+			Summary importSummary  `json:"summary"`
+			Results []importResult `json:"results"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("POST %s %q: cannot decode the response: %v", ImportPath, test.body, err)
+			continue
+		}
+		if res.Applied != (test.code == http.StatusOK) || res.Summary != test.summary || !reflect.DeepEqual(res.Results, test.results) {
+			t.Errorf("POST %s %q: got %v, %+v, %+v; want %v, %+v, %+v", ImportPath, test.body,
+				res.Applied, res.Summary, res.Results, test.code == http.StatusOK, test.summary, test.results)
+		}
+	}
+	if n := tasks.Count(); n != 5 {
+		t.Errorf("got %d imported tasks; want 5", n)
+	}
+
+	// An import of skipped tasks only changes nothing.
+	sessions = newJournals()
+	seq := revisions.seq
+	rec := sendInSession(t, RestAPI, "POST", ImportPath, "s1", `[{"description":"Old task","status":"deleted"}]`)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s of skipped tasks: %v\nRecieve body: %q", ImportPath, err, rec.Body)
+	}
+	if revisions.seq != seq {
+		t.Errorf("import of skipped tasks: got revision %d; want %d", revisions.seq, seq)
+	}
+	if len(sessions.sessions) != 0 {
+		t.Errorf("import of skipped tasks was recorded in the session journals")
+	}
+}
+
+func TestImportReqError(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	for _, test := range []struct {
+		body, contentType string
+		code              int
+	}{
+		{"Buy milk", "application/xml", http.StatusUnsupportedMediaType},
+		{"Buy milk", "application/json", http.StatusBadRequest},
+		{`[{"description":"Buy milk"}`, "application/json", http.StatusBadRequest},
+		{`{"cards":{"name":"Buy milk"}}`, "application/json", http.StatusBadRequest},
+		{"Buy milk", "text/markdown", http.StatusBadRequest},
+		{"Buy milk", "", http.StatusUnsupportedMediaType},
+		{strings.Repeat("Buy milk\n", maxBulkOps+1), "text/plain", http.StatusBadRequest},
+		{"[" + strings.Repeat(" ", maxImportBodySize) + "]", "application/json", http.StatusRequestEntityTooLarge},
+		{strings.Repeat("Buy milk\n", maxImportBodySize/9+1), "text/plain", http.StatusRequestEntityTooLarge},
+		{"BEGIN:VCALENDAR\nEND:VCALENDAR", "text/calendar", http.StatusBadRequest},
+		{"BEGIN:VCALENDAR\nBEGIN:VTODO\nSUMMARY:Buy milk\n", "text/calendar", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest("POST", ImportPath, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("POST %s %.20q (%s): %v\nRecieve body: %q", ImportPath, test.body, test.contentType, err, rec.Body)
+		}
+	}
+	if n := tasks.Count(); n != 0 {
+		t.Errorf("failed imports created %d tasks; want 0", n)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// checklistItem matches the Markdown checklist items like "- [ ] Buy milk"
+// and "1. [x] Pay rent", with the indentation, the box and the text.
+var checklistItem = regexp.MustCompile(`^([ \t]*)(?:[-*+]|\d+[.)])[ \t]+\[([ xX])\](?:[ \t]+(.*))?$`)
+
+// readMarkdown reads the tasks from the checklist items of the Markdown
+// text. The text of an item is its title and a checked item is done. The lines indented under an item, like the nested items,
+// are its note. The other lines are skipped.
+func readMarkdown(r io.Reader) ([]parsedTask, error) {
+	var parsed []parsedTask
+	var note []string // Lines of the note of the last task if it isn't ended.
+	open, indent := false, 0
+	end := func() {
+		if open && parsed[len(parsed)-1].task != nil {
+			parsed[len(parsed)-1].task.Note = dedent(note)
+		}
+		open, note = false, nil
+	}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimRight(s.Text(), " \t\r")
+		lead := len(line) - len(strings.TrimLeft(line, " \t"))
+		if open && (line == "" || lead > indent) {
+			note = append(note, line)
+			continue
+		}
+		m := checklistItem.FindStringSubmatch(line)
+		end()
+		if m == nil {
+			continue
+		}
+		parsed = append(parsed, parsedTask{line: n, task: &Task{Title: m[3], Done: m[2] != " "}})
+		open, indent = true, len(m[1])
+	}
+	end()
+	return parsed, s.Err()
+}
+
+// dedent joins the lines removing their common indentation
+// and the leading and trailing blank lines.
+func dedent(lines []string) string {
+	common := -1
+	for _, l := range lines {
+		if l == "" {
+			continue
+		}
+		if n := len(l) - len(strings.TrimLeft(l, " \t")); common < 0 || n < common {
+			common = n
+		}
+	}
+	var s []string
+	for _, l := range lines {
+		if l != "" {
+			l = l[common:]
+		}
+		s = append(s, l)
+	}
+	return strings.Trim(strings.Join(s, "\n"), "\n")
+}
@@ -0,0 +1,76 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadMarkdown(t *testing.T) {
+	text := `# Home
+
+Things to do this week:
+
+- [ ] (A) Pay rent +finance due:2015-03-20
+  Bank transfer
+
+  - [x] Find IBAN
+  - [ ] Check balance
+* [X] Review plan
+1. [ ] Call mom due:tomorrow
+- [ ] x marks the spot
+- [ ]
+- Buy milk
+  - [ ] Nested under a list item
+
+    - [ ] Deep item
+Notes
+`
+	want := []parsedTask{
+		{line: 5, task: &Task{Title: "(A) Pay rent +finance due:2015-03-20", Note: "Bank transfer\n\n- [x] Find IBAN\n- [ ] Check balance"}},
+		{line: 10, task: &Task{Title: "Review plan", Done: true}},
+		{line: 11, task: &Task{Title: "Call mom due:tomorrow"}},
+		{line: 12, task: &Task{Title: "x marks the spot"}},
+		{line: 13, task: &Task{}},
+		{line: 15, task: &Task{Title: "Nested under a list item", Note: "- [ ] Deep item"}},
+	}
+	got, err := readMarkdown(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("readMarkdown(%q): %v", text, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("readMarkdown(%q) got %d tasks; want %d", text, len(got), len(want))
+	}
+	for i, p := range got {
+		if !reflect.DeepEqual(p, want[i]) {
+			t.Errorf("readMarkdown task %d = %+v; want %+v", i, p, want[i])
+		}
+	}
+}
+
+func TestReadMarkdownLongLine(t *testing.T) {
+	title := strings.Repeat("a", 100<<10)
+	got, err := readMarkdown(strings.NewReader("- [ ] " + title + "\n  " + title + "\n"))
+	if err != nil || len(got) != 1 || got[0].task.Title != title || got[0].task.Note != title {
+		t.Errorf("readMarkdown(long lines) = %d tasks, %v; want the task with the long title and note", len(got), err)
+	}
+}
+
+func TestDedent(t *testing.T) {
+	for _, test := range []struct {
+		lines []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"", "  a", "", "    b", "  c", ""}, "a\n\n  b\nc"},
+		{[]string{"\tx", "\t\ty"}, "x\n\ty"},
+	} {
+		if got := dedent(test.lines); got != test.want {
+			t.Errorf("dedent(%q) = %q; want %q", test.lines, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,370 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Middleware decorates a Manager with a cross-cutting behavior,
+// like caching, logging or hooks.
+type Middleware func(m Manager) Manager
+
+// Wrap returns m decorated by mws. The first middleware is the outermost
+// one, so it sees the operations before the others and the results last.
+func Wrap(m Manager, mws ...Middleware) Manager {
+	for i := len(mws) - 1; i >= 0; i-- {
+		m = mws[i](m)
+	}
+	return m
+}
+
+// Cache returns a Middleware which caches the stored and the deleted tasks
+// read from the Manager. The cache is dropped by every operation which
+// changes the tasks, so all changes must be made through the decorated
+// Manager. The operations within transactions aren't cached.
+func Cache() Middleware {
+	return func(m Manager) Manager {
+		return &cached{m, &cache{}}
+	}
+}
+
+// cached is a Manager caching the reads of the Manager it wraps.
+type cached struct {
+	Manager
+	*cache
+}
+
+// cache holds the tasks cached by a cached Manager,
+// which is shared with the Manager bound to contexts.
+type cache struct {
+	mu         sync.Mutex
+	gen        int     // Incremented by every change to discard concurrent reads.
+	all, trash []*Task // Nil if not cached.
+}
+
+// WithContext returns m whose operations are made with ctx.
+func (m *cached) WithContext(ctx context.Context) Manager {
+	return &cached{WithContext(ctx, m.Manager), m.cache}
+}
+
+// read returns a copy of the tasks cached in *c. If they aren't
+// cached, they are read by fn and cached unless they were changed
+// in the meantime.
+func (m *cached) read(c *[]*Task, fn func() []*Task) []*Task {
+	m.mu.Lock()
+	if *c != nil {
+		defer m.mu.Unlock()
+		return append([]*Task(nil), *c...)
+	}
+	gen := m.gen
+	m.mu.Unlock()
+
+	tasks := fn()
+	m.mu.Lock()
+	if gen == m.gen {
+		*c = append([]*Task{}, tasks...)
+	}
+	m.mu.Unlock()
+	return tasks
+}
+
+// invalidate drops the cache.
+func (m *cached) invalidate() {
+	m.mu.Lock()
+	m.gen++
+	m.all, m.trash = nil, nil
+	m.mu.Unlock()
+}
+
+func (m *cached) Create(title string) (*Task, error) {
+	defer m.invalidate()
+	return m.Manager.Create(title)
+}
+
+func (m *cached) Find(id int) (*Task, bool) {
+	for _, t := range m.All() {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func (m *cached) All() []*Task {
+	return m.read(&m.all, m.Manager.All)
+}
+
+func (m *cached) Update(t *Task) error {
+	defer m.invalidate()
+	return m.Manager.Update(t)
+}
+
+func (m *cached) Delete(id int) error {
+	defer m.invalidate()
+	return m.Manager.Delete(id)
+}
+
+func (m *cached) Count() int {
+	return len(m.All())
+}
+
+func (m *cached) Trash() []*Task {
+	return m.read(&m.trash, m.Manager.Trash)
+}
+
+func (m *cached) Restore(id int) (*Task, error) {
+	defer m.invalidate()
+	return m.Manager.Restore(id)
+}
+
+func (m *cached) Purge(id int) error {
+	defer m.invalidate()
+	return m.Manager.Purge(id)
+}
+
+func (m *cached) PurgeBefore(t time.Time) int {
+	defer m.invalidate()
+	return m.Manager.PurgeBefore(t)
+}
+
+func (m *cached) Tx(fn func(m Manager) error) error {
+	defer m.invalidate()
+	return m.Manager.Tx(fn)
+}
+
+// Logging returns a Middleware which logs every operation
+// of the Manager with its duration and error at the debug level.
+func Logging(l *slog.Logger) Middleware {
+	return func(m Manager) Manager {
+		return &logged{m, l}
+	}
+}
+
+// logged is a Manager logging the operations of the Manager it wraps.
+type logged struct {
+	Manager
+	l *slog.Logger
+}
+
+// WithContext returns m whose operations are made with ctx.
+func (m *logged) WithContext(ctx context.Context) Manager {
+	return &logged{WithContext(ctx, m.Manager), m.l}
+}
+
+// log logs the operation op started at start which failed with err.
+func (m *logged) log(op string, start time.Time, err error) {
+	args := []interface{}{"op", op, "duration", time.Since(start)}
+	if err != nil {
+		args = append(args, "err", err)
+	}
+	m.l.Debug("storage operation", args...)
+}
+
+func (m *logged) Create(title string) (t *Task, err error) {
+	defer func(start time.Time) { m.log("create", start, err) }(time.Now())
+	return m.Manager.Create(title)
+}
+
+func (m *logged) Find(id int) (*Task, bool) {
+	defer m.log("find", time.Now(), nil)
+	return m.Manager.Find(id)
+}
+
+func (m *logged) All() []*Task {
+	defer m.log("all", time.Now(), nil)
+	return m.Manager.All()
+}
+
+func (m *logged) Update(t *Task) (err error) {
+	defer func(start time.Time) { m.log("update", start, err) }(time.Now())
+	return m.Manager.Update(t)
+}
+
+func (m *logged) Delete(id int) (err error) {
+	defer func(start time.Time) { m.log("delete", start, err) }(time.Now())
+	return m.Manager.Delete(id)
+}
+
+func (m *logged) Count() int {
+	defer m.log("count", time.Now(), nil)
+	return m.Manager.Count()
+}
+
+func (m *logged) Trash() []*Task {
+	defer m.log("trash", time.Now(), nil)
+	return m.Manager.Trash()
+}
+
+func (m *logged) Restore(id int) (t *Task, err error) {
+	defer func(start time.Time) { m.log("restore", start, err) }(time.Now())
+	return m.Manager.Restore(id)
+}
+
+func (m *logged) Purge(id int) (err error) {
+	defer func(start time.Time) { m.log("purge", start, err) }(time.Now())
+	return m.Manager.Purge(id)
+}
+
+func (m *logged) PurgeBefore(t time.Time) int {
+	defer m.log("purge_before", time.Now(), nil)
+	return m.Manager.PurgeBefore(t)
+}
+
+// Tx logs the whole transaction and the operations made within it.
+func (m *logged) Tx(fn func(m Manager) error) (err error) {
+	defer func(start time.Time) { m.log("tx", start, err) }(time.Now())
+	return m.Manager.Tx(func(tx Manager) error { return fn(&logged{tx, m.l}) })
+}
+
+func (m *logged) Flush() (err error) {
+	defer func(start time.Time) { m.log("flush", start, err) }(time.Now())
+	return m.Manager.Flush()
+}
+
+func (m *logged) Ping() (err error) {
+	defer func(start time.Time) { m.log("ping", start, err) }(time.Now())
+	return m.Manager.Ping()
+}
+
+// VetoError is returned by an operation which was vetoed by a before-hook.
+type VetoError struct {
+	Op  string // One of create, update or delete.
+	Err error  // Reason returned by the hook.
+}
+
+func (e *VetoError) Error() string {
+	return fmt.Sprintf("%s: vetoed: %v", e.Op, e.Err)
+}
+
+// Unwrap returns the reason returned by the hook.
+func (e *VetoError) Unwrap() error {
+	return e.Err
+}
+
+// Hooks are functions called around the Create, Update and Delete
+// operations. The op argument is one of create, update or delete and
+// the task is a copy which may be kept but the changes aren't stored.
+type Hooks struct {
+	// Before is called before the operation with the task to be created,
+	// the new state of the updated task or the task to be deleted. If it
+	// returns an error, the operation isn't made and fails with *VetoError.
+	Before func(op string, t *Task) error
+
+	// After is called after the operation succeeded with the created task,
+	// the new state of the updated task or the deleted task. The operations
+	// within transactions are reported only when the transaction is applied.
+	After func(op string, t *Task)
+}
+
+// Hook returns a Middleware which calls the hooks h
+// around the Create, Update and Delete operations.
+func Hook(h Hooks) Middleware {
+	return func(m Manager) Manager {
+		return &hooked{Manager: m, h: h}
+	}
+}
+
+// hooked is a Manager calling hooks around the operations of the Manager
+// it wraps. Within a transaction the after-hooks are collected in pending.
+type hooked struct {
+	Manager
+	h       Hooks
+	pending *[]func()
+}
+
+// WithContext returns m whose operations are made with ctx.
+func (m *hooked) WithContext(ctx context.Context) Manager {
+	return &hooked{WithContext(ctx, m.Manager), m.h, m.pending}
+}
+
+// before calls the before-hook of operation op with a copy of t.
+func (m *hooked) before(op string, t *Task) error {
+	if m.h.Before == nil {
+		return nil
+	}
+	c := *t
+	if err := m.h.Before(op, &c); err != nil {
+		return &VetoError{op, err}
+	}
+	return nil
+}
+
+// after calls the after-hook of operation op with a copy of t, or
+// postpones the call until the end of the transaction.
+func (m *hooked) after(op string, t *Task) {
+	if m.h.After == nil {
+		return
+	}
+	c := *t
+	fn := func() { m.h.After(op, &c) }
+	if m.pending != nil {
+		*m.pending = append(*m.pending, fn)
+		return
+	}
+	fn()
+}
+
+func (m *hooked) Create(title string) (*Task, error) {
+	if err := m.before("create", &Task{Title: title}); err != nil {
+		return nil, err
+	}
+	t, err := m.Manager.Create(title)
+	if err == nil {
+		m.after("create", t)
+	}
+	return t, err
+}
+
+func (m *hooked) Update(t *Task) error {
+	if err := m.before("update", t); err != nil {
+		return err
+	}
+	err := m.Manager.Update(t)
+	if err == nil {
+		m.after("update", t)
+	}
+	return err
+}
+
+func (m *hooked) Delete(id int) error {
+	t, ok := m.Manager.Find(id)
+	if !ok {
+		return m.Manager.Delete(id) // Fails with the error of the Manager.
+	}
+	if err := m.before("delete", t); err != nil {
+		return err
+	}
+	err := m.Manager.Delete(id)
+	if err == nil {
+		m.after("delete", t)
+	}
+	return err
+}
+
+// Tx calls the after-hooks of the operations
+// made within fn only if the transaction is applied.
+func (m *hooked) Tx(fn func(m Manager) error) error {
+	var pending []func()
+	err := m.Manager.Tx(func(tx Manager) error {
+		pending = pending[:0]
+		return fn(&hooked{tx, m.h, &pending})
+	})
+	if err != nil {
+		return err
+	}
+	if m.pending != nil { // Nested in an outer transaction.
+		*m.pending = append(*m.pending, pending...)
+		return nil
+	}
+	for _, fn := range pending {
+		fn()
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// countingManager counts the reads of the Manager it wraps.
+type countingManager struct {
+	Manager
+	reads int
+}
+
+func (m *countingManager) All() []*Task {
+	m.reads++
+	return m.Manager.All()
+}
+
+func (m *countingManager) Trash() []*Task {
+	m.reads++
+	return m.Manager.Trash()
+}
+
+func TestWrap(t *testing.T) {
+	var calls []string
+	mw := func(name string) Middleware {
+		return Hook(Hooks{Before: func(op string, t *Task) error {
+			calls = append(calls, name)
+			return nil
+		}})
+	}
+	m := Wrap(NewManager(), mw("outer"), mw("inner"))
+	if _, err := m.Create("Task 0"); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if want := []string{"outer", "inner"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got middleware calls %v; want %v", calls, want)
+	}
+	if m := NewManager(); Wrap(m) != m {
+		t.Errorf("Wrap(m) without middleware doesn't return m")
+	}
+}
+
+func TestCache(t *testing.T) {
+	cm := &countingManager{Manager: NewManager()}
+	if err := addTasks(cm, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	m := Wrap(cm, Cache())
+
+	for _, test := range []struct {
+		name  string
+		op    func()
+		reads int // Number of reads of the underlying Manager made by op.
+	}{
+		{"All", func() { m.All() }, 1},
+		{"cached All", func() { m.All() }, 0},
+		{"cached Find", func() { m.Find(1) }, 0},
+		{"cached Count", func() { m.Count() }, 0},
+		{"Trash", func() { m.Trash() }, 1},
+		{"cached Trash", func() { m.Trash() }, 0},
+		{"Delete", func() { m.Delete(0) }, 0},
+		{"All after Delete", func() { m.All() }, 1},
+		{"Trash after Delete", func() { m.Trash() }, 1},
+		{"Tx", func() { m.Tx(func(m Manager) error { _, err := m.Create("Task 3"); return err }) }, 0},
+		{"Count after Tx", func() { m.Count() }, 1},
+	} {
+		reads := cm.reads
+		test.op()
+		if got := cm.reads - reads; got != test.reads {
+			t.Errorf("%s: got %d reads; want %d", test.name, got, test.reads)
+		}
+	}
+
+	if got, want := ptrToVal(m.All()), ptrToVal(cm.Manager.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v; want %v", got, want)
+	}
+	if _, ok := m.Find(0); ok {
+		t.Errorf("Find(0) found a deleted task")
+	}
+	all := m.All()
+	all[0], all[1] = all[1], all[0]
+	if got := m.All(); got[0].ID != 1 {
+		t.Errorf("reordering of All() result changed the cache to %v", ptrToVal(got))
+	}
+}
+
+func TestLogging(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	m := Wrap(NewManager(), Logging(l))
+	m.Tx(func(m Manager) error {
+		_, err := m.Create("Task 0")
+		return err
+	})
+	m.Delete(1)
+
+	got := buf.String()
+	for _, want := range []string{
+		"msg=\"storage operation\" op=create duration=",
+		"msg=\"storage operation\" op=tx duration=",
+		"op=delete duration=",
+		"err=\"Delete: unknown task\"",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in log:\n%s", want, got)
+		}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	errPinned := errors.New("pinned task")
+	var after []string
+	m := Wrap(NewManager(), Hook(Hooks{
+		Before: func(op string, t *Task) error {
+			if strings.HasPrefix(t.Title, "Pinned") {
+				return errPinned
+			}
+			return nil
+		},
+		After: func(op string, t *Task) {
+			after = append(after, fmt.Sprintf("%s %d %s", op, t.ID, t.Title))
+		},
+	}))
+
+	if _, err := m.Create("Task 0"); err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if err := m.Update(&Task{ID: 0, Title: "Pinned Task 0"}); !errors.Is(err, errPinned) {
+		t.Errorf("Update vetoed: got error %v; want %v", err, errPinned)
+	}
+	if err := m.Update(&Task{ID: 0, Title: "Updated Task 0"}); err != nil {
+		t.Errorf("Update: unexpected error: %v", err)
+	}
+	var veto *VetoError
+	if _, err := m.Create("Pinned Task 1"); !errors.As(err, &veto) || veto.Op != "create" {
+		t.Errorf("Create vetoed: got error %v; want *VetoError of create", err)
+	}
+	if err := m.Delete(7); err != ErrDeleteUnknown {
+		t.Errorf("Delete(7): got error %v; want %v", err, ErrDeleteUnknown)
+	}
+	m.Tx(func(m Manager) error {
+		m.Create("Task 1")
+		return errors.New("rollback")
+	})
+	m.Tx(func(m Manager) error {
+		_, err := m.Create("Task 1")
+		return err
+	})
+	if err := m.Delete(0); err != nil {
+		t.Errorf("Delete(0): unexpected error: %v", err)
+	}
+
+	want := []string{"create 0 Task 0", "update 0 Updated Task 0", "create 1 Task 1", "delete 0 Updated Task 0"}
+	if !reflect.DeepEqual(after, want) {
+		t.Errorf("got after-hook calls %q; want %q", after, want)
+	}
+	if got := ptrToVal(m.All()); !reflect.DeepEqual(got, []Task{{ID: 1, Title: "Task 1"}}) {
+		t.Errorf("got tasks %v; want only Task 1", got)
+	}
+}
+
+func TestVetoReq(t *testing.T) {
+	tasks = Wrap(NewManager(), Hook(Hooks{Before: func(op string, t *Task) error {
+		if op == "delete" {
+			return errors.New("tasks can't be deleted")
+		}
+		return nil
+	}}))
+	defer func() { tasks = NewManager() }()
+	if err := addTasks(tasks, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	req, err := http.NewRequest("DELETE", Path+"0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+		t.Errorf("DELETE %s0: %v\nRecieve body: %q", Path, err, rec.Body)
+	}
+	if got, want := rec.Body.String(), "delete: vetoed: tasks can't be deleted"; !strings.Contains(got, want) {
+		t.Errorf("DELETE %s0: got body %q; want %q", Path, got, want)
+	}
+	if n := tasks.Count(); n != len(testTasks) {
+		t.Errorf("vetoed request changed the tasks: got %d tasks; want %d", n, len(testTasks))
+	}
+}
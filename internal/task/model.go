@@ -7,6 +7,8 @@ package task
 import (
 	"errors"
 	"sort"
+	"sync"
+	"time"
 )
 
 // ErrCreateEmptyTitle indicates attempt to create task with an empty title.
@@ -18,14 +20,40 @@ var ErrUpdateUnknown = errors.New("Update: unknown task")
 // ErrDeleteUnknown indicates attempt to delete unknown task.
 var ErrDeleteUnknown = errors.New("Delete: unknown task")
 
+// ErrRestoreUnknown indicates attempt to restore a task which isn't in the trash.
+var ErrRestoreUnknown = errors.New("Restore: unknown task")
+
+// ErrPurgeUnknown indicates attempt to purge a task which isn't in the trash.
+var ErrPurgeUnknown = errors.New("Purge: unknown task")
+
+// now returns the current time. It is replaced in tests.
+var now = time.Now
+
+// Priorities of tasks, from the lowest to the highest.
+const (
+	PriorityNone = iota
+	PriorityLow
+	PriorityMedium
+	PriorityHigh
+)
+
 // Task enumerates task properties.
 type Task struct {
-	ID       int    `json:"id"`
-	Title    string `json:"title"`
-	Date     int64  `json:"date"`
-	Note     string `json:"note"`
-	Priority byte   `json:"priority"`
-	Done     bool   `json:"done"`
+	ID        int      `json:"id"`
+	Title     string   `json:"title"`
+	Date      int64    `json:"date"` // Unix time in seconds, 0 if not scheduled.
+	Note      string   `json:"note"`
+	Priority  byte     `json:"priority"`
+	Done      bool     `json:"done"`
+	Tags      []string `json:"tags,omitempty"`      // Labels of the task, like finance.
+	Contexts  []string `json:"contexts,omitempty"`  // Places or tools needed to do the task, like home.
+	TimeZone  string   `json:"timeZone,omitempty"`  // IANA time zone of the date, UTC if empty.
+	AllDay    bool     `json:"allDay,omitempty"`    // The date is a day without the time.
+	Created   int64    `json:"created,omitempty"`   // Time of creation, if known.
+	Completed int64    `json:"completed,omitempty"` // Time of completion of a done task, if known.
+	UID       string   `json:"uid,omitempty"`       // Identifier of the task imported from a calendar.
+	Owner     string   `json:"owner,omitempty"`     // Name of the user who owns the task.
+	Deleted   int64    `json:"deleted,omitempty"`   // Time of moving to the trash.
 }
 
 // Sort is the type of a Sort.Less function that
@@ -81,19 +109,46 @@ type Manager interface {
 	// Empty Task and false is returned if a task with such an id doesn't exist.
 	Find(id int) (task *Task, ok bool)
 
-	// Returns all stored tasks.
+	// Returns all stored tasks, except the deleted ones.
 	All() []*Task
 
 	// Updates given task.
 	// An error is returned if such a task doesn't exist.
 	Update(task *Task) error
 
-	// Deletes task with given id.
+	// Moves task with given id to the trash.
 	// An error is returned if a task with such id doesn't exist.
 	Delete(id int) error
 
-	// Returns a number of stored tasks.
+	// Returns a number of stored tasks, except the deleted ones.
 	Count() int
+
+	// Returns all deleted tasks.
+	Trash() []*Task
+
+	// Moves deleted task with given id back from the trash.
+	// An error is returned if such a task isn't in the trash.
+	Restore(id int) (*Task, error)
+
+	// Permanently removes deleted task with given id.
+	// An error is returned if such a task isn't in the trash.
+	Purge(id int) error
+
+	// Permanently removes tasks deleted before t.
+	// Returns a number of removed tasks.
+	PurgeBefore(t time.Time) int
+
+	// Runs fn within a transaction. The changes made through the Manager
+	// passed to fn are applied atomically, and only if fn returns nil.
+	Tx(fn func(m Manager) error) error
+
+	// Writes all changes to the underlying storage.
+	// An error is returned if the changes can't be written.
+	Flush() error
+
+	// Checks that the underlying storage is healthy.
+	// An error is returned if it isn't.
+	Ping() error
 }
 
 // NewManager returns a new empty Manager.
@@ -103,7 +158,9 @@ func NewManager() Manager {
 
 // inMemory allows manage tasks in memory.
 type inMemory struct {
+	mu     sync.RWMutex
 	tasks  []*Task
+	trash  []*Task
 	nextID int
 }
 
@@ -113,6 +170,8 @@ func (m *inMemory) Create(title string) (*Task, error) {
 	if title == "" {
 		return nil, ErrCreateEmptyTitle
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	t := &Task{ID: m.nextID, Title: title}
 	m.tasks = append(m.tasks, t)
 	m.nextID++
@@ -122,6 +181,8 @@ func (m *inMemory) Create(title string) (*Task, error) {
 // Find returns task with given id.
 // Returns empty Task and false, if a task with such id doesn't exist.
 func (m *inMemory) Find(id int) (task *Task, ok bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	for _, t := range m.tasks {
 		if t.ID == id {
 			return t, true
@@ -131,13 +192,18 @@ func (m *inMemory) Find(id int) (task *Task, ok bool) {
 }
 
 // All returns all stored tasks.
+// The returned slice is a copy and may be reordered by the caller.
 func (m *inMemory) All() []*Task {
-	return m.tasks
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Task(nil), m.tasks...)
 }
 
 // Update updates given task.
 // Returns error if such a task doesn't exist.
 func (m *inMemory) Update(task *Task) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for i, t := range m.tasks {
 		if t.ID == task.ID {
 			c := *task // Copy the task to save the changes.
@@ -148,12 +214,17 @@ func (m *inMemory) Update(task *Task) error {
 	return ErrUpdateUnknown
 }
 
-// Delete deletes task with given id.
+// Delete moves task with given id to the trash.
 // Returns an error if a task with such id doesn't exist.
 func (m *inMemory) Delete(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for i, t := range m.tasks {
 		if t.ID == id {
-			m.tasks, m.tasks[m.Count()-1] = append(m.tasks[:i], m.tasks[i+1:]...), nil
+			m.tasks, m.tasks[len(m.tasks)-1] = append(m.tasks[:i], m.tasks[i+1:]...), nil
+			c := *t // Copy the task to record the deletion time.
+			c.Deleted = now().Unix()
+			m.trash = append(m.trash, &c)
 			return nil
 		}
 	}
@@ -162,5 +233,95 @@ func (m *inMemory) Delete(id int) error {
 
 // Count returns a number of stored tasks.
 func (m *inMemory) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return len(m.tasks)
 }
+
+// Trash returns all deleted tasks.
+func (m *inMemory) Trash() []*Task {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]*Task(nil), m.trash...)
+}
+
+// Restore moves deleted task with given id back from the trash.
+// Returns an error if such a task isn't in the trash.
+func (m *inMemory) Restore(id int) (*Task, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.trash {
+		if t.ID == id {
+			m.trash, m.trash[len(m.trash)-1] = append(m.trash[:i], m.trash[i+1:]...), nil
+			c := *t // Copy the task to clear the deletion time.
+			c.Deleted = 0
+			// Keep the tasks ordered by their IDs.
+			j := sort.Search(len(m.tasks), func(j int) bool { return m.tasks[j].ID > id })
+			m.tasks = append(m.tasks, nil)
+			copy(m.tasks[j+1:], m.tasks[j:])
+			m.tasks[j] = &c
+			return &c, nil
+		}
+	}
+	return nil, ErrRestoreUnknown
+}
+
+// Purge permanently removes deleted task with given id.
+// Returns an error if such a task isn't in the trash.
+func (m *inMemory) Purge(id int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, t := range m.trash {
+		if t.ID == id {
+			m.trash, m.trash[len(m.trash)-1] = append(m.trash[:i], m.trash[i+1:]...), nil
+			return nil
+		}
+	}
+	return ErrPurgeUnknown
+}
+
+// PurgeBefore permanently removes tasks deleted before t.
+// Returns a number of removed tasks.
+func (m *inMemory) PurgeBefore(t time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var trash []*Task
+	for _, d := range m.trash {
+		if d.Deleted >= t.Unix() {
+			trash = append(trash, d)
+		}
+	}
+	n := len(m.trash) - len(trash)
+	m.trash = trash
+	return n
+}
+
+// Tx runs fn on a private copy of the stored tasks and
+// replaces the stored tasks with the copy if fn succeeds.
+// Other operations are blocked until the transaction ends.
+func (m *inMemory) Tx(fn func(m Manager) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tx := &inMemory{tasks: copyTasks(m.tasks), trash: copyTasks(m.trash), nextID: m.nextID}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	m.tasks, m.trash, m.nextID = tx.tasks, tx.trash, tx.nextID
+	return nil
+}
+
+// Flush does nothing, the tasks are kept only in memory.
+func (m *inMemory) Flush() error { return nil }
+
+// Ping does nothing, the memory is always healthy.
+func (m *inMemory) Ping() error { return nil }
+
+// copyTasks returns a slice of copies of the given tasks.
+func copyTasks(tasks []*Task) []*Task {
+	r := make([]*Task, len(tasks))
+	for i, t := range tasks {
+		c := *t // Copy the task so the copy can be modified independently.
+		r[i] = &c
+	}
+	return r
+}
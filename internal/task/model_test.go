@@ -5,8 +5,10 @@
 package task
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+	"time"
 )
 
 var unsortedTestTasks = [...]Task{
@@ -213,3 +215,147 @@ func TestCount(t *testing.T) {
 		t.Errorf("Count() = %d; want %d", got, want)
 	}
 }
+
+func TestTx(t *testing.T) {
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	// Test rollback.
+	want := ptrToVal(m.All())
+	errTx := errors.New("Tx: abort")
+	if got := m.Tx(func(tx Manager) error {
+		if _, err := tx.Create("Task 3"); err != nil {
+			return err
+		}
+		if err := tx.Delete(testTasks[0].ID); err != nil {
+			return err
+		}
+		task, _ := tx.Find(testTasks[1].ID)
+		task.Title = "Updated Title"
+		return errTx
+	}); got != errTx {
+		t.Errorf("Tx(...) = %v; want %v", got, errTx)
+	}
+	if got := ptrToVal(m.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tx(...) rollback\n got %v\nwant %v", got, want)
+	}
+
+	// Test commit.
+	if err := m.Tx(func(tx Manager) error {
+		if _, err := tx.Create("Task 3"); err != nil {
+			return err
+		}
+		return tx.Delete(testTasks[0].ID)
+	}); err != nil {
+		t.Errorf("Tx(...): unexpected error: %v", err)
+	}
+	want = append(want[1:], Task{ID: len(testTasks), Title: "Task 3"})
+	if got := ptrToVal(m.All()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tx(...) commit\n got %v\nwant %v", got, want)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) }
+
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	for _, task := range testTasks {
+		if err := m.Delete(task.ID); err != nil {
+			t.Errorf("Delete(%d): unexpected error: %v", task.ID, err)
+		}
+	}
+	var want []Task
+	for _, task := range testTasks {
+		task.Deleted = now().Unix()
+		want = append(want, task)
+	}
+	if got := ptrToVal(m.Trash()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Trash() = %v\n                want %v", got, want)
+	}
+	if got := m.All(); len(got) != 0 {
+		t.Errorf("All() = %v; want []", ptrToVal(got))
+	}
+}
+
+func TestRestore(t *testing.T) {
+	m := NewManager()
+
+	// Test restore unknown.
+	if got, err := m.Restore(0); got != nil || err != ErrRestoreUnknown {
+		t.Errorf("Restore(0) = %v, %v; want <nil>, %v", got, err, ErrRestoreUnknown)
+	}
+
+	// Test restore deleted.
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	for _, task := range testTasks {
+		if err := m.Delete(task.ID); err != nil {
+			t.Fatalf("Delete(%d): unexpected error: %v", task.ID, err)
+		}
+	}
+	for _, id := range []int{2, 0, 1} {
+		if got, err := m.Restore(id); err != nil || !reflect.DeepEqual(got, &testTasks[id]) {
+			t.Errorf("Restore(%d) = %v, %v; want %v, <nil>", id, got, err, testTasks[id])
+		}
+	}
+	if got, want := m.All(), valToPtr(testTasks[:]); !reflect.DeepEqual(got, want) {
+		t.Errorf("All() = %v\n              want %v", ptrToVal(got), ptrToVal(want))
+	}
+	if got := m.Trash(); len(got) != 0 {
+		t.Errorf("Trash() = %v; want []", ptrToVal(got))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	// Test purge of a task which isn't deleted.
+	if got, want := m.Purge(testTasks[0].ID), ErrPurgeUnknown; got != want {
+		t.Errorf("Purge(%d) = %v; want %v", testTasks[0].ID, got, want)
+	}
+
+	// Test purge deleted.
+	if err := m.Delete(testTasks[0].ID); err != nil {
+		t.Fatalf("Delete(%d): unexpected error: %v", testTasks[0].ID, err)
+	}
+	if err := m.Purge(testTasks[0].ID); err != nil {
+		t.Errorf("Purge(%d): unexpected error: %v", testTasks[0].ID, err)
+	}
+	if got := m.Trash(); len(got) != 0 {
+		t.Errorf("Trash() = %v; want []", ptrToVal(got))
+	}
+	if _, err := m.Restore(testTasks[0].ID); err != ErrRestoreUnknown {
+		t.Errorf("Restore(%d) after purge = %v; want %v", testTasks[0].ID, err, ErrRestoreUnknown)
+	}
+}
+
+func TestPurgeBefore(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+
+	m := NewManager()
+	if err := addTasks(m, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	for i, task := range testTasks {
+		now = func() time.Time { return time.Unix(int64(1426691590+i), 0) }
+		if err := m.Delete(task.ID); err != nil {
+			t.Fatalf("Delete(%d): unexpected error: %v", task.ID, err)
+		}
+	}
+	if got, want := m.PurgeBefore(time.Unix(1426691592, 0)), 2; got != want {
+		t.Errorf("PurgeBefore(...) = %d; want %d", got, want)
+	}
+	if got := m.Trash(); len(got) != 1 || got[0].ID != testTasks[2].ID {
+		t.Errorf("Trash() = %v; want only task %d", ptrToVal(got), testTasks[2].ID)
+	}
+}
@@ -0,0 +1,458 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Progress counts the checklist items of a note.
+type Progress struct {
+	Done  int `json:"done"`  // Number of the checked items.
+	Total int `json:"total"` // Number of all items.
+}
+
+// ChecklistItems returns the states of the Markdown checklist items like
+// "- [ ] Buy milk" in the note, true for the checked ones. The items in
+// the fenced code blocks are skipped.
+func ChecklistItems(note string) []bool {
+	var items []bool
+	for _, i := range checklist(strings.Split(note, "\n")) {
+		items = append(items, i.checked)
+	}
+	return items
+}
+
+// ChecklistProgress returns the progress of the checklist items in the note.
+func ChecklistProgress(note string) Progress {
+	var p Progress
+	for _, checked := range ChecklistItems(note) {
+		if checked {
+			p.Done++
+		}
+		p.Total++
+	}
+	return p
+}
+
+// noteFields are the fields of the JSON form of Task derived from its note,
+// which are only written.
+type noteFields struct {
+	Checklist *Progress `json:"checklist,omitempty"`
+}
+
+// noteFieldsOf returns the fields derived from the note. The progress
+// of the checklist is set if the note has any checklist items.
+func noteFieldsOf(note string) noteFields {
+	if p := ChecklistProgress(note); p.Total > 0 {
+		return noteFields{Checklist: &p}
+	}
+	return noteFields{}
+}
+
+// CheckItem returns the note with its n-th checklist item, counted from zero,
+// checked or unchecked. The rest of the note is kept as it is. It reports
+// false if the note doesn't have such an item.
+func CheckItem(note string, n int, checked bool) (string, bool) {
+	lines := strings.Split(note, "\n")
+	items := checklist(lines)
+	if n < 0 || n >= len(items) {
+		return note, false
+	}
+	i := items[n]
+	box := " "
+	switch {
+	case !checked:
+	case i.checked:
+		box = lines[i.line][i.box : i.box+1] // Keep x or X.
+	default:
+		box = "x"
+	}
+	lines[i.line] = lines[i.line][:i.box] + box + lines[i.line][i.box+1:]
+	return strings.Join(lines, "\n"), true
+}
+
+// checklistPos is the position of a checklist item in the lines of a note.
+type checklistPos struct {
+	line    int
+	box     int // Offset of the character in the box.
+	checked bool
+}
+
+// checklist returns the positions of the checklist items in the lines.
+func checklist(lines []string) []checklistPos {
+	var items []checklistPos
+	inCode := ""
+	for n, l := range lines {
+		if m := fence.FindStringSubmatch(l); m != nil && (inCode == "" || strings.HasPrefix(strings.TrimSpace(l), inCode)) {
+			if inCode == "" {
+				inCode = m[1]
+			} else {
+				inCode = ""
+			}
+			continue
+		}
+		if inCode != "" {
+			continue
+		}
+		if m := checklistItem.FindStringSubmatchIndex(strings.TrimRight(l, "\r")); m != nil {
+			items = append(items, checklistPos{n, m[4], l[m[4]] != ' '})
+		}
+	}
+	return items
+}
+
+var (
+	// fence matches the lines starting and ending the fenced code blocks.
+	fence = regexp.MustCompile("^ {0,3}(```|~~~)")
+
+	// heading matches the headings like "## Plan".
+	heading = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*))?$`)
+
+	// rule matches the horizontal rules like "---".
+	rule = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+
+	// listItem matches the items of the bulleted and the numbered lists
+	// with the indentation, the marker and the text.
+	listItem = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])(?:[ \t]+(.*))?$`)
+
+	// codeSpan matches the code in the text like `go vet`.
+	codeSpan = regexp.MustCompile("`([^`]+)`")
+
+	// link matches the links like [Go](https://golang.org).
+	link = regexp.MustCompile(`\[([^\]]+)\]\(([^()\s]+)\)`)
+
+	// strong and em match the strong and the emphasized text.
+	strong = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	em     = regexp.MustCompile(`\*([^*\s](?:[^*]*[^*\s])?)\*`)
+)
+
+// RenderMarkdown returns the Markdown note rendered in HTML. It supports
+// the headings, paragraphs, block quotes, horizontal rules, fenced code
+// blocks and lists with checklist items, and the strong and emphasized
+// text, code and links. The HTML in the note is escaped and only the
+// links to the web and e-mail addresses are kept, so the result is safe
+// to put in a page.
+func RenderMarkdown(note string) string {
+	var b strings.Builder
+	renderBlocks(&b, strings.Split(strings.ReplaceAll(note, "\r\n", "\n"), "\n"))
+	return b.String()
+}
+
+// renderBlocks writes the blocks of the lines in HTML to b.
+func renderBlocks(b *strings.Builder, lines []string) {
+	for i := 0; i < len(lines); {
+		l := lines[i]
+		switch {
+		case isBlank(l):
+			i++
+		case fence.MatchString(l):
+			end := fence.FindStringSubmatch(l)[1]
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j]), end) {
+				j++
+			}
+			b.WriteString("<pre><code>")
+			for _, c := range lines[i+1 : j] {
+				b.WriteString(html.EscapeString(c) + "\n")
+			}
+			b.WriteString("</code></pre>\n")
+			i = j + 1
+		case heading.MatchString(l):
+			m := heading.FindStringSubmatch(l)
+			fmt.Fprintf(b, "<h%d>%s</h%[1]d>\n", len(m[1]), renderInline(strings.TrimSpace(m[2])))
+			i++
+		case rule.MatchString(l):
+			b.WriteString("<hr>\n")
+			i++
+		case isQuote(l):
+			var quote []string
+			for ; i < len(lines) && isQuote(lines[i]); i++ {
+				q := strings.TrimPrefix(strings.TrimLeft(lines[i], " "), ">")
+				quote = append(quote, strings.TrimPrefix(q, " "))
+			}
+			b.WriteString("<blockquote>\n")
+			renderBlocks(b, quote)
+			b.WriteString("</blockquote>\n")
+		case listItem.MatchString(l):
+			i = renderList(b, lines, i)
+		default:
+			j := i + 1
+			for j < len(lines) && !isBlank(lines[j]) && !startsBlock(lines[j]) {
+				j++
+			}
+			var text []string
+			for _, p := range lines[i:j] {
+				text = append(text, strings.TrimSpace(p))
+			}
+			b.WriteString("<p>" + renderInline(strings.Join(text, "\n")) + "</p>\n")
+			i = j
+		}
+	}
+}
+
+// renderList writes the list starting at the i-th line in HTML to b.
+// It returns the index of the line following the list.
+func renderList(b *strings.Builder, lines []string, i int) int {
+	m := listItem.FindStringSubmatch(lines[i])
+	indent, ordered := len(m[1]), isOrdered(m[2])
+	tag := "ul"
+	switch n, _ := strconv.Atoi(strings.TrimRight(m[2], ".)")); {
+	case !ordered:
+		b.WriteString("<ul>\n")
+	case n != 1:
+		tag = "ol"
+		fmt.Fprintf(b, "<ol start=\"%d\">\n", n)
+	default:
+		tag = "ol"
+		b.WriteString("<ol>\n")
+	}
+	for {
+		text := listItem.FindStringSubmatch(lines[i])[3]
+		// The item continues with the lines indented more than its marker.
+		j := i + 1
+		for j < len(lines) {
+			k := j
+			for k < len(lines) && isBlank(lines[k]) {
+				k++
+			}
+			if k == len(lines) || indentOf(lines[k]) <= indent {
+				break
+			}
+			j = k + 1
+		}
+
+		b.WriteString("<li>")
+		switch {
+		case strings.HasPrefix(text, "[ ]") && (len(text) == 3 || text[3] == ' '):
+			b.WriteString(`<input type="checkbox" disabled> `)
+			text = strings.TrimSpace(text[3:])
+		case (strings.HasPrefix(text, "[x]") || strings.HasPrefix(text, "[X]")) && (len(text) == 3 || text[3] == ' '):
+			b.WriteString(`<input type="checkbox" checked disabled> `)
+			text = strings.TrimSpace(text[3:])
+		}
+		b.WriteString(renderInline(text))
+		if nested := dedent(lines[i+1 : j]); nested != "" {
+			b.WriteString("\n")
+			renderBlocks(b, strings.Split(nested, "\n"))
+		}
+		b.WriteString("</li>\n")
+
+		// The blank lines between the items don't end the list.
+		i = j
+		for j < len(lines) && isBlank(lines[j]) {
+			j++
+		}
+		if j == len(lines) {
+			break
+		}
+		m := listItem.FindStringSubmatch(lines[j])
+		if m == nil || len(m[1]) != indent || isOrdered(m[2]) != ordered || rule.MatchString(lines[j]) {
+			break
+		}
+		i = j
+	}
+	b.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// renderInline returns the text with the code, links and emphasis in HTML.
+func renderInline(s string) string {
+	var b strings.Builder
+	for s != "" {
+		m := codeSpan.FindStringSubmatchIndex(s)
+		if m == nil {
+			b.WriteString(renderLinks(s))
+			break
+		}
+		b.WriteString(renderLinks(s[:m[0]]))
+		b.WriteString("<code>" + html.EscapeString(s[m[2]:m[3]]) + "</code>")
+		s = s[m[1]:]
+	}
+	return b.String()
+}
+
+// renderLinks returns the text without code with the links and emphasis
+// in HTML. The links with unsafe addresses are written as plain text.
+func renderLinks(s string) string {
+	var b strings.Builder
+	for s != "" {
+		m := link.FindStringSubmatchIndex(s)
+		if m == nil {
+			b.WriteString(renderEmphasis(s))
+			break
+		}
+		b.WriteString(renderEmphasis(s[:m[0]]))
+		text, href := renderEmphasis(s[m[2]:m[3]]), s[m[4]:m[5]]
+		if safeURL(href) {
+			fmt.Fprintf(&b, `<a href="%s" rel="nofollow noopener">%s</a>`, html.EscapeString(href), text)
+		} else {
+			b.WriteString(text)
+		}
+		s = s[m[1]:]
+	}
+	return b.String()
+}
+
+// renderEmphasis returns the escaped text with the emphasis in HTML.
+func renderEmphasis(s string) string {
+	s = strong.ReplaceAllString(html.EscapeString(s), "<strong>$1</strong>")
+	return em.ReplaceAllString(s, "<em>$1</em>")
+}
+
+// safeURL reports whether the link to the address is safe to follow:
+// it's relative or it's a web or an e-mail address.
+func safeURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "", "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// isBlank reports whether the line has only white space.
+func isBlank(l string) bool { return strings.TrimSpace(l) == "" }
+
+// isQuote reports whether the line is a line of a block quote.
+func isQuote(l string) bool { return strings.HasPrefix(strings.TrimLeft(l, " "), ">") }
+
+// isOrdered reports whether the list item marker is a number.
+func isOrdered(marker string) bool { return marker[0] >= '0' && marker[0] <= '9' }
+
+// indentOf returns the number of the leading white space characters of the line.
+func indentOf(l string) int { return len(l) - len(strings.TrimLeft(l, " \t")) }
+
+// startsBlock reports whether the line starts a block which
+// isn't a paragraph, so it ends the preceding paragraph.
+func startsBlock(l string) bool {
+	return fence.MatchString(l) || heading.MatchString(l) || rule.MatchString(l) || isQuote(l) || listItem.MatchString(l)
+}
+
+// htmlTask is Task written in JSON together with its note rendered in HTML.
+type htmlTask Task
+
+// MarshalJSON implements json.Marshaler.
+func (t htmlTask) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		jsonTask
+		NoteHTML string `json:"noteHtml"`
+	}{
+		(*Task)(&t).toJSON(),
+		RenderMarkdown(t.Note),
+	})
+}
+
+// renderNotes reports whether the note query parameter
+// of the request asks for the notes rendered in HTML.
+func renderNotes(r *http.Request) (bool, error) {
+	switch v := r.URL.Query().Get("note"); v {
+	case "", "markdown":
+		return false, nil
+	case "html":
+		return true, nil
+	default:
+		return false, fmt.Errorf("note: %q isn't markdown or html", v)
+	}
+}
+
+// writeHTMLJSON writes the tasks to the response like writeJSON,
+// together with their notes rendered in HTML.
+func writeHTMLJSON(w http.ResponseWriter, tasks []*Task) error {
+	var ht []*htmlTask
+	for _, t := range tasks {
+		ht = append(ht, (*htmlTask)(t))
+	}
+	res := struct {
+		Tasks []*htmlTask `json:"tasks"`
+	}{
+		ht,
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
+
+// checkItem handles requests for checking the checklist item of the note of
+// a specific task given by its index, counted from zero, like the request
+// to /task/0/checklist/2. The item is checked if the done query parameter
+// is true, unchecked if it's false and toggled if it's missing. The task is
+// written to the response.
+func checkItem(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseID(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	item := strings.TrimPrefix(subresource(r), "checklist/")
+	n, err := strconv.Atoi(item)
+	if err != nil || n < 0 {
+		return badRequestError(fmt.Errorf("checklist item: %q isn't an index", item))
+	}
+	var done *bool
+	if v := r.URL.Query().Get("done"); v != "" {
+		d, err := strconv.ParseBool(v)
+		if err != nil {
+			return badRequestError(fmt.Errorf("done: %q isn't true or false", v))
+		}
+		done = &d
+	}
+	rendered, err := renderNotes(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+
+	var c change
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = m.FindContext(ctx, id); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("task id: %d doesn't exists", id))
+		}
+		if err != nil {
+			return err
+		}
+		if err := authorize(r, c.before, RoleEditor); err != nil {
+			return err
+		}
+		items := ChecklistItems(c.before.Note)
+		if n >= len(items) {
+			return notFoundError(fmt.Errorf("task id: %d checklist item: %d doesn't exists", id, n))
+		}
+		checked := !items[n]
+		if done != nil {
+			checked = *done
+		}
+		t := *c.before
+		t.Note, _ = CheckItem(t.Note, n, checked)
+		if t.Note == c.before.Note {
+			c.after = c.before
+			return nil
+		}
+		if err := m.UpdateContext(ctx, &t); err != nil {
+			return err
+		}
+		c.after, err = m.FindContext(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if c.after != c.before {
+		commit(r, c)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if rendered {
+		return json.NewEncoder(w).Encode((*htmlTask)(c.after))
+	}
+	return json.NewEncoder(w).Encode(c.after)
+}
@@ -0,0 +1,222 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// checklistNote is a note with a checklist.
+const checklistNote = "Before:\n- [x] Find IBAN\n  * [ ] Check balance\n```\n- [ ] Not an item\n```\n1. [X] Pay\n- [] Not an item\n-  [ ]\r\n"
+
+func TestChecklist(t *testing.T) {
+	if got, want := ChecklistItems(checklistNote), []bool{true, false, true, false}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ChecklistItems(%q) = %v; want %v", checklistNote, got, want)
+	}
+	if got, want := ChecklistProgress(checklistNote), (Progress{2, 4}); got != want {
+		t.Errorf("ChecklistProgress(%q) = %v; want %v", checklistNote, got, want)
+	}
+	if got, want := ChecklistProgress("Buy milk"), (Progress{}); got != want {
+		t.Errorf("ChecklistProgress(%q) = %v; want %v", "Buy milk", got, want)
+	}
+
+	for _, test := range []struct {
+		n       int
+		checked bool
+		want    string
+		ok      bool
+	}{
+		{0, false, strings.Replace(checklistNote, "- [x] Find", "- [ ] Find", 1), true},
+		{0, true, checklistNote, true},
+		{1, true, strings.Replace(checklistNote, "* [ ] Check", "* [x] Check", 1), true},
+		{2, true, checklistNote, true},
+		{2, false, strings.Replace(checklistNote, "1. [X]", "1. [ ]", 1), true},
+		{3, true, strings.Replace(checklistNote, "-  [ ]\r", "-  [x]\r", 1), true},
+		{4, true, checklistNote, false},
+		{-1, true, checklistNote, false},
+	} {
+		got, ok := CheckItem(checklistNote, test.n, test.checked)
+		if got != test.want || ok != test.ok {
+			t.Errorf("CheckItem(%q, %d, %t) = %q, %t; want %q, %t", checklistNote, test.n, test.checked, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestRenderMarkdown(t *testing.T) {
+	for _, test := range []struct {
+		note, want string
+	}{
+		{"", ""},
+		{"Buy **fresh** *milk*\nand `bread`", "<p>Buy <strong>fresh</strong> <em>milk</em>\nand <code>bread</code></p>\n"},
+		{"2 * 3 * 4", "<p>2 * 3 * 4</p>\n"},
+		{"# Plan\n\n#hashtag\n## \n---", "<h1>Plan</h1>\n<p>#hashtag</p>\n<h2></h2>\n<hr>\n"},
+		{"<script>alert(1)</script> & `<b>`", "<p>&lt;script&gt;alert(1)&lt;/script&gt; &amp; <code>&lt;b&gt;</code></p>\n"},
+		{"[Go](https://golang.org/?a=1&b=\"2\") [mail](mailto:bob@example.com) [doc](/task/0)",
+			`<p><a href="https://golang.org/?a=1&amp;b=&#34;2&#34;" rel="nofollow noopener">Go</a> <a href="mailto:bob@example.com" rel="nofollow noopener">mail</a> <a href="/task/0" rel="nofollow noopener">doc</a></p>` + "\n"},
+		{"[x](javascript:alert(1)) [y](JavaScript:alert) [*z*](data:text/html,hi) [w](&#106;avascript:alert)",
+			"<p>[x](javascript:alert(1)) y <em>z</em> <a href=\"&amp;#106;avascript:alert\" rel=\"nofollow noopener\">w</a></p>\n"},
+		{"- [ ] Buy milk\n- [x] Pay *rent*\n\n- Call mom\n  Before 9pm\n\n  - [X] Find number\n* Other list",
+			"<ul>\n<li><input type=\"checkbox\" disabled> Buy milk</li>\n" +
+				"<li><input type=\"checkbox\" checked disabled> Pay <em>rent</em></li>\n" +
+				"<li>Call mom\n<p>Before 9pm</p>\n<ul>\n<li><input type=\"checkbox\" checked disabled> Find number</li>\n</ul>\n</li>\n" +
+				"<li>Other list</li>\n</ul>\n"},
+		{"3. Three\n4) Four\nText\n1. One", "<ol start=\"3\">\n<li>Three</li>\n<li>Four</li>\n</ol>\n<p>Text</p>\n<ol>\n<li>One</li>\n</ol>\n"},
+		{"> Quote *me*\n> - [ ] item\n\n```go\n<b>*x*</b>\n\n```\n~~~\nunclosed",
+			"<blockquote>\n<p>Quote <em>me</em></p>\n<ul>\n<li><input type=\"checkbox\" disabled> item</li>\n</ul>\n</blockquote>\n" +
+				"<pre><code>&lt;b&gt;*x*&lt;/b&gt;\n\n</code></pre>\n<pre><code>unclosed\n</code></pre>\n"},
+		{"Line 1\r\nLine 2\r\n## Next", "<p>Line 1\nLine 2</p>\n<h2>Next</h2>\n"},
+	} {
+		if got := RenderMarkdown(test.note); got != test.want {
+			t.Errorf("RenderMarkdown(%q)\n got %q\nwant %q", test.note, got, test.want)
+		}
+	}
+}
+
+func TestCheckItemReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	if err := addTasks(tasks, testTasks[:1], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	task := ptrToVal(tasks.All())[0]
+	task.Note = "- [ ] Find IBAN\n- [ ] Pay"
+	if err := tasks.Update(&task); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		path string
+		note string
+		html string
+		revs int // Number of the revisions of the task.
+	}{
+		{Path + "0/checklist/1", "- [ ] Find IBAN\n- [x] Pay", "", 1},
+		{Path + "0/checklist/1", "- [ ] Find IBAN\n- [ ] Pay", "", 2},
+		{Path + "0/checklist/0?done=false", "- [ ] Find IBAN\n- [ ] Pay", "", 2},
+		{Path + "0/checklist/0?done=true&note=html", "- [x] Find IBAN\n- [ ] Pay",
+			"<ul>\n<li><input type=\"checkbox\" checked disabled> Find IBAN</li>\n<li><input type=\"checkbox\" disabled> Pay</li>\n</ul>\n", 3},
+	} {
+		req, err := http.NewRequest("POST", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("POST %s: %v\nRecieve body: %q", test.path, err, rec.Body)
+			continue
+		}
+		var res struct {
+			Note      string   `json:"note"`
+			NoteHTML  string   `json:"noteHtml"`
+			Checklist Progress `json:"checklist"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("POST %s: cannot decode the response: %v", test.path, err)
+			continue
+		}
+		want := ChecklistProgress(test.note)
+		if res.Note != test.note || res.NoteHTML != test.html || res.Checklist != want {
+			t.Errorf("POST %s: got %q, %q, %v; want %q, %q, %v", test.path, res.Note, res.NoteHTML, res.Checklist, test.note, test.html, want)
+		}
+		if got, _ := tasks.Find(0); got.Note != test.note {
+			t.Errorf("POST %s: got stored note %q; want %q", test.path, got.Note, test.note)
+		}
+		if n := len(revisions.task(0)); n != test.revs {
+			t.Errorf("POST %s: got %d revisions; want %d", test.path, n, test.revs)
+		}
+	}
+
+	for _, test := range []struct {
+		method, path string
+		code         int
+	}{
+		{"POST", Path + "0/checklist/2", http.StatusNotFound},
+		{"POST", Path + "1/checklist/0", http.StatusNotFound},
+		{"POST", Path + "0/checklist/-1", http.StatusBadRequest},
+		{"POST", Path + "0/checklist/x", http.StatusBadRequest},
+		{"POST", Path + "0/checklist/0?done=maybe", http.StatusBadRequest},
+		{"POST", Path + "0/checklist/0?note=pdf", http.StatusBadRequest},
+		{"GET", Path + "0/checklist/0", http.StatusNotFound},
+		{"GET", Path + "0?note=pdf", http.StatusBadRequest},
+		{"GET", Path + "?note=pdf", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest(test.method, test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("%s %s: %v\nRecieve body: %q", test.method, test.path, err, rec.Body)
+		}
+	}
+}
+
+func TestReadNoteHTML(t *testing.T) {
+	tasks = NewManager()
+	if err := addTasks(tasks, testTasks[:2], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	task := ptrToVal(tasks.All())[1]
+	task.Note = "- [x] **Done**\n- [ ] <i>Todo</i>"
+	if err := tasks.Update(&task); err != nil {
+		t.Fatal(err)
+	}
+	html := "<ul>\n<li><input type=\"checkbox\" checked disabled> <strong>Done</strong></li>\n<li><input type=\"checkbox\" disabled> &lt;i&gt;Todo&lt;/i&gt;</li>\n</ul>\n"
+
+	for _, test := range []struct {
+		path string
+		want []string // The rendered notes of the tasks.
+	}{
+		{Path + "1?note=html", []string{html}},
+		{Path + "?note=html", []string{"", html}},
+		{Path + "1", nil},
+		{Path + "?note=markdown", nil},
+	} {
+		req, err := http.NewRequest("GET", test.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("GET %s: %v\nRecieve body: %q", test.path, err, rec.Body)
+			continue
+		}
+		type noteJSON struct {
+			NoteHTML  *string  `json:"noteHtml"`
+			Checklist Progress `json:"checklist"`
+		}
+		var res struct {
+			noteJSON
+			Tasks []noteJSON `json:"tasks"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("GET %s: cannot decode the response: %v", test.path, err)
+			continue
+		}
+		all := res.Tasks
+		if all == nil {
+			all = []noteJSON{res.noteJSON}
+		}
+		for i, n := range all {
+			switch {
+			case test.want == nil && n.NoteHTML != nil:
+				t.Errorf("GET %s: got rendered note %q; want none", test.path, *n.NoteHTML)
+			case test.want != nil && (n.NoteHTML == nil || *n.NoteHTML != test.want[i]):
+				t.Errorf("GET %s: got rendered note %v; want %q", test.path, n.NoteHTML, test.want[i])
+			}
+		}
+		if p := all[len(all)-1].Checklist; p != (Progress{1, 2}) {
+			t.Errorf("GET %s: got checklist %v; want %v", test.path, p, Progress{1, 2})
+		}
+	}
+}
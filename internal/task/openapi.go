@@ -0,0 +1,510 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// OpenAPIPath specifies the path of the OpenAPI document of the task APIs.
+const OpenAPIPath = "/openapi.json"
+
+// operation describes an operation of the task APIs in the OpenAPI document.
+type operation struct {
+	method, path string // The path is a template like /task/{id}.
+	summary      string
+	params       []param
+	body         []content // Request bodies in the accepted media types.
+	responses    []response
+}
+
+// param describes a parameter of an operation.
+type param struct {
+	name, in    string // The in is one of path, query or header.
+	description string
+	schema      interface{} // Schema, or a Go value of the parameter type.
+	example     interface{}
+	required    bool
+}
+
+// content describes a body of a request or a response in the media type.
+type content struct {
+	mediaType string
+	body      interface{} // Schema, or a Go value of the body type.
+	example   interface{}
+}
+
+// response describes a response of an operation with the status code.
+type response struct {
+	code        int
+	description string
+	content     []content
+}
+
+// schema is a schema of the OpenAPI document.
+type schema map[string]interface{}
+
+// enum returns the schema of the strings with the values.
+func enum(values ...string) schema {
+	return schema{"type": "string", "enum": values}
+}
+
+// keys returns the sorted keys of the map m.
+func keys(m interface{}) []string {
+	var k []string
+	for _, v := range reflect.ValueOf(m).MapKeys() {
+		k = append(k, v.String())
+	}
+	sort.Strings(k)
+	return k
+}
+
+var (
+	text = schema{"type": "string"}
+
+	idParam        = param{"id", "path", "ID of the task.", 0, 0, true}
+	deletedIDParam = param{"id", "path", "ID of the deleted task.", 0, 1, true}
+	userParam      = param{"user", "path", "Name of the user.", text, "bob", true}
+	noteParam      = param{"note", "query", "Format of the notes, html adds the note rendered in HTML as noteHtml.", enum("markdown", "html"), "html", false}
+	tzParam        = param{"tz", "query", "IANA time zone of the user for the date filters and the quick-add dates, UTC by default.", text, "Europe/Bratislava", false}
+
+	idempotencyKeyParam  = param{IdempotencyKeyHeader, "header", "Key which makes the retries of the request replay its response.", text, nil, false}
+	sessionParam         = param{SessionHeader, "header", "Session in which the changes can be undone.", text, nil, false}
+	requiredSessionParam = param{SessionHeader, "header", "Session of the operations.", text, "s1", true}
+
+	exampleTask = Task{ID: 0, Title: "Pay rent", Date: 1426806000, Note: "- [x] Find IBAN\n- [ ] Pay", Priority: PriorityHigh, Tags: []string{"finance"}}
+)
+
+// errorResponses returns the responses with the errors of the status codes.
+func errorResponses(codes ...int) []response {
+	var rs []response
+	for _, code := range codes {
+		rs = append(rs, response{code, http.StatusText(code), []content{{"text/plain", text, nil}}})
+	}
+	return rs
+}
+
+// taskResponse is the response with the task in JSON.
+var taskResponse = response{http.StatusOK, "The task.", []content{{"application/json", Task{}, nil}}}
+
+// tasksResponse is the response with the list of the tasks in JSON.
+var tasksResponse = response{http.StatusOK, "The tasks.", []content{{"application/json", struct {
+	Tasks []*Task `json:"tasks"`
+}{}, nil}}}
+
+// emptyResponse is the response without a body.
+var emptyResponse = response{http.StatusOK, "Done.", nil}
+
+// operations returns the operations of the task APIs.
+func operations() []operation {
+	filterParam := param{"filter", "query", "Filter of the tasks.", enum(append(keys(filters), keys(dateFilters)...)...), "isNotDone", false}
+	sortByParam := param{"sortBy", "query", "Order of the tasks.", enum(keys(sorters)...), "dateAsc", false}
+	validation := response{http.StatusUnprocessableEntity, "The task is invalid.", []content{
+		{"application/json", struct {
+			Error  string       `json:"error"`
+			Fields []FieldError `json:"fields"`
+		}{}, nil},
+		{"text/plain", text, nil},
+	}}
+	importRes := struct {
+		Applied bool           `json:"applied"`
+		Summary importSummary  `json:"summary"`
+		Results []importResult `json:"results"`
+	}{}
+
+	return []operation{
+		{"GET", Path, "Read all tasks",
+			[]param{filterParam, sortByParam, tzParam,
+				{"format", "query", "Format of the tasks, which is negotiated by the Accept header otherwise.", enum(keys(formats)...), nil, false},
+				noteParam},
+			nil,
+			append([]response{{http.StatusOK, "The tasks.", []content{
+				tasksResponse.content[0],
+				{"application/x-ndjson", text, nil},
+				{"text/csv", text, nil},
+				{"text/plain", text, nil},
+			}}}, errorResponses(http.StatusBadRequest)...)},
+		{"POST", Path, "Create a task",
+			[]param{tzParam, idempotencyKeyParam, sessionParam},
+			[]content{{"application/json", struct {
+				Title    string `json:"title"`
+				QuickAdd bool   `json:"quickAdd"`
+			}{}, map[string]interface{}{"title": "Pay rent tomorrow !high #finance", "quickAdd": true}}},
+			append([]response{{http.StatusOK, "The created task, with the recognized parts of the quick-add title.", []content{{"application/json",
+				schema{"oneOf": []interface{}{Task{}, struct {
+					Task       *Task        `json:"task"`
+					Recognized []Recognized `json:"recognized"`
+				}{}}}, nil}}}}, errorResponses(http.StatusBadRequest, http.StatusConflict, http.StatusRequestEntityTooLarge)...)},
+		{"GET", Path + "{id}", "Read a task",
+			[]param{idParam, noteParam},
+			nil,
+			append([]response{taskResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"PUT", Path + "{id}", "Update a task",
+			[]param{idParam, sessionParam},
+			[]content{{"application/json", Task{}, exampleTask}},
+			append([]response{emptyResponse, validation}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"DELETE", Path + "{id}", "Move a task to the trash",
+			[]param{idParam, sessionParam},
+			nil,
+			append([]response{emptyResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"GET", Path + "{id}/history", "Read the revisions of a task",
+			[]param{idParam},
+			nil,
+			append([]response{{http.StatusOK, "The revisions.", []content{{"application/json", struct {
+				Revisions []*Revision `json:"revisions"`
+			}{}, nil}}}}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"POST", Path + "{id}/revert", "Revert a task to a revision",
+			[]param{idParam, {"rev", "query", "Revision to revert to.", 0, 1, true}, sessionParam},
+			nil,
+			append([]response{emptyResponse, validation}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"POST", Path + "{id}/checklist/{item}", "Check a checklist item of the note of a task",
+			[]param{idParam,
+				{"item", "path", "Index of the checklist item, counted from zero.", 0, 0, true},
+				{"done", "query", "Whether the item is checked, it's toggled if missing.", false, true, false},
+				noteParam, idempotencyKeyParam, sessionParam},
+			nil,
+			append([]response{taskResponse, validation}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict, http.StatusRequestEntityTooLarge)...)},
+		{"GET", Path + "{id}/share", "Read the grants of a task",
+			[]param{idParam},
+			nil,
+			append([]response{grantsResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"POST", Path + "{id}/share", "Share a task",
+			[]param{idParam},
+			[]content{{"application/json", shareReq{}, shareReq{"bob", RoleEditor}}},
+			append([]response{emptyResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"DELETE", Path + "{id}/share/{user}", "Stop sharing a task",
+			[]param{idParam, userParam},
+			nil,
+			append([]response{emptyResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"POST", BulkPath, "Create, update and delete tasks at once",
+			[]param{idempotencyKeyParam, sessionParam},
+			[]content{{"application/json", struct {
+				Operations []*bulkOp `json:"operations"`
+			}{}, map[string]interface{}{"operations": []bulkOp{{Op: "create", Title: "Buy milk"}, {Op: "delete", ID: 0}}}}},
+			append([]response{
+				{http.StatusOK, "The outcomes of the operations, which were applied.", bulkRes},
+				{http.StatusBadRequest, "The outcomes of the operations, which weren't applied, or the error.", append(bulkRes, content{"text/plain", text, nil})},
+				validation,
+			}, errorResponses(http.StatusConflict, http.StatusRequestEntityTooLarge)...)},
+		{"POST", ImportPath, "Import tasks",
+			[]param{idempotencyKeyParam, sessionParam},
+			[]content{
+				{"text/plain", text, "(A) Pay rent +finance due:2015-03-20"},
+				{"text/calendar", text, nil},
+				{"text/markdown", text, nil},
+				{"application/json", text, nil},
+			},
+			append([]response{
+				{http.StatusOK, "The outcomes of the import of the tasks, which were created.", []content{{"application/json", importRes, nil}}},
+				{http.StatusBadRequest, "The outcomes of the import of the tasks, which weren't created, or the error.", []content{{"application/json", importRes, nil}, {"text/plain", text, nil}}},
+			}, errorResponses(http.StatusConflict, http.StatusRequestEntityTooLarge, http.StatusUnsupportedMediaType)...)},
+		{"POST", StreamImportPath, "Import tasks row by row",
+			[]param{
+				{"map", "query", "Mapping of a column to a task field like Due:date, or to - to skip it.", schema{"type": "array", "items": text}, "Due:date", false},
+				{"dryRun", "query", "Whether the rows are only checked.", false, true, false},
+				sessionParam,
+			},
+			[]content{{"text/csv", text, "title,date\nPay rent,2015-03-20\n"}, {"application/x-ndjson", text, nil}},
+			append([]response{{http.StatusOK, "The errors of the rows and the counts of the rows and the created tasks.", []content{{"application/json", struct {
+				DryRun  bool       `json:"dryRun"`
+				Errors  []rowError `json:"errors"`
+				Rows    int        `json:"rows"`
+				Created int        `json:"created"`
+			}{}, nil}}}}, errorResponses(http.StatusBadRequest, http.StatusUnsupportedMediaType)...)},
+
+		{"GET", TrashPath, "Read the deleted tasks",
+			nil,
+			nil,
+			[]response{tasksResponse}},
+		{"POST", TrashPath + "{id}" + restoreSuffix, "Restore a deleted task",
+			[]param{deletedIDParam, sessionParam},
+			nil,
+			append([]response{taskResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+		{"DELETE", TrashPath + "{id}", "Remove a deleted task permanently",
+			[]param{deletedIDParam, sessionParam},
+			nil,
+			append([]response{emptyResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound)...)},
+
+		{"GET", SharePath, "Read the grants of all tasks of the user",
+			nil,
+			nil,
+			[]response{grantsResponse}},
+		{"POST", SharePath, "Share all tasks of the user",
+			nil,
+			[]content{{"application/json", shareReq{}, shareReq{"bob", RoleViewer}}},
+			append([]response{emptyResponse}, errorResponses(http.StatusBadRequest)...)},
+		{"DELETE", SharePath + "{user}", "Stop sharing all tasks of the user",
+			[]param{userParam},
+			nil,
+			[]response{emptyResponse}},
+
+		{"POST", UndoPath, "Undo the last operation of the session",
+			[]param{requiredSessionParam},
+			nil,
+			append([]response{undoResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict)...)},
+		{"POST", RedoPath, "Redo the last undone operation of the session",
+			[]param{requiredSessionParam},
+			nil,
+			append([]response{undoResponse}, errorResponses(http.StatusBadRequest, http.StatusForbidden, http.StatusNotFound, http.StatusConflict)...)},
+
+		{"GET", CalendarPath, "Read the scheduled tasks as an iCalendar feed",
+			[]param{filterParam, sortByParam, tzParam,
+				{"component", "query", "Component of the tasks.", enum("VEVENT", "VTODO"), "VTODO", false}},
+			nil,
+			append([]response{{http.StatusOK, "The calendar.", []content{{"text/calendar", text, nil}}}}, errorResponses(http.StatusBadRequest)...)},
+	}
+}
+
+var (
+	grantsResponse = response{http.StatusOK, "The grants.", []content{{"application/json", struct {
+		Grants []*Grant `json:"grants"`
+	}{}, nil}}}
+
+	undoResponse = response{http.StatusOK, "The tasks in the state after the undo or the redo.", tasksResponse.content}
+
+	bulkRes = []content{{"application/json", struct {
+		Applied bool         `json:"applied"`
+		Results []bulkResult `json:"results"`
+	}{}, nil}}
+)
+
+// OpenAPI is a handler function that handles http requests
+// for the OpenAPI 3 document of the task APIs.
+func OpenAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch r.Method {
+	case "GET", "HEAD":
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(openAPI())
+	default:
+		err = &errRequest{fmt.Errorf("%s doesn't implemented", r.Method), http.StatusMethodNotAllowed}
+	}
+	errorHandler(w, r, err)
+}
+
+// openAPI returns the OpenAPI document of the operations.
+func openAPI() map[string]interface{} {
+	components := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+	for _, op := range operations() {
+		o := map[string]interface{}{"summary": op.summary}
+		var params []interface{}
+		for _, p := range op.params {
+			ps := map[string]interface{}{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.description,
+				"required":    p.required,
+				"schema":      schemaOf(components, p.schema),
+			}
+			if p.example != nil {
+				ps["example"] = p.example
+			}
+			params = append(params, ps)
+		}
+		if params != nil {
+			o["parameters"] = params
+		}
+		if op.body != nil {
+			o["requestBody"] = map[string]interface{}{"required": true, "content": contents(components, op.body)}
+		}
+		responses := make(map[string]interface{})
+		for _, r := range op.responses {
+			res := map[string]interface{}{"description": r.description}
+			if r.content != nil {
+				res["content"] = contents(components, r.content)
+			}
+			responses[fmt.Sprint(r.code)] = res
+		}
+		responses["401"] = map[string]interface{}{"$ref": "#/components/responses/Unauthorized"}
+		responses["500"] = map[string]interface{}{"$ref": "#/components/responses/Error"}
+		responses["503"] = map[string]interface{}{"$ref": "#/components/responses/Unavailable"}
+		o["responses"] = responses
+
+		if paths[op.path] == nil {
+			paths[op.path] = make(map[string]interface{})
+		}
+		paths[op.path][strings.ToLower(op.method)] = o
+	}
+
+	plain := map[string]interface{}{"text/plain": map[string]interface{}{"schema": text}}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "todo",
+			"version":     "1.0.0",
+			"description": "API of the tasks. The CalDAV server at /dav/ isn't described.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": components,
+			"responses": map[string]interface{}{
+				"Unauthorized": map[string]interface{}{"description": "Missing or invalid credentials.", "content": plain},
+				"Error":        map[string]interface{}{"description": "Internal server error.", "content": plain},
+				"Unavailable":  map[string]interface{}{"description": "The request was canceled or timed out.", "content": plain},
+			},
+			"securitySchemes": map[string]interface{}{
+				"bearer": map[string]interface{}{"type": "http", "scheme": "bearer"},
+				"basic":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"bearer": []string{}},
+			map[string]interface{}{"basic": []string{}},
+		},
+	}
+}
+
+// contents returns the content map of the bodies.
+func contents(components map[string]interface{}, cs []content) map[string]interface{} {
+	m := make(map[string]interface{})
+	for _, c := range cs {
+		mt := map[string]interface{}{"schema": schemaOf(components, c.body)}
+		if c.example != nil {
+			mt["example"] = c.example
+		}
+		m[c.mediaType] = mt
+	}
+	return m
+}
+
+// schemaOf returns the schema v, or the schema of the Go type of the
+// value v in JSON. The schemas of the named structs are added to the
+// components and referred to.
+func schemaOf(components map[string]interface{}, v interface{}) schema {
+	switch s := v.(type) {
+	case schema:
+		if one, ok := s["oneOf"].([]interface{}); ok {
+			var of []interface{}
+			for _, o := range one {
+				of = append(of, schemaOf(components, o))
+			}
+			return schema{"oneOf": of}
+		}
+		return s
+	case reflect.Type:
+		return typeSchema(components, s)
+	}
+	return typeSchema(components, reflect.TypeOf(v))
+}
+
+var (
+	taskType = reflect.TypeOf(Task{})
+	roleType = reflect.TypeOf(Role(0))
+)
+
+// typeSchema returns the schema of the Go type t in JSON.
+func typeSchema(components map[string]interface{}, t reflect.Type) schema {
+	switch t {
+	case taskType:
+		return ref(components, "Task", func() schema { return taskSchema(components) })
+	case roleType:
+		return enum(roleNames[:]...)
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return typeSchema(components, t.Elem())
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int64:
+		return schema{"type": "integer", "format": "int64"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schema{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Slice:
+		return schema{"type": "array", "items": typeSchema(components, t.Elem()), "nullable": true}
+	case reflect.Array:
+		return schema{"type": "array", "items": typeSchema(components, t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(components, t)
+		}
+		return ref(components, exportedName(t.Name()), func() schema { return structSchema(components, t) })
+	}
+	return schema{} // Any value, like interface{}.
+}
+
+// ref adds the schema made by fn to the components under
+// the name, unless it's there, and returns the reference to it.
+func ref(components map[string]interface{}, name string, fn func() schema) schema {
+	if _, ok := components[name]; !ok {
+		components[name] = nil // Break the recursion.
+		components[name] = fn()
+	}
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+// structSchema returns the schema of the struct type t in JSON. The fields
+// of the embedded structs are included and the fields without omitempty
+// are required.
+func structSchema(components map[string]interface{}, t reflect.Type) schema {
+	props := make(map[string]interface{})
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				add(ft)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = typeSchema(components, f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	s := schema{"type": "object", "properties": props}
+	if required != nil {
+		s["required"] = required
+	}
+	return s
+}
+
+// taskSchema returns the schema of Task in JSON, which has
+// the fields which are only written.
+func taskSchema(components map[string]interface{}) schema {
+	s := structSchema(components, reflect.TypeOf(plainTask{}))
+	props := s["properties"].(map[string]interface{})
+	props["date"] = schema{"type": "integer", "format": "int64",
+		"description": "Date as Unix time in seconds, or 0 if the task isn't scheduled. It's accepted also in the forms of dateString and as Unix time in milliseconds after the end of the year 9999 in seconds."}
+	props["dateString"] = schema{"type": "string", "readOnly": true,
+		"description": "Date in the RFC 3339 format in the time zone of the task, a day if the task is all-day, omitted if the task isn't scheduled."}
+	props["checklist"] = typeSchema(components, reflect.TypeOf(Progress{}))
+	props["noteHtml"] = schema{"type": "string", "description": "Note rendered in HTML, with note=html."}
+	return s
+}
+
+// exportedName returns the name with the first letter in upper case.
+func exportedName(name string) string {
+	r, n := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[n:]
+}
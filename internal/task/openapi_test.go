@@ -0,0 +1,405 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"math"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// apiDoc returns the OpenAPI document as it's decoded from JSON.
+func apiDoc(t *testing.T) map[string]interface{} {
+	data, err := json.Marshal(openAPI())
+	if err != nil {
+		t.Fatalf("cannot encode the OpenAPI document: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("cannot decode the OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+// apiHandler returns the handler of the task APIs which serves the path.
+func apiHandler(path string) http.HandlerFunc {
+	for _, h := range []struct {
+		prefix  string
+		handler http.HandlerFunc
+	}{
+		{TrashPath, TrashAPI},
+		{SharePath, ShareAPI},
+		{UndoPath, UndoAPI},
+		{RedoPath, UndoAPI},
+		{CalendarPath, CalendarAPI},
+		{Path, RestAPI},
+	} {
+		if strings.HasPrefix(path, h.prefix) {
+			return h.handler
+		}
+	}
+	return http.NotFound
+}
+
+// apiState initializes the tasks with the state in which every documented
+// operation with the examples succeeds: the task 0 with a checklist, which
+// has a revision and is shared, and the deleted task 1.
+func apiState(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	grants = newACL()
+	sessions = newJournals()
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", Path, `{"title":"Pay rent"}`},
+		{"POST", Path, `{"title":"Buy milk"}`},
+		{"PUT", Path + "0", `{"id":0,"title":"Pay rent","note":"- [ ] Find IBAN\n- [ ] Pay"}`},
+		{"DELETE", Path + "1", ""},
+		{"POST", Path + "0/share", `{"user":"bob","role":"viewer"}`},
+		{"POST", SharePath, `{"user":"bob","role":"viewer"}`},
+	} {
+		r, err := http.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set(SessionHeader, "s1")
+		rec := httptest.NewRecorder()
+		apiHandler(req.path)(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("HTTP request %s %s: got status code %d; want %d\nRecieve body: %q", req.method, req.path, rec.Code, http.StatusOK, rec.Body)
+		}
+	}
+}
+
+func TestOpenAPIReq(t *testing.T) {
+	for _, test := range []struct {
+		method string
+		code   int
+	}{
+		{"GET", http.StatusOK},
+		{"HEAD", http.StatusOK},
+		{"POST", http.StatusMethodNotAllowed},
+	} {
+		req, err := http.NewRequest(test.method, OpenAPIPath, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		OpenAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("%s %s: %v\nRecieve body: %q", test.method, OpenAPIPath, err, rec.Body)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+			t.Errorf("%s %s: got Content-Type %q; want %q", test.method, OpenAPIPath, got, want)
+		}
+		var doc struct {
+			OpenAPI string                 `json:"openapi"`
+			Paths   map[string]interface{} `json:"paths"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&doc); err != nil {
+			t.Errorf("%s %s: cannot decode the response: %v", test.method, OpenAPIPath, err)
+			continue
+		}
+		if doc.OpenAPI != "3.0.3" || len(doc.Paths) == 0 {
+			t.Errorf("%s %s: got openapi %q with %d paths; want 3.0.3 with the paths", test.method, OpenAPIPath, doc.OpenAPI, len(doc.Paths))
+		}
+	}
+}
+
+// TestOpenAPIQueryParams checks that the query parameters read by the
+// handlers are the documented ones.
+func TestOpenAPIQueryParams(t *testing.T) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, ".", func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go")
+	}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := make(map[string]bool)
+	isQuery := func(e ast.Expr) bool {
+		call, ok := e.(*ast.CallExpr)
+		if !ok {
+			return false
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "Query"
+	}
+	name := func(e ast.Expr) {
+		if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			s, _ := strconv.Unquote(lit.Value)
+			read[s] = true
+		}
+	}
+	for _, pkg := range pkgs {
+		ast.Inspect(pkg, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.CallExpr: // r.URL.Query().Get("name")
+				if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Get" && isQuery(sel.X) && len(n.Args) == 1 {
+					name(n.Args[0])
+				}
+			case *ast.IndexExpr: // r.URL.Query()["name"]
+				if isQuery(n.X) {
+					name(n.Index)
+				}
+			}
+			return true
+		})
+	}
+
+	documented := make(map[string]bool)
+	for _, op := range operations() {
+		for _, p := range op.params {
+			if p.in == "query" {
+				documented[p.name] = true
+			}
+		}
+	}
+	if !reflect.DeepEqual(read, documented) {
+		t.Errorf("got documented query parameters %v; want the ones read by the handlers %v", keys(documented), keys(read))
+	}
+}
+
+// TestOpenAPIOperations checks that the documented operations exist and
+// respond as documented.
+func TestOpenAPIOperations(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) }
+	doc := apiDoc(t)
+
+	for _, op := range operations() {
+		apiState(t)
+		if op.path == RedoPath { // There must be an operation to redo.
+			req, err := http.NewRequest("POST", UndoPath, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(SessionHeader, "s1")
+			UndoAPI(httptest.NewRecorder(), req)
+		}
+
+		path := op.path
+		query := make(url.Values)
+		header := make(http.Header)
+		for _, p := range op.params {
+			if p.example == nil {
+				continue
+			}
+			switch v := fmt.Sprint(p.example); p.in {
+			case "path":
+				path = strings.Replace(path, "{"+p.name+"}", v, 1)
+			case "query":
+				query.Set(p.name, v)
+			case "header":
+				header.Set(p.name, v)
+			}
+		}
+		var body []byte
+		if op.body != nil {
+			c := op.body[0]
+			if s, ok := c.example.(string); ok {
+				body = []byte(s)
+			} else {
+				var err error
+				if body, err = json.Marshal(c.example); err != nil {
+					t.Fatal(err)
+				}
+			}
+			header.Set("Content-Type", c.mediaType)
+		}
+		req, err := http.NewRequest(op.method, path+"?"+query.Encode(), bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header = header
+		rec := httptest.NewRecorder()
+		apiHandler(path)(rec, req)
+
+		name := op.method + " " + op.path
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("%s: %v\nRecieve body: %q", name, err, rec.Body)
+			continue
+		}
+		res := doc["paths"].(map[string]interface{})[op.path].(map[string]interface{})[strings.ToLower(op.method)].(map[string]interface{})["responses"].(map[string]interface{})["200"].(map[string]interface{})
+		content, ok := res["content"].(map[string]interface{})
+		if !ok {
+			if rec.Body.Len() != 0 {
+				t.Errorf("%s: got body %q; want none", name, rec.Body)
+			}
+			continue
+		}
+		mt, _, err := mime.ParseMediaType(rec.Header().Get("Content-Type"))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		c, ok := content[mt].(map[string]interface{})
+		if !ok {
+			t.Errorf("%s: got undocumented Content-Type %q", name, mt)
+			continue
+		}
+		if mt != "application/json" {
+			continue
+		}
+		var v interface{}
+		if err := json.Unmarshal(rec.Body.Bytes(), &v); err != nil {
+			t.Errorf("%s: cannot decode the response: %v", name, err)
+			continue
+		}
+		if err := validate(doc, c["schema"].(map[string]interface{}), v, "body"); err != nil {
+			t.Errorf("%s: the response doesn't match the documented schema: %v\nRecieve body: %q", name, err, rec.Body)
+		}
+	}
+}
+
+// TestOpenAPIMethods checks that the methods which aren't documented
+// for a path aren't handled.
+func TestOpenAPIMethods(t *testing.T) {
+	methods := make(map[string]map[string]bool)
+	examples := make(map[string]string)
+	for _, op := range operations() {
+		if methods[op.path] == nil {
+			methods[op.path] = make(map[string]bool)
+		}
+		methods[op.path][op.method] = true
+		path := op.path
+		for _, p := range op.params {
+			if p.in == "path" {
+				path = strings.Replace(path, "{"+p.name+"}", fmt.Sprint(p.example), 1)
+			}
+		}
+		examples[op.path] = path
+	}
+
+	for tmpl, documented := range methods {
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+			if documented[method] {
+				continue
+			}
+			apiState(t)
+			path := examples[tmpl]
+			req, err := http.NewRequest(method, path, strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set(SessionHeader, "s1")
+			rec := httptest.NewRecorder()
+			apiHandler(path)(rec, req)
+			if rec.Code < http.StatusBadRequest {
+				t.Errorf("%s %s: got status code %d; want an error, as it isn't documented", method, path, rec.Code)
+			}
+		}
+	}
+}
+
+// validate checks that the value v decoded from JSON matches the schema s.
+func validate(doc, s map[string]interface{}, v interface{}, at string) error {
+	if ref, ok := s["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/components/schemas/")
+		s, ok = doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})[name].(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: unknown schema %q", at, ref)
+		}
+	}
+	if one, ok := s["oneOf"].([]interface{}); ok {
+		var errs []string
+		for _, o := range one {
+			err := validate(doc, o.(map[string]interface{}), v, at)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err.Error())
+		}
+		return fmt.Errorf("%s: doesn't match any schema: %s", at, strings.Join(errs, "; "))
+	}
+	if v == nil {
+		if s["nullable"] == true || s["type"] == nil {
+			return nil
+		}
+		return fmt.Errorf("%s: got null; want %v", at, s["type"])
+	}
+
+	var ok bool
+	switch s["type"] {
+	case "object":
+		var m map[string]interface{}
+		if m, ok = v.(map[string]interface{}); !ok {
+			break
+		}
+		props, _ := s["properties"].(map[string]interface{})
+		required, _ := s["required"].([]interface{})
+		for _, r := range required {
+			if _, ok := m[r.(string)]; !ok {
+				return fmt.Errorf("%s: missing required property %q", at, r)
+			}
+		}
+		names := make([]string, 0, len(m))
+		for k := range m {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			ps, ok := props[k].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s: undocumented property %q", at, k)
+			}
+			if err := validate(doc, ps, m[k], at+"."+k); err != nil {
+				return err
+			}
+		}
+	case "array":
+		var a []interface{}
+		if a, ok = v.([]interface{}); !ok {
+			break
+		}
+		for i, e := range a {
+			if err := validate(doc, s["items"].(map[string]interface{}), e, fmt.Sprintf("%s[%d]", at, i)); err != nil {
+				return err
+			}
+		}
+	case "string":
+		var str string
+		if str, ok = v.(string); ok && s["enum"] != nil {
+			ok = false
+			for _, e := range s["enum"].([]interface{}) {
+				ok = ok || e == str
+			}
+		}
+	case "integer":
+		var f float64
+		f, ok = v.(float64)
+		ok = ok && f == math.Trunc(f)
+	case "number":
+		_, ok = v.(float64)
+	case "boolean":
+		_, ok = v.(bool)
+	default:
+		ok = true // Any value.
+	}
+	if !ok {
+		return fmt.Errorf("%s: got %v; want %v %v", at, v, s["type"], s["enum"])
+	}
+	return nil
+}
@@ -0,0 +1,373 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Recognized describes a part of the quick-add text parsed into a task field.
+type Recognized struct {
+	Text  string `json:"text"`  // The words as they were written.
+	Field string `json:"field"` // One of date, priority, tags or contexts.
+}
+
+var (
+	// clock12 matches times like 9am or 9:30pm.
+	clock12 = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+
+	// clock24 matches times like 21:00.
+	clock24 = regexp.MustCompile(`^(\d{1,2}):(\d{2})$`)
+
+	// ordinal matches days of the month like 18 or 18th.
+	ordinal = regexp.MustCompile(`^(\d{1,2})(?:st|nd|rd|th)?$`)
+)
+
+// priorities maps the priority markers to priorities.
+var priorities = map[string]byte{
+	"!":       PriorityLow,
+	"!!":      PriorityMedium,
+	"!!!":     PriorityHigh,
+	"!low":    PriorityLow,
+	"!med":    PriorityMedium,
+	"!medium": PriorityMedium,
+	"!high":   PriorityHigh,
+}
+
+// connectors are the words which may precede a date or a time.
+var connectors = map[string]bool{"on": true, "at": true, "by": true, "due": true}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tues": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thur": time.Thursday, "thurs": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var months = map[string]time.Month{
+	"jan": time.January, "january": time.January,
+	"feb": time.February, "february": time.February,
+	"mar": time.March, "march": time.March,
+	"apr": time.April, "april": time.April,
+	"may": time.May,
+	"jun": time.June, "june": time.June,
+	"jul": time.July, "july": time.July,
+	"aug": time.August, "august": time.August,
+	"sep": time.September, "sept": time.September, "september": time.September,
+	"oct": time.October, "october": time.October,
+	"nov": time.November, "november": time.November,
+	"dec": time.December, "december": time.December,
+}
+
+// ParseQuickAdd parses the quick-add text like "Pay rent tomorrow 9am !high
+// #finance @home" into a task. The dates are taken relative to now in its
+// location; a day without the time makes the task all-day. The priority
+// markers are !, !! and !!! or !low, !medium and !high, the words starting
+// with # are tags and the ones starting with @ are contexts. The rest of
+// the text is the title. The recognized parts are reported in text order.
+func ParseQuickAdd(text string, now time.Time) (*Task, []Recognized) {
+	p := &quickAdd{now: now, words: strings.Fields(text), task: new(Task)}
+	for i := 0; i < len(p.words); {
+		if n := p.match(i); n > 0 {
+			i += n
+			continue
+		}
+		p.title = append(p.title, p.words[i])
+		i++
+	}
+
+	t := p.task
+	t.Title = strings.Join(p.title, " ")
+	if t.Title == "" {
+		t.Title = strings.Join(p.words, " ")
+	}
+	loc := now.Location()
+	switch {
+	case !p.instant.IsZero():
+		t.Date = p.instant.Unix()
+	case !p.day.IsZero() && p.timed:
+		t.Date = p.at(p.day).Unix()
+	case !p.day.IsZero():
+		t.Date, t.AllDay = p.day.Unix(), true
+	case p.timed:
+		d := p.at(midnight(now))
+		if !d.After(now) {
+			d = p.at(midnight(now).AddDate(0, 0, 1))
+		}
+		t.Date = d.Unix()
+	}
+	if t.Date != 0 && loc != time.UTC {
+		t.TimeZone = loc.String()
+	}
+	return t, p.rec
+}
+
+// quickAdd holds the state of parsing of a quick-add text.
+type quickAdd struct {
+	now   time.Time
+	words []string
+	task  *Task
+	title []string
+	rec   []Recognized
+
+	day          time.Time // Midnight of the recognized day.
+	timed        bool      // Whether the time of the day was recognized.
+	hour, minute int       // Time of the day.
+	instant      time.Time // Time given relative to now, like in 2 hours.
+}
+
+// word returns the i-th word in lower case without the trailing
+// punctuation, or "" if there isn't such word.
+func (p *quickAdd) word(i int) string {
+	if i >= len(p.words) {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(p.words[i], ",.;:?!"))
+}
+
+// recognize records that the words from i to j were parsed into field.
+func (p *quickAdd) recognize(i, j int, field string) int {
+	p.rec = append(p.rec, Recognized{strings.Join(p.words[i:j], " "), field})
+	return j - i
+}
+
+// at returns the recognized time of the day at the day d.
+func (p *quickAdd) at(d time.Time) time.Time {
+	return time.Date(d.Year(), d.Month(), d.Day(), p.hour, p.minute, 0, 0, d.Location())
+}
+
+// match parses the words starting at i into a task field.
+// It returns the number of the parsed words.
+func (p *quickAdd) match(i int) int {
+	w := p.words[i]
+	if pr, ok := priorities[strings.ToLower(w)]; ok && p.task.Priority == PriorityNone {
+		p.task.Priority = pr
+		return p.recognize(i, i+1, "priority")
+	}
+	if l, ok := label(w, '#'); ok {
+		p.task.Tags = appendNew(p.task.Tags, l)
+		return p.recognize(i, i+1, "tags")
+	}
+	if l, ok := label(w, '@'); ok {
+		p.task.Contexts = appendNew(p.task.Contexts, l)
+		return p.recognize(i, i+1, "contexts")
+	}
+
+	j := i
+	if connectors[p.word(i)] {
+		j++
+	}
+	if n := p.when(j); n > 0 {
+		return p.recognize(i, j+n, "date")
+	}
+	return 0
+}
+
+// when parses the date or the time starting at i.
+// It returns the number of the parsed words.
+func (p *quickAdd) when(i int) int {
+	if !p.instant.IsZero() {
+		return 0
+	}
+	if p.day.IsZero() {
+		if p.word(i) == "tonight" {
+			p.day = midnight(p.now)
+			if !p.timed {
+				p.timed, p.hour, p.minute = true, 20, 0
+			}
+			return 1
+		}
+		if d, n := p.matchDay(i); n > 0 {
+			p.day = d
+			return n
+		}
+	}
+	if !p.timed {
+		if h, m, n := p.matchClock(i); n > 0 {
+			p.timed, p.hour, p.minute = true, h, m
+			return n
+		}
+	}
+	if p.day.IsZero() && !p.timed {
+		return p.matchIn(i)
+	}
+	return 0
+}
+
+// matchDay parses the day starting at i. It returns
+// the midnight of the day and the number of the parsed words.
+func (p *quickAdd) matchDay(i int) (time.Time, int) {
+	today := midnight(p.now)
+	monday := today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+	w := p.word(i)
+	switch w {
+	case "today":
+		return today, 1
+	case "tomorrow", "tmr", "tmrw":
+		return today.AddDate(0, 0, 1), 1
+	case "day":
+		if p.word(i+1) == "after" && p.word(i+2) == "tomorrow" {
+			return today.AddDate(0, 0, 2), 3
+		}
+	case "next":
+		switch next := p.word(i + 1); next {
+		case "week":
+			return monday.AddDate(0, 0, 7), 2
+		case "month":
+			return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, today.Location()), 2
+		case "year":
+			return time.Date(today.Year()+1, time.January, 1, 0, 0, 0, 0, today.Location()), 2
+		default:
+			if wd, ok := weekdays[next]; ok {
+				return monday.AddDate(0, 0, 7+(int(wd)+6)%7), 2
+			}
+		}
+	}
+	if wd, ok := weekdays[w]; ok {
+		d := (int(wd) - int(today.Weekday()) + 6) % 7 // The next one after today.
+		return today.AddDate(0, 0, d+1), 1
+	}
+	if d, err := time.ParseInLocation(dateLayout, w, today.Location()); err == nil {
+		return d, 1
+	}
+
+	// Month names with the day of the month before or after them.
+	m, ok := months[w]
+	day, n := p.ordinal(i + 1)
+	if !ok {
+		day, n = p.ordinal(i)
+		m, ok = months[p.word(i+1)]
+	}
+	if !ok || n == 0 {
+		return time.Time{}, 0
+	}
+	n = 2
+	year, explicit := today.Year(), false
+	if y, err := strconv.Atoi(p.word(i + 2)); err == nil && len(p.word(i+2)) == 4 {
+		year, explicit, n = y, true, 3
+	}
+	d := time.Date(year, m, day, 0, 0, 0, 0, today.Location())
+	if d.Day() != day {
+		return time.Time{}, 0 // Like February 30.
+	}
+	if !explicit && d.Before(today) {
+		d = d.AddDate(1, 0, 0)
+	}
+	return d, n
+}
+
+// ordinal parses the day of the month at i. It returns
+// the day and 1, or 0 and 0 if there isn't such day.
+func (p *quickAdd) ordinal(i int) (int, int) {
+	m := ordinal.FindStringSubmatch(p.word(i))
+	if m == nil {
+		return 0, 0
+	}
+	d, _ := strconv.Atoi(m[1])
+	if d < 1 || d > 31 {
+		return 0, 0
+	}
+	return d, 1
+}
+
+// matchClock parses the time of the day starting at i. It returns
+// the hour, the minute and the number of the parsed words.
+func (p *quickAdd) matchClock(i int) (hour, minute, n int) {
+	w, n := p.word(i), 1
+	if w == "noon" {
+		return 12, 0, 1
+	}
+	if s := p.word(i + 1); (s == "am" || s == "pm") && (ordinal.MatchString(w) || clock24.MatchString(w)) {
+		w, n = w+s, 2
+	}
+	if m := clock12.FindStringSubmatch(w); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			minute, _ = strconv.Atoi(m[2])
+		}
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0, 0, 0
+		}
+		hour %= 12
+		if m[3] == "pm" {
+			hour += 12
+		}
+		return hour, minute, n
+	}
+	if m := clock24.FindStringSubmatch(w); m != nil {
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+		if hour > 23 || minute > 59 {
+			return 0, 0, 0
+		}
+		return hour, minute, 1
+	}
+	return 0, 0, 0
+}
+
+// matchIn parses the time relative to now like "in 3 days"
+// starting at i. It returns the number of the parsed words.
+func (p *quickAdd) matchIn(i int) int {
+	if p.word(i) != "in" {
+		return 0
+	}
+	n, err := strconv.Atoi(p.word(i + 1))
+	switch {
+	case p.word(i+1) == "a" || p.word(i+1) == "an":
+		n = 1
+	case err != nil || n < 1 || n > 999:
+		return 0
+	}
+	today := midnight(p.now)
+	switch strings.TrimSuffix(p.word(i+2), "s") {
+	case "min", "minute":
+		p.instant = p.now.Add(time.Duration(n) * time.Minute)
+	case "hr", "hour":
+		p.instant = p.now.Add(time.Duration(n) * time.Hour)
+	case "day":
+		p.day = today.AddDate(0, 0, n)
+	case "week":
+		p.day = today.AddDate(0, 0, 7*n)
+	case "month":
+		p.day = today.AddDate(0, n, 0)
+	case "year":
+		p.day = today.AddDate(n, 0, 0)
+	default:
+		return 0
+	}
+	return 3
+}
+
+// label returns the word w without the leading prefix and the trailing
+// punctuation if w is a label like #finance or @home.
+func label(w string, prefix byte) (string, bool) {
+	if len(w) < 2 || w[0] != prefix {
+		return "", false
+	}
+	l := strings.TrimRight(w[1:], ",.;:?!")
+	for i, r := range l {
+		if !(unicode.IsLetter(r) || i > 0 && (unicode.IsDigit(r) || strings.ContainsRune("-_/", r))) {
+			return "", false
+		}
+	}
+	return l, l != ""
+}
+
+// appendNew appends s to ss if it isn't there yet.
+func appendNew(ss []string, s string) []string {
+	for _, v := range ss {
+		if v == s {
+			return ss
+		}
+	}
+	return append(ss, s)
+}
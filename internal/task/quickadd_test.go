@@ -0,0 +1,188 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// unix returns the Unix time of the RFC 3339 date s.
+func unix(t *testing.T, s string) int64 {
+	d, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d.Unix()
+}
+
+func TestParseQuickAdd(t *testing.T) {
+	now := time.Date(2015, 3, 18, 15, 13, 10, 0, time.UTC) // Wednesday.
+	la, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		text string
+		now  time.Time
+		want Task
+		rec  []Recognized
+	}{
+		// Titles without anything to recognize.
+		{"Buy milk", now, Task{Title: "Buy milk"}, nil},
+		{"  Buy   milk ", now, Task{Title: "Buy milk"}, nil},
+		{"Fix bug #123", now, Task{Title: "Fix bug #123"}, nil},
+		{"Email bob@example.com", now, Task{Title: "Email bob@example.com"}, nil},
+		{"Read chapter 5", now, Task{Title: "Read chapter 5"}, nil},
+		{"Meet at the cafe", now, Task{Title: "Meet at the cafe"}, nil},
+		{"Pay feb 30", now, Task{Title: "Pay feb 30"}, nil},
+		{"Wait in line", now, Task{Title: "Wait in line"}, nil},
+		{"Hurry!", now, Task{Title: "Hurry!"}, nil},
+
+		// Everything at once.
+		{"Pay rent tomorrow 9am !high #finance @home", now,
+			Task{Title: "Pay rent", Date: unix(t, "2015-03-19T09:00:00Z"), Priority: PriorityHigh, Tags: []string{"finance"}, Contexts: []string{"home"}},
+			[]Recognized{{"tomorrow", "date"}, {"9am", "date"}, {"!high", "priority"}, {"#finance", "tags"}, {"@home", "contexts"}}},
+
+		// Priorities.
+		{"Call mom !", now, Task{Title: "Call mom", Priority: PriorityLow}, []Recognized{{"!", "priority"}}},
+		{"Call mom !!", now, Task{Title: "Call mom", Priority: PriorityMedium}, []Recognized{{"!!", "priority"}}},
+		{"!!! Call mom", now, Task{Title: "Call mom", Priority: PriorityHigh}, []Recognized{{"!!!", "priority"}}},
+		{"Call mom !Medium", now, Task{Title: "Call mom", Priority: PriorityMedium}, []Recognized{{"!Medium", "priority"}}},
+		{"Call mom !low !high", now, Task{Title: "Call mom !high", Priority: PriorityLow}, []Recognized{{"!low", "priority"}}},
+
+		// Tags and contexts.
+		{"Gym #health #sport #health", now, Task{Title: "Gym", Tags: []string{"health", "sport"}},
+			[]Recognized{{"#health", "tags"}, {"#sport", "tags"}, {"#health", "tags"}}},
+		{"Print slides @office, @work/laptop.", now, Task{Title: "Print slides", Contexts: []string{"office", "work/laptop"}},
+			[]Recognized{{"@office,", "contexts"}, {"@work/laptop.", "contexts"}}},
+		{"#finance", now, Task{Title: "#finance", Tags: []string{"finance"}}, []Recognized{{"#finance", "tags"}}},
+
+		// Relative days.
+		{"Call mom today", now, Task{Title: "Call mom", Date: unix(t, "2015-03-18T00:00:00Z"), AllDay: true}, []Recognized{{"today", "date"}}},
+		{"Call mom tmrw", now, Task{Title: "Call mom", Date: unix(t, "2015-03-19T00:00:00Z"), AllDay: true}, []Recognized{{"tmrw", "date"}}},
+		{"Call mom tomorrow, then dad", now, Task{Title: "Call mom then dad", Date: unix(t, "2015-03-19T00:00:00Z"), AllDay: true},
+			[]Recognized{{"tomorrow,", "date"}}},
+		{"Review day after tomorrow", now, Task{Title: "Review", Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true},
+			[]Recognized{{"day after tomorrow", "date"}}},
+		{"Report wed", now, Task{Title: "Report", Date: unix(t, "2015-03-25T00:00:00Z"), AllDay: true}, []Recognized{{"wed", "date"}}},
+		{"Report on Thursday", now, Task{Title: "Report", Date: unix(t, "2015-03-19T00:00:00Z"), AllDay: true}, []Recognized{{"on Thursday", "date"}}},
+		{"Plan next week", now, Task{Title: "Plan", Date: unix(t, "2015-03-23T00:00:00Z"), AllDay: true}, []Recognized{{"next week", "date"}}},
+		{"Plan next friday", now, Task{Title: "Plan", Date: unix(t, "2015-03-27T00:00:00Z"), AllDay: true}, []Recognized{{"next friday", "date"}}},
+		{"Plan next month", now, Task{Title: "Plan", Date: unix(t, "2015-04-01T00:00:00Z"), AllDay: true}, []Recognized{{"next month", "date"}}},
+		{"Plan next year", now, Task{Title: "Plan", Date: unix(t, "2016-01-01T00:00:00Z"), AllDay: true}, []Recognized{{"next year", "date"}}},
+		{"Renew in 3 days", now, Task{Title: "Renew", Date: unix(t, "2015-03-21T00:00:00Z"), AllDay: true}, []Recognized{{"in 3 days", "date"}}},
+		{"Renew in a week", now, Task{Title: "Renew", Date: unix(t, "2015-03-25T00:00:00Z"), AllDay: true}, []Recognized{{"in a week", "date"}}},
+		{"Renew in 2 months", now, Task{Title: "Renew", Date: unix(t, "2015-05-18T00:00:00Z"), AllDay: true}, []Recognized{{"in 2 months", "date"}}},
+		{"Check oven in 2 hours", now, Task{Title: "Check oven", Date: unix(t, "2015-03-18T17:13:10Z")}, []Recognized{{"in 2 hours", "date"}}},
+		{"Check oven in 45 min", now, Task{Title: "Check oven", Date: unix(t, "2015-03-18T15:58:10Z")}, []Recognized{{"in 45 min", "date"}}},
+
+		// Absolute days.
+		{"Taxes april 15", now, Task{Title: "Taxes", Date: unix(t, "2015-04-15T00:00:00Z"), AllDay: true}, []Recognized{{"april 15", "date"}}},
+		{"Taxes by Apr 15th", now, Task{Title: "Taxes", Date: unix(t, "2015-04-15T00:00:00Z"), AllDay: true}, []Recognized{{"by Apr 15th", "date"}}},
+		{"Birthday 18th march", now, Task{Title: "Birthday", Date: unix(t, "2015-03-18T00:00:00Z"), AllDay: true}, []Recognized{{"18th march", "date"}}},
+		{"Anniversary march 1", now, Task{Title: "Anniversary", Date: unix(t, "2016-03-01T00:00:00Z"), AllDay: true}, []Recognized{{"march 1", "date"}}},
+		{"Exam 2 june 2014", now, Task{Title: "Exam", Date: unix(t, "2014-06-02T00:00:00Z"), AllDay: true}, []Recognized{{"2 june 2014", "date"}}},
+		{"Deadline 2015-06-01", now, Task{Title: "Deadline", Date: unix(t, "2015-06-01T00:00:00Z"), AllDay: true}, []Recognized{{"2015-06-01", "date"}}},
+		{"Leap day feb 29 2016", now, Task{Title: "Leap day", Date: unix(t, "2016-02-29T00:00:00Z"), AllDay: true}, []Recognized{{"feb 29 2016", "date"}}},
+
+		// Times.
+		{"Call mom at 5pm", now, Task{Title: "Call mom", Date: unix(t, "2015-03-18T17:00:00Z")}, []Recognized{{"at 5pm", "date"}}},
+		{"Call mom at 9am", now, Task{Title: "Call mom", Date: unix(t, "2015-03-19T09:00:00Z")}, []Recognized{{"at 9am", "date"}}},
+		{"Call mom 5:30 pm", now, Task{Title: "Call mom", Date: unix(t, "2015-03-18T17:30:00Z")}, []Recognized{{"5:30 pm", "date"}}},
+		{"Call mom 21:45", now, Task{Title: "Call mom", Date: unix(t, "2015-03-18T21:45:00Z")}, []Recognized{{"21:45", "date"}}},
+		{"Lunch noon", now, Task{Title: "Lunch", Date: unix(t, "2015-03-19T12:00:00Z")}, []Recognized{{"noon", "date"}}},
+		{"Read book tonight", now, Task{Title: "Read book", Date: unix(t, "2015-03-18T20:00:00Z")}, []Recognized{{"tonight", "date"}}},
+		{"Standup 12pm tomorrow", now, Task{Title: "Standup", Date: unix(t, "2015-03-19T12:00:00Z")},
+			[]Recognized{{"12pm", "date"}, {"tomorrow", "date"}}},
+		{"Release 12am friday", now, Task{Title: "Release", Date: unix(t, "2015-03-20T00:00:00Z")},
+			[]Recognized{{"12am", "date"}, {"friday", "date"}}},
+		{"Meeting on friday at 10:30", now, Task{Title: "Meeting", Date: unix(t, "2015-03-20T10:30:00Z")},
+			[]Recognized{{"on friday", "date"}, {"at 10:30", "date"}}},
+		{"Party dec 31, 2016 9pm", now, Task{Title: "Party", Date: unix(t, "2016-12-31T21:00:00Z")},
+			[]Recognized{{"dec 31, 2016", "date"}, {"9pm", "date"}}},
+		{"Alarm 25:00 13pm", now, Task{Title: "Alarm 25:00 13pm"}, nil},
+
+		// Only the first date and time are recognized.
+		{"Move meeting monday to tuesday", now, Task{Title: "Move meeting to tuesday", Date: unix(t, "2015-03-23T00:00:00Z"), AllDay: true},
+			[]Recognized{{"monday", "date"}}},
+		{"Call in 2 hours or tomorrow", now, Task{Title: "Call or tomorrow", Date: unix(t, "2015-03-18T17:13:10Z")},
+			[]Recognized{{"in 2 hours", "date"}}},
+
+		// Time zones.
+		{"Pay rent tomorrow 9am", now.In(la), Task{Title: "Pay rent", Date: unix(t, "2015-03-19T09:00:00-07:00"), TimeZone: "America/Los_Angeles"},
+			[]Recognized{{"tomorrow", "date"}, {"9am", "date"}}},
+		{"Call mom today", now.In(la), Task{Title: "Call mom", Date: unix(t, "2015-03-18T00:00:00-07:00"), TimeZone: "America/Los_Angeles", AllDay: true},
+			[]Recognized{{"today", "date"}}},
+		{"Call mom at 7am", now.In(la), Task{Title: "Call mom", Date: unix(t, "2015-03-19T07:00:00-07:00"), TimeZone: "America/Los_Angeles"},
+			[]Recognized{{"at 7am", "date"}}},
+		{"Buy milk", now.In(la), Task{Title: "Buy milk"}, nil},
+	} {
+		got, rec := ParseQuickAdd(test.text, test.now)
+		if !reflect.DeepEqual(*got, test.want) {
+			t.Errorf("ParseQuickAdd(%q) = %v; want %v", test.text, *got, test.want)
+		}
+		if !reflect.DeepEqual(rec, test.rec) {
+			t.Errorf("ParseQuickAdd(%q) recognized %q; want %q", test.text, rec, test.rec)
+		}
+	}
+}
+
+func TestQuickAddReq(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) } // Wed 2015-03-18T15:13:10Z.
+	tasks = NewManager()
+
+	req, err := http.NewRequest("POST", Path+"?tz=Europe/Bratislava",
+		bytes.NewBufferString(`{"title":"Pay rent tomorrow 9am !high #finance @home","quickAdd":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s: %v\nRecieve body: %q", Path, err, rec.Body)
+	}
+	var res struct {
+		Task       *Task        `json:"task"`
+		Recognized []Recognized `json:"recognized"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("POST %s: cannot decode the response: %v", Path, err)
+	}
+	want := Task{
+		Title:    "Pay rent",
+		Date:     unix(t, "2015-03-19T09:00:00+01:00"),
+		Priority: PriorityHigh,
+		Tags:     []string{"finance"},
+		Contexts: []string{"home"},
+		TimeZone: "Europe/Bratislava",
+	}
+	if !reflect.DeepEqual(*res.Task, want) {
+		t.Errorf("POST %s: got task %v; want %v", Path, *res.Task, want)
+	}
+	if len(res.Recognized) != 5 {
+		t.Errorf("POST %s: got recognized %v; want 5 parts", Path, res.Recognized)
+	}
+	if got, ok := tasks.Find(0); !ok || !reflect.DeepEqual(*got, want) {
+		t.Errorf("POST %s: stored task %v; want %v", Path, got, want)
+	}
+
+	req, err = http.NewRequest("POST", Path, bytes.NewBufferString(`{"title":"Buy milk","quickAdd":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	RestAPI(rec, req)
+	if got, want := rec.Body.String(), `"recognized":[]`; !bytes.Contains([]byte(got), []byte(want)) {
+		t.Errorf("POST %s: got body %s; want %s", Path, got, want)
+	}
+}
@@ -0,0 +1,498 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamImportPath specifies the path of the streamed import resource.
+const StreamImportPath = Path + "_stream"
+
+// streamBatch is the number of rows of a streamed import created at once.
+const streamBatch = 100
+
+// errDryRun rolls back the transaction of a row imported in the dry-run mode.
+var errDryRun = errors.New("dry run")
+
+// csvColumns are the columns of the exported CSV.
+var csvColumns = []string{"id", "title", "date", "note", "priority", "done", "tags", "contexts", "timeZone", "allDay", "created", "completed", "uid", "owner"}
+
+// csvImported are the columns of the CSV which are imported.
+var csvImported = map[string]bool{
+	"title": true, "date": true, "note": true, "priority": true, "done": true, "tags": true,
+	"contexts": true, "timeZone": true, "allDay": true, "created": true, "completed": true, "uid": true,
+}
+
+// priorityNames are the names of the priorities in the CSV.
+var priorityNames = [...]string{PriorityNone: "none", PriorityLow: "low", PriorityMedium: "medium", PriorityHigh: "high"}
+
+// csvRecord returns the task as a CSV record with csvColumns. The dates
+// are written as in JSON and the tags and the contexts separated by spaces.
+func csvRecord(t *Task) []string {
+	var date, created, completed string
+	switch {
+	case t.Date == 0:
+	case t.AllDay:
+		date = t.Time().Format(dateLayout)
+	default:
+		date = t.Time().Format(time.RFC3339)
+	}
+	if t.Created != 0 {
+		created = time.Unix(t.Created, 0).UTC().Format(time.RFC3339)
+	}
+	if t.Completed != 0 {
+		completed = time.Unix(t.Completed, 0).UTC().Format(time.RFC3339)
+	}
+	priority := strconv.Itoa(int(t.Priority))
+	if int(t.Priority) < len(priorityNames) {
+		priority = priorityNames[t.Priority]
+	}
+	rec := []string{
+		strconv.Itoa(t.ID), t.Title, date, t.Note, priority, strconv.FormatBool(t.Done),
+		strings.Join(t.Tags, " "), strings.Join(t.Contexts, " "), t.TimeZone, strconv.FormatBool(t.AllDay),
+		created, completed, t.UID, t.Owner,
+	}
+	for i, v := range rec {
+		if v != "" && strings.IndexByte(csvEscaped, v[0]) >= 0 {
+			rec[i] = "'" + v
+		}
+	}
+	return rec
+}
+
+// csvEscaped lists the first characters of the cells prefixed with ' by
+// csvRecord, so spreadsheets don't evaluate shared tasks as formulas. The
+// prefix is also added to cells starting with ' and removed by csvTask.
+const csvEscaped = "=+-@\t\r'"
+
+// writeCSV writes the tasks to the response as CSV with a header.
+func writeCSV(w http.ResponseWriter, tasks []*Task) error {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	cw := csv.NewWriter(w)
+	cw.Write(csvColumns)
+	for _, t := range tasks {
+		if err := cw.Write(csvRecord(t)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeNDJSON writes the tasks to the response as JSON objects separated by newlines.
+func writeNDJSON(w http.ResponseWriter, tasks []*Task) error {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	for _, t := range tasks {
+		if err := enc.Encode(t); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// rowReader returns the next row of a streamed import, or io.EOF after the
+// last row. The rows which can't be parsed are returned with their errors;
+// an error returned by the reader ends the import.
+type rowReader func() (parsedTask, error)
+
+// streamReaders maps the media types of the streamed import formats to the
+// functions returning readers of the rows with the columns renamed by mapping.
+var streamReaders = map[string]func(r io.Reader, mapping map[string]string) (rowReader, error){
+	"text/csv":             newCSVReader,
+	"application/x-ndjson": newNDJSONReader,
+}
+
+// newCSVReader returns the reader of the CSV rows with a header naming the
+// columns. The columns named like the imported task fields, ignoring case,
+// are imported unless mapping maps them to other fields or to "" to skip
+// them. The other columns are skipped.
+func newCSVReader(r io.Reader, mapping map[string]string) (rowReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.LazyQuotes = true
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("missing header")
+	}
+	if err != nil {
+		return nil, err
+	}
+	fields := make([]string, len(header))
+	title := false
+	for i, h := range header {
+		h = strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")) // Spreadsheets write the byte order mark.
+		f, ok := mapping[h]
+		if !ok {
+			for c := range csvImported {
+				if strings.EqualFold(c, h) {
+					f = c
+				}
+			}
+		}
+		fields[i] = f
+		title = title || f == "title"
+	}
+	if !title {
+		return nil, fmt.Errorf("missing title column")
+	}
+	return func() (parsedTask, error) {
+		rec, err := cr.Read()
+		if err != nil {
+			return parsedTask{}, err
+		}
+		line, _ := cr.FieldPos(0)
+		t, err := csvTask(fields, rec)
+		return parsedTask{line: line, task: t, err: err}, nil
+	}, nil
+}
+
+// csvTask returns the task with the values of the record in the fields.
+func csvTask(fields, rec []string) (*Task, error) {
+	t := new(Task)
+	var date string
+	for i, f := range fields {
+		if f == "" || i >= len(rec) {
+			continue
+		}
+		r := rec[i]
+		if len(r) > 1 && r[0] == '\'' && strings.IndexByte(csvEscaped, r[1]) >= 0 {
+			r = r[1:]
+		}
+		v := strings.TrimSpace(r)
+		var err error
+		switch f {
+		case "title":
+			t.Title = r
+		case "note":
+			t.Note = r
+		case "date":
+			date = v
+		case "priority":
+			t.Priority, err = parsePriority(v)
+		case "done":
+			t.Done, err = parseBool(f, v)
+		case "allDay":
+			t.AllDay, err = parseBool(f, v)
+		case "tags":
+			for _, tag := range strings.Fields(v) {
+				t.Tags = appendNew(t.Tags, tag)
+			}
+		case "contexts":
+			for _, c := range strings.Fields(v) {
+				t.Contexts = appendNew(t.Contexts, c)
+			}
+		case "timeZone":
+			t.TimeZone = v
+		case "created":
+			t.Created, _, err = parseCSVDate(f, v, time.UTC)
+		case "completed":
+			t.Completed, _, err = parseCSVDate(f, v, time.UTC)
+		case "uid":
+			t.UID = v
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	d, day, err := parseCSVDate("date", date, t.Location())
+	if err != nil {
+		return nil, err
+	}
+	t.Date, t.AllDay = d, t.AllDay || day
+	if t.AllDay && t.Date != 0 {
+		t.Date = t.day(t.Location()).Unix()
+	}
+	return t, nil
+}
+
+// parsePriority parses the name or the number of a priority.
+func parsePriority(v string) (byte, error) {
+	if v == "" {
+		return PriorityNone, nil
+	}
+	for p, n := range priorityNames {
+		if strings.EqualFold(n, v) {
+			return byte(p), nil
+		}
+	}
+	if p, err := strconv.ParseUint(v, 10, 8); err == nil {
+		return byte(p), nil
+	}
+	return 0, fmt.Errorf("priority: %q isn't one of none, low, medium, high or a number", v)
+}
+
+// parseBool parses the value of the boolean field, where empty is false.
+func parseBool(field, v string) (bool, error) {
+	if v == "" {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("%s: %q isn't true or false", field, v)
+	}
+	return b, nil
+}
+
+// parseCSVDate parses the date of the field as in JSON and
+// reports whether it's a day without the time.
+func parseCSVDate(field, v string, loc *time.Location) (int64, bool, error) {
+	if v == "" {
+		return 0, false, nil
+	}
+	raw := strconv.Quote(v)
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		raw = v
+	}
+	d, err := parseDate(json.RawMessage(raw), loc)
+	if err != nil {
+		return 0, false, fmt.Errorf("%s: %q isn't a day, Unix time or in the RFC 3339 format", field, v)
+	}
+	_, err = time.Parse(dateLayout, v)
+	return d, err == nil, nil
+}
+
+// newNDJSONReader returns the reader of the JSON tasks separated by
+// newlines. The blank lines are skipped. The keys of the objects
+// are renamed by mapping, or removed if they're mapped to "".
+func newNDJSONReader(r io.Reader, mapping map[string]string) (rowReader, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	n := 0
+	return func() (parsedTask, error) {
+		for s.Scan() {
+			n++
+			b := s.Bytes()
+			if len(strings.TrimSpace(string(b))) == 0 {
+				continue
+			}
+			t, err := ndjsonTask(b, mapping)
+			return parsedTask{line: n, task: t, err: err}, nil
+		}
+		if err := s.Err(); err != nil {
+			return parsedTask{line: n + 1}, err
+		}
+		return parsedTask{}, io.EOF
+	}, nil
+}
+
+// ndjsonTask returns the task of the JSON object b with the keys renamed by mapping.
+func ndjsonTask(b []byte, mapping map[string]string) (*Task, error) {
+	if len(mapping) > 0 {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(b, &obj); err != nil {
+			return nil, err
+		}
+		renamed := make(map[string]json.RawMessage)
+		for k, v := range obj {
+			if f, ok := mapping[k]; ok {
+				k = f
+			}
+			if k != "" {
+				renamed[k] = v
+			}
+		}
+		var err error
+		if b, err = json.Marshal(renamed); err != nil {
+			return nil, err
+		}
+	}
+	t := new(Task)
+	if err := json.Unmarshal(b, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// columnMapping returns the mapping of the columns given by the map
+// query parameters like "Due date:date". The columns mapped to ""
+// or "-" are skipped.
+func columnMapping(r *http.Request) (map[string]string, error) {
+	mapping := make(map[string]string)
+	for _, m := range r.URL.Query()["map"] {
+		i := strings.LastIndexByte(m, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("map: %q isn't in the column:field format", m)
+		}
+		col, f := m[:i], m[i+1:]
+		if f == "-" {
+			f = ""
+		}
+		if f != "" && !csvImported[f] {
+			return nil, fmt.Errorf("map: unknown field %q", f)
+		}
+		mapping[col] = f
+	}
+	return mapping, nil
+}
+
+// rowError reports the error of a row of a streamed import.
+type rowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// createRows creates the tasks of the rows parsed without errors and
+// returns their number and the errors of the rows. The tasks are created
+// in one transaction, so the storage saves them at once, and only if it
+// fails they're created row by row to create the valid rows anyway.
+func createRows(r *http.Request, rows []parsedTask, dryRun bool) (int, []error) {
+	errs := make([]error, len(rows))
+	valid := 0
+	for i, p := range rows {
+		if errs[i] = p.err; p.err == nil {
+			valid++
+		}
+	}
+	if valid == 0 {
+		return 0, errs
+	}
+	changes := make([]change, len(rows))
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		for i, p := range rows {
+			if p.err != nil {
+				continue
+			}
+			if changes[i].after, err = createTaskFrom(ctx, m, p.task, owner(r)); err != nil {
+				return err
+			}
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		for i, p := range rows {
+			if p.err == nil {
+				commit(r, changes[i])
+			}
+		}
+		return valid, errs
+	case err == errDryRun:
+		return valid, errs
+	case isContextError(err):
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = err
+				break
+			}
+		}
+		return 0, errs
+	}
+
+	created := 0
+	for i, p := range rows {
+		if p.err != nil {
+			continue
+		}
+		var c change
+		err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+			if c.after, err = createTaskFrom(ctx, m, p.task, owner(r)); err != nil {
+				return err
+			}
+			if dryRun {
+				return errDryRun
+			}
+			return nil
+		})
+		switch {
+		case err == nil:
+			commit(r, c)
+			created++
+		case err == errDryRun:
+			created++
+		default:
+			errs[i] = err
+		}
+		if isContextError(err) {
+			break
+		}
+	}
+	return created, errs
+}
+
+// importStream handles requests for the creation of tasks from the rows of
+// the request body in one of the streamed import formats selected by its
+// content type. The rows are read one by one and created in batches of
+// streamBatch rows, so the valid rows are created even if other rows fail. In the dry-run mode the rows are
+// checked but no task is created. The response is streamed too: it reports
+// the errors of the rows as they happen, followed by the number of rows and
+// of the tasks which were, or in the dry-run mode would be, created.
+func importStream(w http.ResponseWriter, r *http.Request) error {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	newReader, ok := streamReaders[mt]
+	if !ok {
+		return &errRequest{fmt.Errorf("unsupported content type %q, want text/csv or application/x-ndjson", mt), http.StatusUnsupportedMediaType}
+	}
+	mapping, err := columnMapping(r)
+	if err != nil {
+		return badRequestError(err)
+	}
+	dryRun := false
+	if v := r.URL.Query().Get("dryRun"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			return badRequestError(fmt.Errorf("dryRun: %q isn't true or false", v))
+		}
+	}
+	next, err := newReader(r.Body, mapping)
+	if err != nil {
+		return badRequestError(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, `{"dryRun":%t,"errors":[`, dryRun)
+	sep := "\n"
+	report := func(line int, err error) {
+		b, _ := json.Marshal(rowError{line, err.Error()})
+		bw.WriteString(sep)
+		bw.Write(b)
+		sep = ",\n"
+	}
+	rows, created := 0, 0
+	var batch []parsedTask
+	for done := false; !done; {
+		p, err := next()
+		if err != nil && err != io.EOF {
+			batch = append(batch, parsedTask{line: p.line, err: err})
+		} else if err == nil {
+			rows++
+			batch = append(batch, p)
+		}
+		done = err != nil
+		if len(batch) < streamBatch && !done {
+			continue
+		}
+		n, errs := createRows(r, batch, dryRun)
+		created += n
+		for i, err := range errs {
+			if err != nil {
+				report(batch[i].line, err)
+			}
+			if isContextError(err) {
+				done = true
+				break
+			}
+		}
+		batch = batch[:0]
+	}
+	fmt.Fprintf(bw, "\n],\"rows\":%d,\"created\":%d}\n", rows, created)
+	return bw.Flush()
+}
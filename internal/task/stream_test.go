@@ -0,0 +1,249 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCSVRecord(t *testing.T) {
+	fields := make([]string, len(csvColumns))
+	for i, c := range csvColumns {
+		if csvImported[c] {
+			fields[i] = c
+		}
+	}
+	for _, test := range []struct {
+		task   Task
+		record []string
+	}{
+		{Task{Title: "Buy milk"}, []string{"0", "Buy milk", "", "", "none", "false", "", "", "", "false", "", "", "", ""}},
+		{Task{ID: 2, Title: "Pay rent, now", Note: "Line 1\n\"Line 2\"", Priority: PriorityHigh, Done: true,
+			Date: unix(t, "2015-03-20T00:00:00+01:00"), AllDay: true, TimeZone: "Europe/Bratislava",
+			Tags: []string{"finance", "home"}, Contexts: []string{"phone"}, Created: unix(t, "2015-03-10T08:00:00Z"),
+			Completed: unix(t, "2015-03-18T10:30:00Z"), UID: "abc", Owner: "alice"},
+			[]string{"2", "Pay rent, now", "2015-03-20", "Line 1\n\"Line 2\"", "high", "true", "finance home", "phone",
+				"Europe/Bratislava", "true", "2015-03-10T08:00:00Z", "2015-03-18T10:30:00Z", "abc", "alice"}},
+		{Task{Title: "Call mom", Date: unix(t, "2015-03-20T21:45:00-04:00"), TimeZone: "America/New_York", Priority: PriorityLow},
+			[]string{"0", "Call mom", "2015-03-20T21:45:00-04:00", "", "low", "false", "", "", "America/New_York", "false", "", "", "", ""}},
+		{Task{Title: "=HYPERLINK(\"http://example.com\")", Note: "+1", Tags: []string{"-x"}, Contexts: []string{"@home"}},
+			[]string{"0", "'=HYPERLINK(\"http://example.com\")", "", "'+1", "none", "false", "'-x", "'@home", "", "false", "", "", "", ""}},
+		{Task{Title: "'quoted'", Note: "\tindented"},
+			[]string{"0", "''quoted'", "", "'\tindented", "none", "false", "", "", "", "false", "", "", "", ""}},
+	} {
+		got := csvRecord(&test.task)
+		if !reflect.DeepEqual(got, test.record) {
+			t.Errorf("csvRecord(%v) = %q; want %q", test.task, got, test.record)
+		}
+		want := test.task
+		want.ID, want.Owner = 0, ""
+		if task, err := csvTask(fields, got); err != nil || !reflect.DeepEqual(*task, want) {
+			t.Errorf("csvTask(%q) = %v, %v; want %v, <nil>", got, task, err, want)
+		}
+	}
+}
+
+func TestCSVTask(t *testing.T) {
+	fields := []string{"title", "date", "priority", "done", "timeZone", "", "created"}
+	for _, test := range []struct {
+		record []string
+		task   Task
+		ok     bool
+	}{
+		{[]string{"Buy milk"}, Task{Title: "Buy milk"}, true},
+		{[]string{"Buy milk", " 2015-03-20 ", "Medium", "1", "", "ignored"},
+			Task{Title: "Buy milk", Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true, Priority: PriorityMedium, Done: true}, true},
+		{[]string{"Buy milk", "2015-03-20", "3", "", "America/New_York", "", "1426233600"},
+			Task{Title: "Buy milk", Date: unix(t, "2015-03-20T00:00:00-04:00"), AllDay: true, TimeZone: "America/New_York",
+				Priority: PriorityHigh, Created: unix(t, "2015-03-13T08:00:00Z")}, true},
+		{[]string{"Buy milk", "1426842000000"}, Task{Title: "Buy milk", Date: unix(t, "2015-03-20T09:00:00Z")}, true},
+		{[]string{"Buy milk", "tomorrow"}, Task{}, false},
+		{[]string{"Buy milk", "", "urgent"}, Task{}, false},
+		{[]string{"Buy milk", "", "", "yes"}, Task{}, false},
+		{[]string{"Buy milk", "", "", "", "", "", "2015-03-32"}, Task{}, false},
+	} {
+		got, err := csvTask(fields, test.record)
+		if (err == nil) != test.ok {
+			t.Errorf("csvTask(%q): got error %v; want error: %t", test.record, err, !test.ok)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*got, test.task) {
+			t.Errorf("csvTask(%q) = %v; want %v", test.record, *got, test.task)
+		}
+	}
+}
+
+func TestReadAllFormats(t *testing.T) {
+	tasks = NewManager()
+	if err := addTasks(tasks, testTasks[:2], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	for _, test := range []struct {
+		query, accept, contentType string
+		lines                      int
+	}{
+		{"", "", "application/json", 1},
+		{"", "text/csv", "text/csv; charset=utf-8", 3},
+		{"", "application/x-ndjson", "application/x-ndjson", 2},
+		{"", "text/html, text/csv;q=0.5, application/x-ndjson;q=0.9", "application/x-ndjson", 2},
+		{"", "image/png", "application/json", 1},
+		{"?format=csv", "application/json", "text/csv; charset=utf-8", 3},
+		{"?format=todotxt", "", "text/plain; charset=utf-8", 2},
+	} {
+		req, err := http.NewRequest("GET", Path+test.query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", test.accept)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("GET %s Accept %q: %v\nRecieve body: %q", Path+test.query, test.accept, err, rec.Body)
+			continue
+		}
+		if got := rec.Header().Get("Content-Type"); got != test.contentType {
+			t.Errorf("GET %s Accept %q: got content type %q; want %q", Path+test.query, test.accept, got, test.contentType)
+		}
+		if got := strings.Count(rec.Body.String(), "\n"); got != test.lines {
+			t.Errorf("GET %s Accept %q: got %d lines; want %d\nRecieve body: %q", Path+test.query, test.accept, got, test.lines, rec.Body)
+		}
+	}
+}
+
+// streamResult is the response of the streamed import.
+type streamResult struct {
+	DryRun  bool       `json:"dryRun"`
+	Errors  []rowError `json:"errors"`
+	Rows    int        `json:"rows"`
+	Created int        `json:"created"`
+}
+
+func TestStreamImportReq(t *testing.T) {
+	tasks = Wrap(NewManager(), Validate(DefaultRules))
+	defer func() { tasks = NewManager() }()
+	revisions = newHistory()
+
+	for _, test := range []struct {
+		query, contentType, body string
+		res                      streamResult
+		count                    int // Number of tasks after the import.
+	}{
+		{"?dryRun=true", "text/csv", "Title,Date,Priority\nBuy milk,2015-03-20,high\n,,\nPay rent,tomorrow,\n",
+			streamResult{true, []rowError{{3, "create: invalid task: title: is required"}, {4, `date: "tomorrow" isn't a day, Unix time or in the RFC 3339 format`}}, 3, 1}, 0},
+		{"?map=Due:date&map=Priority:-", "text/csv; charset=utf-8", "\ufeffTitle,Due,Priority\nBuy milk,2015-03-20,urgent\n\"Pay\nrent\",,\n",
+			streamResult{false, []rowError{}, 2, 2}, 2},
+		{"", "application/x-ndjson", `{"title":"Call mom","date":"2015-03-20","allDay":true}` + "\n\n" + `{"title":5}` + "\n" + `{"title":"Read"`,
+			streamResult{false, []rowError{{3, "json: cannot unmarshal number into Go struct field jsonTask.title of type string"}, {4, "unexpected end of JSON input"}}, 3, 1}, 3},
+		{"?map=name:title&map=id:", "application/x-ndjson", `{"id":7,"name":"Walk dog","priority":9}`,
+			streamResult{false, []rowError{{1, "update: invalid task: priority: must be between 0 and 3"}}, 1, 0}, 3},
+		{"", "text/csv", "Title,UID\nWalk dog,task-0@todo\nFeed cat,abc\nFeed fish,abc\n",
+			streamResult{false, []rowError{{4, `UID is used by another task: "abc"`}}, 3, 2}, 5},
+		{"", "application/x-ndjson", `{"title":"Read","uid":"task-1@todo"}` + "\n" + `{"title":"Read","uid":"abc"}`,
+			streamResult{false, []rowError{{2, `UID is used by another task: "abc"`}}, 2, 1}, 6},
+	} {
+		req, err := http.NewRequest("POST", StreamImportPath+test.query, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Errorf("POST %s %q: %v\nRecieve body: %q", StreamImportPath+test.query, test.body, err, rec.Body)
+			continue
+		}
+		var res streamResult
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("POST %s %q: cannot decode the response: %v", StreamImportPath+test.query, test.body, err)
+			continue
+		}
+		if !reflect.DeepEqual(res, test.res) {
+			t.Errorf("POST %s %q: got %+v; want %+v", StreamImportPath+test.query, test.body, res, test.res)
+		}
+		if n := tasks.Count(); n != test.count {
+			t.Errorf("POST %s %q: got %d tasks; want %d", StreamImportPath+test.query, test.body, n, test.count)
+		}
+	}
+	if got, want := ptrToVal(tasks.All())[1], (Task{ID: 1, Title: "Pay\nrent"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got imported task %v; want %v", got, want)
+	}
+	if n := len(revisions.task(0)); n != 1 {
+		t.Errorf("got %d revisions of imported task; want 1", n)
+	}
+
+	for _, test := range []struct {
+		query, contentType, body string
+		code                     int
+	}{
+		{"", "text/plain", "Buy milk", http.StatusUnsupportedMediaType},
+		{"", "text/csv", "", http.StatusBadRequest},
+		{"", "text/csv", "Name,Due\nBuy milk,", http.StatusBadRequest},
+		{"?map=Name", "text/csv", "Name\nBuy milk", http.StatusBadRequest},
+		{"?map=Name:owner", "text/csv", "Name\nBuy milk", http.StatusBadRequest},
+		{"?dryRun=maybe", "text/csv", "Title\nBuy milk", http.StatusBadRequest},
+	} {
+		req, err := http.NewRequest("POST", StreamImportPath+test.query, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("POST %s %q: %v\nRecieve body: %q", StreamImportPath+test.query, test.body, err, rec.Body)
+		}
+	}
+}
+
+func TestStreamImportBatchReq(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.json")
+	m, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	tasks = Wrap(m, Validate(DefaultRules))
+	defer func() { tasks = NewManager() }()
+	revisions = newHistory()
+
+	body := "title\n"
+	for i := 0; i < 2*streamBatch+50; i++ {
+		if i == streamBatch+20 {
+			body += "\n\"\"\n"
+			continue
+		}
+		body += fmt.Sprintf("Task %d\n", i)
+	}
+	req, err := http.NewRequest("POST", StreamImportPath, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/csv")
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	var res streamResult
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("POST %s: cannot decode the response: %v", StreamImportPath, err)
+	}
+	want := streamResult{false, []rowError{{streamBatch + 23, "create: invalid task: title: is required"}}, 2*streamBatch + 50, 2*streamBatch + 49}
+	if !reflect.DeepEqual(res, want) {
+		t.Errorf("POST %s: got %+v; want %+v", StreamImportPath, res, want)
+	}
+
+	r, err := NewFileManager(path)
+	if err != nil {
+		t.Fatalf("NewFileManager(%q): unexpected error: %v", path, err)
+	}
+	if got, want := ptrToVal(r.All()), ptrToVal(tasks.All()); len(got) != 2*streamBatch+49 || !reflect.DeepEqual(got, want) {
+		t.Errorf("saved tasks = %d tasks; want %d tasks %v", len(got), len(want), want)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// taskwarriorLayout is the layout of the dates in the Taskwarrior export.
+const taskwarriorLayout = "20060102T150405Z"
+
+// taskwarriorPriorities maps the Taskwarrior priorities to the priorities.
+var taskwarriorPriorities = map[string]byte{"H": PriorityHigh, "M": PriorityMedium, "L": PriorityLow}
+
+// taskwarriorTask is a task of the Taskwarrior export.
+type taskwarriorTask struct {
+	Description string   `json:"description"`
+	Status      string   `json:"status"`
+	Entry       string   `json:"entry"`
+	Due         string   `json:"due"`
+	End         string   `json:"end"`
+	Priority    string   `json:"priority"`
+	Project     string   `json:"project"`
+	Tags        []string `json:"tags"`
+	Annotations []struct {
+		Description string `json:"description"`
+	} `json:"annotations"`
+
+	// The attributes which aren't imported.
+	Scheduled string          `json:"scheduled"`
+	Wait      string          `json:"wait"`
+	Until     string          `json:"until"`
+	Recur     string          `json:"recur"`
+	Depends   json.RawMessage `json:"depends"` // A string or an array, depending on the version.
+}
+
+// readTaskwarrior reads the tasks from the Taskwarrior export, which is an
+// array of tasks or, in the old versions, the tasks separated by commas. The
+// deleted tasks and the templates of the recurring tasks are skipped.
+func readTaskwarrior(data []byte) ([]parsedTask, error) {
+	var parsed []parsedTask
+	dec := json.NewDecoder(bytes.NewReader(data))
+	elem := func(line int) error {
+		var tw taskwarriorTask
+		err := dec.Decode(&tw)
+		if err != nil && !isTypeError(err) {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+		p := parsedTask{line: line, err: err}
+		if err == nil {
+			p = tw.parsedTask(line)
+		}
+		parsed = append(parsed, p)
+		return nil
+	}
+	var err error
+	if b := bytes.TrimSpace(data); len(b) > 0 && b[0] == '[' {
+		err = decodeJSONArray(dec, data, elem)
+	} else {
+		for off := 0; err == nil; {
+			rest := bytes.TrimLeft(data[off:], " \t\r\n,")
+			if len(rest) == 0 {
+				break
+			}
+			off = len(data) - len(rest)
+			dec = json.NewDecoder(bytes.NewReader(rest))
+			err = elem(jsonLine(data, int64(off)))
+			off += int(dec.InputOffset())
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// parsedTask returns the task with the attributes of the Taskwarrior task
+// starting at the line. The project is taken as a tag and the annotations
+// as the lines of the note.
+func (tw *taskwarriorTask) parsedTask(line int) parsedTask {
+	p := parsedTask{line: line}
+	switch tw.Status {
+	case "deleted":
+		p.skip = "deleted"
+		return p
+	case "recurring":
+		p.skip = "recurring template"
+		return p
+	}
+
+	t := &Task{Title: tw.Description, Done: tw.Status == "completed", Priority: taskwarriorPriorities[tw.Priority]}
+	if tw.Project != "" {
+		t.Tags = append(t.Tags, tw.Project)
+	}
+	for _, tag := range tw.Tags {
+		t.Tags = appendNew(t.Tags, tag)
+	}
+	var note []string
+	for _, a := range tw.Annotations {
+		note = append(note, a.Description)
+	}
+	t.Note = strings.Join(note, "\n")
+	for _, d := range []struct {
+		field, v string
+		sec      *int64
+	}{
+		{"due", tw.Due, &t.Date},
+		{"entry", tw.Entry, &t.Created},
+		{"end", tw.End, &t.Completed},
+	} {
+		if d.v == "" {
+			continue
+		}
+		v, err := time.Parse(taskwarriorLayout, d.v)
+		if err != nil {
+			p.err = fmt.Errorf("%s: %q isn't in the %s format", d.field, d.v, taskwarriorLayout)
+			return p
+		}
+		*d.sec = v.Unix()
+	}
+	p.task = t
+
+	for _, a := range []struct {
+		name string
+		set  bool
+	}{
+		{"scheduled", tw.Scheduled != ""},
+		{"wait", tw.Wait != ""},
+		{"until", tw.Until != ""},
+		{"recur", tw.Recur != ""},
+		{"depends", len(tw.Depends) > 0 && string(tw.Depends) != "null"},
+	} {
+		if a.set {
+			p.warnings = append(p.warnings, a.name+" isn't imported")
+		}
+	}
+	return p
+}
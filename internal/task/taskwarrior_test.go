@@ -0,0 +1,63 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadTaskwarrior(t *testing.T) {
+	export := `[
+{"id":1,"description":"Pay rent","status":"pending","entry":"20150310T080000Z","due":"20150320T000000Z",
+ "priority":"H","project":"home","tags":["finance","home"],"uuid":"a1"},
+{"id":0,"description":"Review plan","status":"completed","entry":"20150310T080000Z","end":"20150318T103000Z",
+ "annotations":[{"entry":"20150311T080000Z","description":"Ask Bob"},{"entry":"20150312T080000Z","description":"Done by Friday"}]},
+{"id":0,"description":"Old task","status":"deleted","end":"20150318T103000Z"},
+{"id":2,"description":"Water plants","status":"waiting","wait":"20150321T000000Z","recur":"weekly","depends":"b2,c3"},
+{"id":0,"description":"Water plants","status":"recurring","recur":"weekly"},
+{"id":3,"description":7},
+{"id":4,"description":"Call mom","due":"2015-03-20"}
+]`
+	want := []parsedTask{
+		{line: 2, task: &Task{Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00Z"), Priority: PriorityHigh,
+			Tags: []string{"home", "finance"}, Created: unix(t, "2015-03-10T08:00:00Z")}},
+		{line: 4, task: &Task{Title: "Review plan", Note: "Ask Bob\nDone by Friday", Done: true,
+			Created: unix(t, "2015-03-10T08:00:00Z"), Completed: unix(t, "2015-03-18T10:30:00Z")}},
+		{line: 6, skip: "deleted"},
+		{line: 7, task: &Task{Title: "Water plants"}, warnings: []string{"wait isn't imported", "recur isn't imported", "depends isn't imported"}},
+		{line: 8, skip: "recurring template"},
+		{line: 9},
+		{line: 10},
+	}
+	for _, data := range []string{export, "\n" + export[2:len(export)-2] + "\n"} { // The array and the task per line.
+		got, err := readTaskwarrior([]byte(data))
+		if err != nil {
+			t.Fatalf("readTaskwarrior(%q): %v", data, err)
+		}
+		if len(got) != len(want) {
+			t.Fatalf("readTaskwarrior(%q) got %d tasks; want %d", data, len(got), len(want))
+		}
+		for i, p := range got {
+			if (p.err == nil) != (i < 5) {
+				t.Errorf("readTaskwarrior(%q) task %d: got error %v; want error: %t", data, i, p.err, i >= 5)
+			}
+			p.err = nil
+			if !reflect.DeepEqual(p, want[i]) {
+				t.Errorf("readTaskwarrior(%q) task %d = %+v; want %+v", data, i, p, want[i])
+			}
+		}
+	}
+
+	for _, data := range []string{
+		`[{"description":"Pay rent"},]`,
+		`{"description":"Pay rent"} Pay rent`,
+		`["Pay rent"`,
+	} {
+		if got, err := readTaskwarrior([]byte(data)); err == nil {
+			t.Errorf("readTaskwarrior(%q) = %v, <nil>; want error", data, got)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// todoTxtPriorities maps the priorities to the todo.txt priority letters.
+var todoTxtPriorities = map[byte]string{PriorityHigh: "A", PriorityMedium: "B", PriorityLow: "C"}
+
+// FormatTodoTxt returns the task as a line in the todo.txt format. The tags
+// are written as +projects and the contexts as @contexts. The date is written
+// as the due extension, as a day if the task is all-day and in the RFC 3339
+// format otherwise, and its time zone as the tz extension. The priority of
+// a done task is written as the pri extension. The creation and completion
+// days are written in UTC, the creation day of a done task only together
+// with its completion day. The note is written escaped as the note
+// extension. The words of the title separated by single spaces which would
+// be parsed as other fields, or which are empty or contain whitespace, are
+// escaped: they're prefixed by a backslash and their percent signs and
+// whitespace are percent-encoded.
+func FormatTodoTxt(t *Task) string {
+	day := func(sec int64) string { return time.Unix(sec, 0).UTC().Format(dateLayout) }
+	var s []string
+	if t.Done {
+		s = append(s, "x")
+		if t.Completed != 0 { // The creation date is allowed only after the completion date.
+			s = append(s, day(t.Completed))
+			if t.Created != 0 {
+				s = append(s, day(t.Created))
+			}
+		}
+	} else {
+		if p := todoTxtPriorities[t.Priority]; p != "" {
+			s = append(s, "("+p+")")
+		}
+		if t.Created != 0 {
+			s = append(s, day(t.Created))
+		}
+	}
+	if t.Title != "" {
+		for i, w := range strings.Split(t.Title, " ") {
+			if w == "" || w[0] == '\\' || strings.IndexFunc(w, unicode.IsSpace) >= 0 || isTodoTxtField(w) ||
+				i == 0 && (w == "x" || isTodoTxtPriority(w) || isDay(w)) {
+				w = `\` + escapeTodoTxt(w)
+			}
+			s = append(s, w)
+		}
+	}
+	for _, tag := range t.Tags {
+		s = append(s, "+"+tag)
+	}
+	for _, c := range t.Contexts {
+		s = append(s, "@"+c)
+	}
+	if t.Done && todoTxtPriorities[t.Priority] != "" {
+		s = append(s, "pri:"+todoTxtPriorities[t.Priority])
+	}
+	switch {
+	case t.Date == 0:
+	case t.AllDay:
+		s = append(s, "due:"+t.Time().Format(dateLayout))
+	default:
+		s = append(s, "due:"+t.Time().Format(time.RFC3339))
+	}
+	if t.TimeZone != "" {
+		s = append(s, "tz:"+t.TimeZone)
+	}
+	if t.Note != "" {
+		s = append(s, "note:"+escapeTodoTxt(t.Note))
+	}
+	return strings.Join(s, " ")
+}
+
+// isTodoTxtField reports whether the word of a todo.txt line
+// after its priority and dates is parsed as a field of the task.
+func isTodoTxtField(w string) bool {
+	k, v, ext := strings.Cut(w, ":")
+	switch {
+	case len(w) > 1 && (w[0] == '+' || w[0] == '@'):
+		return true
+	case ext && (k == "due" || k == "tz" || k == "note"):
+		return v != ""
+	case ext && k == "pri":
+		return len(v) == 1 && 'A' <= v[0] && v[0] <= 'Z'
+	}
+	return false
+}
+
+// isTodoTxtPriority reports whether w is a todo.txt priority like (A).
+func isTodoTxtPriority(w string) bool {
+	return len(w) == 3 && w[0] == '(' && w[2] == ')' && 'A' <= w[1] && w[1] <= 'Z'
+}
+
+// isDay reports whether w is a day in the dateLayout.
+func isDay(w string) bool {
+	_, err := time.Parse(dateLayout, w)
+	return err == nil
+}
+
+// escapeTodoTxt returns s with its percent signs and whitespace
+// percent-encoded, so it's a single word of a todo.txt line.
+func escapeTodoTxt(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if r != '%' && !unicode.IsSpace(r) {
+			b.WriteRune(r)
+			continue
+		}
+		for _, c := range []byte(string(r)) {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// unescapeTodoTxt returns s escaped by escapeTodoTxt, or s as it
+// is if it isn't escaped properly.
+func unescapeTodoTxt(s string) string {
+	u, err := url.PathUnescape(s)
+	if err != nil {
+		return s
+	}
+	return u
+}
+
+// ParseTodoTxt parses the line in the todo.txt format into a task.
+// It is the reverse of FormatTodoTxt. The priority letters after
+// C are taken as the low priority and the unknown extensions
+// are kept in the title. The words prefixed by a backslash are
+// unescaped and kept in the title.
+func ParseTodoTxt(line string) (*Task, error) {
+	t := new(Task)
+	words := strings.Fields(line)
+	day := func(i int) (int64, bool) {
+		if i >= len(words) {
+			return 0, false
+		}
+		d, err := time.Parse(dateLayout, words[i])
+		return d.Unix(), err == nil
+	}
+
+	i := 0
+	if i < len(words) && words[i] == "x" {
+		t.Done = true
+		i++
+		if d, ok := day(i); ok {
+			t.Completed = d
+			i++
+			if d, ok := day(i); ok {
+				t.Created = d
+				i++
+			}
+		}
+	} else {
+		if i < len(words) && isTodoTxtPriority(words[i]) {
+			t.Priority = todoTxtPriority(words[i][1:2])
+			i++
+		}
+		if d, ok := day(i); ok {
+			t.Created = d
+			i++
+		}
+	}
+
+	var title []string
+	var due string
+	for _, w := range words[i:] {
+		k, v, ext := strings.Cut(w, ":")
+		switch {
+		case w[0] == '\\':
+			title = append(title, unescapeTodoTxt(w[1:]))
+		case len(w) > 1 && w[0] == '+':
+			t.Tags = appendNew(t.Tags, w[1:])
+		case len(w) > 1 && w[0] == '@':
+			t.Contexts = appendNew(t.Contexts, w[1:])
+		case ext && k == "due" && v != "":
+			due = v
+		case ext && k == "tz" && v != "":
+			t.TimeZone = v
+		case ext && k == "note" && v != "":
+			t.Note = unescapeTodoTxt(v)
+		case ext && k == "pri" && len(v) == 1 && 'A' <= v[0] && v[0] <= 'Z':
+			t.Priority = todoTxtPriority(v)
+		default:
+			title = append(title, w)
+		}
+	}
+	t.Title = strings.Join(title, " ")
+	if due == "" {
+		return t, nil
+	}
+	if d, err := time.ParseInLocation(dateLayout, due, t.Location()); err == nil {
+		t.Date, t.AllDay = d.Unix(), true
+		return t, nil
+	}
+	d, err := time.Parse(time.RFC3339, due)
+	if err != nil {
+		return nil, fmt.Errorf("due: %q isn't a day or in the RFC 3339 format", due)
+	}
+	t.Date = d.Unix()
+	return t, nil
+}
+
+// todoTxtPriority returns the priority of the todo.txt priority letter.
+func todoTxtPriority(letter string) byte {
+	for p, l := range todoTxtPriorities {
+		if l == letter {
+			return p
+		}
+	}
+	return PriorityLow
+}
+
+// writeTodoTxt writes the tasks to the response in the todo.txt format.
+func writeTodoTxt(w http.ResponseWriter, tasks []*Task) error {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	bw := bufio.NewWriter(w)
+	for _, t := range tasks {
+		if _, err := fmt.Fprintln(bw, FormatTodoTxt(t)); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// readTodoTxt reads the tasks from the todo.txt lines.
+// The blank lines are skipped.
+func readTodoTxt(r io.Reader) ([]parsedTask, error) {
+	var parsed []parsedTask
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20) // Escaped notes of the maximum size are longer than the default limit.
+	for n := 1; s.Scan(); n++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		t, err := ParseTodoTxt(s.Text())
+		parsed = append(parsed, parsedTask{line: n, task: t, err: err})
+	}
+	return parsed, s.Err()
+}
@@ -0,0 +1,220 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTodoTxt(t *testing.T) {
+	for _, test := range []struct {
+		task Task
+		line string
+	}{
+		{Task{Title: "Buy milk"}, "Buy milk"},
+		{Task{Title: "Call mom", Priority: PriorityHigh}, "(A) Call mom"},
+		{Task{Title: "Call mom", Priority: PriorityLow, Created: unix(t, "2015-03-10T00:00:00Z")}, "(C) 2015-03-10 Call mom"},
+		{Task{Title: "Review plan", Done: true, Priority: PriorityMedium, Created: unix(t, "2015-03-10T00:00:00Z"), Completed: unix(t, "2015-03-18T00:00:00Z")},
+			"x 2015-03-18 2015-03-10 Review plan pri:B"},
+		{Task{Title: "Review plan", Done: true}, "x Review plan"},
+		{Task{Title: "Pay rent", Tags: []string{"finance", "home-office"}, Contexts: []string{"home"}}, "Pay rent +finance +home-office @home"},
+		{Task{Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00Z"), AllDay: true}, "Pay rent due:2015-03-20"},
+		{Task{Title: "Pay rent", Date: unix(t, "2015-03-20T09:00:00Z")}, "Pay rent due:2015-03-20T09:00:00Z"},
+		{Task{Title: "Pay rent", Date: unix(t, "2015-03-20T00:00:00+01:00"), AllDay: true, TimeZone: "Europe/Bratislava"},
+			"Pay rent due:2015-03-20 tz:Europe/Bratislava"},
+		{Task{Title: "Pay rent", Date: unix(t, "2015-03-20T09:00:00+01:00"), TimeZone: "Europe/Bratislava"},
+			"Pay rent due:2015-03-20T09:00:00+01:00 tz:Europe/Bratislava"},
+		{Task{Title: "Read http://example.com url:yes"}, "Read http://example.com url:yes"},
+	} {
+		if got := FormatTodoTxt(&test.task); got != test.line {
+			t.Errorf("FormatTodoTxt(%v) = %q; want %q", test.task, got, test.line)
+		}
+		got, err := ParseTodoTxt(test.line)
+		if err != nil || !reflect.DeepEqual(*got, test.task) {
+			t.Errorf("ParseTodoTxt(%q) = %v, %v; want %v, <nil>", test.line, got, err, test.task)
+		}
+	}
+}
+
+func TestTodoTxtEscape(t *testing.T) {
+	for _, test := range []struct {
+		task Task
+		line string
+	}{
+		{Task{Title: "x marks the spot"}, `\x marks the spot`},
+		{Task{Title: "(A) is the grade"}, `\(A) is the grade`},
+		{Task{Title: "2015-03-10 was a Tuesday"}, `\2015-03-10 was a Tuesday`},
+		{Task{Title: "2015-03-10 was a Tuesday", Created: unix(t, "2015-03-09T00:00:00Z")}, `2015-03-09 \2015-03-10 was a Tuesday`},
+		{Task{Title: "2015-03-10 was a Tuesday", Done: true}, `x \2015-03-10 was a Tuesday`},
+		{Task{Title: "Learn C++ and +1 it"}, `Learn C++ and \+1 it`},
+		{Task{Title: "Ask @bob about due:friday tz:CET pri:A note:x"}, `Ask \@bob about \due:friday \tz:CET \pri:A \note:x`},
+		{Task{Title: `Escape \ and 100%`}, `Escape \\ and 100%`},
+		{Task{Title: "Pay  rent\tnow\n"}, "Pay \\ \\rent%09now%0A"},
+		{Task{Title: "Call mom", Note: "Ask about 50% of\n- [ ] the plan"}, "Call mom note:Ask%20about%2050%25%20of%0A-%20[%20]%20the%20plan"},
+	} {
+		if got := FormatTodoTxt(&test.task); got != test.line {
+			t.Errorf("FormatTodoTxt(%v) = %q; want %q", test.task, got, test.line)
+		}
+		got, err := ParseTodoTxt(test.line)
+		if err != nil || !reflect.DeepEqual(*got, test.task) {
+			t.Errorf("ParseTodoTxt(%q) = %v, %v; want %v, <nil>", test.line, got, err, test.task)
+		}
+	}
+}
+
+func TestTodoTxtRoundTrip(t *testing.T) {
+	for _, title := range []string{
+		"x", "x x", "(B)", "(B) (C)", "2015-03-10", " leading", "trailing ", "a   b", "\t", "\\", "\\x", "%41",
+		"+", "@", "+tag @ctx", "due:", "due:2015-03-20", "pri:a", "pri:AB", "note:%20", "Read http://example.com url:yes",
+	} {
+		for _, task := range []Task{
+			{Title: title},
+			{Title: title, Priority: PriorityHigh, Created: unix(t, "2015-03-10T00:00:00Z")},
+			{Title: title, Done: true, Priority: PriorityLow, Note: title},
+			{Title: title, Done: true, Completed: unix(t, "2015-03-18T00:00:00Z"), Tags: []string{"a"}, Contexts: []string{"b"}},
+		} {
+			line := FormatTodoTxt(&task)
+			got, err := ParseTodoTxt(line)
+			if err != nil || !reflect.DeepEqual(*got, task) {
+				t.Errorf("ParseTodoTxt(FormatTodoTxt(%q)) = %v, %v; want %v, <nil>", line, got, err, task)
+			}
+		}
+	}
+}
+
+func TestTodoTxtRoundTripMaxNote(t *testing.T) {
+	task := Task{Title: strings.Repeat("%", 200), Note: strings.Repeat(" \n", 32<<10)}
+	if errs := DefaultRules.Check(&task); len(errs) != 0 {
+		t.Fatalf("task with the maximum note is invalid: %v", errs)
+	}
+	line := FormatTodoTxt(&task)
+	parsed, err := readTodoTxt(strings.NewReader(line + "\n"))
+	if err != nil || len(parsed) != 1 || parsed[0].err != nil || !reflect.DeepEqual(*parsed[0].task, task) {
+		t.Errorf("readTodoTxt(FormatTodoTxt(...)) of %d bytes failed: %v", len(line), err)
+	}
+}
+
+func TestParseTodoTxt(t *testing.T) {
+	for _, test := range []struct {
+		line string
+		task Task
+		ok   bool
+	}{
+		{"  (B)   Call   mom  ", Task{Title: "Call mom", Priority: PriorityMedium}, true},
+		{"(Z) Call mom", Task{Title: "Call mom", Priority: PriorityLow}, true},
+		{"(a) Call mom", Task{Title: "(a) Call mom"}, true},
+		{"Call mom (A)", Task{Title: "Call mom (A)"}, true},
+		{"x 2015-03-18 Call mom", Task{Title: "Call mom", Done: true, Completed: unix(t, "2015-03-18T00:00:00Z")}, true},
+		{"X Call mom", Task{Title: "X Call mom"}, true},
+		{"xylophone lessons", Task{Title: "xylophone lessons"}, true},
+		{"2015-03-10 Call mom +family +family @phone", Task{Title: "Call mom", Created: unix(t, "2015-03-10T00:00:00Z"), Tags: []string{"family"}, Contexts: []string{"phone"}}, true},
+		{"Call mom + @ due: tz:", Task{Title: "Call mom + @ due: tz:"}, true},
+		{"Email bob@example.com", Task{Title: "Email bob@example.com"}, true},
+		{"Call mom due:2015-03-20 tz:America/New_York", Task{Title: "Call mom", Date: unix(t, "2015-03-20T00:00:00-04:00"), AllDay: true, TimeZone: "America/New_York"}, true},
+		{"Call mom due:tomorrow", Task{}, false},
+		{"", Task{}, true},
+	} {
+		got, err := ParseTodoTxt(test.line)
+		if (err == nil) != test.ok {
+			t.Errorf("ParseTodoTxt(%q): got error %v; want error: %t", test.line, err, !test.ok)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(*got, test.task) {
+			t.Errorf("ParseTodoTxt(%q) = %v; want %v", test.line, *got, test.task)
+		}
+	}
+}
+
+func TestTodoTxtReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	body := "(A) Pay rent +finance @home due:2015-03-20\n\nx 2015-03-18 2015-03-10 Review plan\n"
+	req, err := http.NewRequest("POST", ImportPath, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	rec := httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST %s: %v\nRecieve body: %q", ImportPath, err, rec.Body)
+	}
+	var res struct {
+		Applied bool           `json:"applied"`
+		Results []importResult `json:"results"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatalf("POST %s: cannot decode the response: %v", ImportPath, err)
+	}
+	if want := []importResult{{Line: 1, ID: 0}, {Line: 3, ID: 1}}; !res.Applied || !reflect.DeepEqual(res.Results, want) {
+		t.Errorf("POST %s: got %v, %v; want true, %v", ImportPath, res.Applied, res.Results, want)
+	}
+	if n := len(revisions.task(1)); n != 1 {
+		t.Errorf("POST %s: got %d revisions of imported task; want 1", ImportPath, n)
+	}
+
+	req, err = http.NewRequest("GET", Path+"?format=todotxt&filter=isNotDone", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec = httptest.NewRecorder()
+	RestAPI(rec, req)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("GET %s?format=todotxt: %v\nRecieve body: %q", Path, err, rec.Body)
+	}
+	if got, want := rec.Header().Get("Content-Type"), "text/plain; charset=utf-8"; got != want {
+		t.Errorf("GET %s?format=todotxt: got content type %q; want %q", Path, got, want)
+	}
+	if got, want := rec.Body.String(), "(A) Pay rent +finance @home due:2015-03-20\n"; got != want {
+		t.Errorf("GET %s?format=todotxt: got body %q; want %q", Path, got, want)
+	}
+
+	for _, test := range []struct {
+		body, contentType string
+		code              int
+		results           []importResult
+	}{
+		{"Call mom due:tomorrow\nBuy milk", "text/plain", http.StatusBadRequest,
+			[]importResult{{Line: 1, Error: `due: "tomorrow" isn't a day or in the RFC 3339 format`}, {Line: 2}}},
+		{"Buy milk\n(A) +empty", "text/plain", http.StatusBadRequest,
+			[]importResult{{Line: 1, ID: 2}, {Line: 2, Error: ErrCreateEmptyTitle.Error()}}},
+		{"\n\n", "text/plain", http.StatusBadRequest, nil},
+		{"Buy milk", "application/xml", http.StatusUnsupportedMediaType, nil},
+	} {
+		req, err := http.NewRequest("POST", ImportPath, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("POST %s %q: %v\nRecieve body: %q", ImportPath, test.body, err, rec.Body)
+			continue
+		}
+		if test.results == nil {
+			continue
+		}
+		var res struct {
+			Applied bool           `json:"applied"`
+			Results []importResult `json:"results"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Fatalf("POST %s: cannot decode the response: %v", ImportPath, err)
+		}
+		if res.Applied || !reflect.DeepEqual(res.Results, test.results) {
+			t.Errorf("POST %s %q: got %v, %v; want false, %v", ImportPath, test.body, res.Applied, res.Results, test.results)
+		}
+	}
+	if n := tasks.Count(); n != 2 {
+		t.Errorf("failed imports changed the tasks: got %d tasks; want 2", n)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TrashPath specifies the trash resource path.
+const TrashPath = "/trash/"
+
+// restoreSuffix is the path suffix of the restore action.
+const restoreSuffix = "/restore"
+
+// TrashAPI is a handler function that handles http requests to the trash resources.
+func TrashAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	switch {
+	case r.Method == "GET" && r.URL.Path == TrashPath:
+		w.Header().Set("Content-Type", "application/json")
+		err = readTrash(w, r)
+	case r.Method == "POST" && strings.HasSuffix(r.URL.Path, restoreSuffix):
+		err = restore(w, r)
+	case r.Method == "DELETE" && len(r.URL.Path) > len(TrashPath):
+		err = purge(w, r)
+	default:
+		err = badRequestError(fmt.Errorf("%s %s doesn't implemented", r.Method, r.URL.Path))
+	}
+	errorHandler(w, r, err)
+}
+
+// readTrash handles requests for the reads of all deleted tasks.
+func readTrash(w http.ResponseWriter, r *http.Request) error {
+	trash, err := storage().TrashContext(r.Context())
+	if err != nil {
+		return err
+	}
+	res := struct {
+		Tasks []*Task `json:"tasks"`
+	}{
+		visible(r, RoleOwner).Tasks(trash),
+	}
+	return json.NewEncoder(w).Encode(res)
+}
+
+// restore handles requests for the restoration of a specific deleted task.
+// The restored task is written to the response.
+func restore(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseTrashID(r, restoreSuffix)
+	if err != nil {
+		return badRequestError(err)
+	}
+	var c change
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = findDeleted(ctx, m, id); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("deleted task id: %d doesn't exists", id))
+		}
+		if err != nil {
+			return err
+		}
+		if err := authorize(r, c.before, RoleOwner); err != nil {
+			return err
+		}
+		c.after, err = m.RestoreContext(ctx, id)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	commit(r, c)
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(c.after)
+}
+
+// purge handles requests for the permanent removal of a specific deleted task.
+func purge(w http.ResponseWriter, r *http.Request) error {
+	id, err := parseTrashID(r, "")
+	if err != nil {
+		return badRequestError(err)
+	}
+	var c change
+	err = storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) (err error) {
+		if c.before, err = findDeleted(ctx, m, id); err == ErrFindUnknown {
+			return notFoundError(fmt.Errorf("deleted task id: %d doesn't exists", id))
+		}
+		if err != nil {
+			return err
+		}
+		if err := authorize(r, c.before, RoleOwner); err != nil {
+			return err
+		}
+		return m.PurgeContext(ctx, id)
+	})
+	if err != nil {
+		return err
+	}
+	commit(r, c)
+	return nil
+}
+
+// purgeBefore permanently removes the tasks deleted before t
+// and records their removal in the history.
+func purgeBefore(ctx context.Context, t time.Time) error {
+	var changes []change
+	err := storage().TxContext(ctx, func(ctx context.Context, m ContextManager) error {
+		changes = changes[:0]
+		trash, err := m.TrashContext(ctx)
+		if err != nil {
+			return err
+		}
+		for _, d := range trash {
+			if d.Deleted >= t.Unix() {
+				continue
+			}
+			if err := m.PurgeContext(ctx, d.ID); err != nil {
+				return err
+			}
+			changes = append(changes, change{d, nil})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	revisions.record(system, changes...)
+	return nil
+}
+
+// findDeleted returns deleted task with given id from the trash of m.
+// ErrFindUnknown is returned if such a task isn't in the trash.
+func findDeleted(ctx context.Context, m ContextManager, id int) (*Task, error) {
+	trash, err := m.TrashContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range trash {
+		if t.ID == id {
+			return t, nil
+		}
+	}
+	return nil, ErrFindUnknown
+}
+
+// parseTrashID extracts a deleted task id followed by suffix from the request.
+func parseTrashID(r *http.Request, suffix string) (int, error) {
+	return strconv.Atoi(strings.TrimSuffix(r.URL.Path[len(TrashPath):], suffix))
+}
+
+// PurgeTrash checks the trash every interval and permanently removes
+// the tasks deleted more than age ago. It returns when stop is closed.
+func PurgeTrash(age, interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if err := purgeBefore(context.Background(), now().Add(-age)); err != nil {
+				slog.Error("cannot purge trash", "err", err)
+			}
+		case <-stop:
+			return
+		}
+	}
+}
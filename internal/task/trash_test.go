@@ -0,0 +1,135 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serve sends a request without a body to handler h.
+func serve(t *testing.T, h http.HandlerFunc, method, path string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+func TestTrashReq(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	now = func() time.Time { return time.Unix(1426691590, 0) }
+
+	tasks = NewManager()
+	if err := addTasks(tasks, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+	del := testTasks[1]
+
+	// Delete moves the task to the trash.
+	if rec := serve(t, RestAPI, "DELETE", Path+strconv.Itoa(del.ID)); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+	if rec := serve(t, RestAPI, "GET", Path+strconv.Itoa(del.ID)); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted: got status code %d; want %d", rec.Code, http.StatusNotFound)
+	}
+	rec := serve(t, RestAPI, "GET", Path)
+	res := struct {
+		Tasks []Task `json:"tasks"`
+	}{}
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	if want := []Task{testTasks[0], testTasks[2]}; !reflect.DeepEqual(res.Tasks, want) {
+		t.Errorf("GET %s\n got %v\nwant %v", Path, res.Tasks, want)
+	}
+
+	// The trash lists the deleted task.
+	rec = serve(t, TrashAPI, "GET", TrashPath)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("GET %s: %v", TrashPath, err)
+	}
+	res.Tasks = nil
+	if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+		t.Fatal(err)
+	}
+	want := del
+	want.Deleted = now().Unix()
+	if !reflect.DeepEqual(res.Tasks, []Task{want}) {
+		t.Errorf("GET %s\n got %v\nwant %v", TrashPath, res.Tasks, []Task{want})
+	}
+
+	// Restore moves the task back.
+	rec = serve(t, TrashAPI, "POST", TrashPath+strconv.Itoa(del.ID)+restoreSuffix)
+	if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+		t.Fatalf("POST restore: %v", err)
+	}
+	if got, ok := tasks.Find(del.ID); !ok || !reflect.DeepEqual(*got, del) {
+		t.Errorf("Find(%d) after restore = %v, %t; want %v, true", del.ID, got, ok, del)
+	}
+
+	// Purge removes the task permanently.
+	serve(t, RestAPI, "DELETE", Path+strconv.Itoa(del.ID))
+	if rec := serve(t, TrashAPI, "DELETE", TrashPath+strconv.Itoa(del.ID)); rec.Code != http.StatusOK {
+		t.Errorf("DELETE purge: got status code %d; want %d", rec.Code, http.StatusOK)
+	}
+	if got := tasks.Trash(); len(got) != 0 {
+		t.Errorf("Trash() after purge = %v; want []", ptrToVal(got))
+	}
+}
+
+func TestTrashReqError(t *testing.T) {
+	tasks = NewManager()
+	for _, test := range []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"POST", TrashPath + "0" + restoreSuffix, http.StatusNotFound},
+		{"POST", TrashPath + "wrongID" + restoreSuffix, http.StatusBadRequest},
+		{"DELETE", TrashPath + "0", http.StatusNotFound},
+		{"DELETE", TrashPath + "wrongID", http.StatusBadRequest},
+		{"PUT", TrashPath + "0", http.StatusBadRequest},
+	} {
+		rec := serve(t, TrashAPI, test.method, test.path)
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %s %s: %v", test.method, test.path, err)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+	}
+}
+
+func TestPurgeBeforeHistory(t *testing.T) {
+	defer func(f func() time.Time) { now = f }(now)
+	tasks = NewManager()
+	revisions = newHistory()
+	for i, d := range []int64{1426691590, 1426691600} {
+		now = func() time.Time { return time.Unix(d, 0) }
+		send(t, "POST", Path, "", `{"title":"Task"}`)
+		send(t, "DELETE", Path+strconv.Itoa(i), "", "")
+	}
+
+	if err := purgeBefore(context.Background(), time.Unix(1426691600, 0)); err != nil {
+		t.Fatalf("purgeBefore(...): unexpected error: %v", err)
+	}
+	if trash := tasks.Trash(); len(trash) != 1 || trash[0].ID != 1 {
+		t.Errorf("purgeBefore(...) left trash %v; want task 1", trash)
+	}
+	revs := revisions.task(0)
+	if got := revs[len(revs)-1]; got.Op != "purge" || got.Actor != system {
+		t.Errorf("purgeBefore(...) recorded revision %+v; want purge by %s", got, system)
+	}
+	if n := len(revisions.task(1)); n != 2 {
+		t.Errorf("purgeBefore(...) recorded %d revisions of task 1; want 2", n)
+	}
+}
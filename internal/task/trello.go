@@ -0,0 +1,184 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// trelloCard is a card of the Trello board.
+type trelloCard struct {
+	ID           string   `json:"id"`
+	Name         string   `json:"name"`
+	Desc         string   `json:"desc"`
+	Closed       bool     `json:"closed"`
+	IDList       string   `json:"idList"`
+	Due          string   `json:"due"`
+	DueComplete  bool     `json:"dueComplete"`
+	Start        string   `json:"start"`
+	IDChecklists []string `json:"idChecklists"`
+	IDMembers    []string `json:"idMembers"`
+	Labels       []struct {
+		Name  string `json:"name"`
+		Color string `json:"color"`
+	} `json:"labels"`
+}
+
+// trelloList is a list of the Trello board.
+type trelloList struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Closed bool   `json:"closed"`
+}
+
+// trelloChecklist is a checklist of a card of the Trello board.
+type trelloChecklist struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	CheckItems []struct {
+		Name  string  `json:"name"`
+		State string  `json:"state"`
+		Pos   float64 `json:"pos"`
+	} `json:"checkItems"`
+}
+
+// readTrello reads the tasks from the cards of the Trello board. The archived
+// cards and the cards of the archived lists are skipped.
+func readTrello(data []byte) ([]parsedTask, error) {
+	var board struct {
+		cards      []trelloCard
+		lists      map[string]trelloList
+		checklists map[string]trelloChecklist
+	}
+	var parsed []parsedTask // The cards with the errors of their decoding.
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil {
+		return nil, err
+	} else if tok != json.Delim('{') {
+		return nil, fmt.Errorf("got %v; want a board object", tok)
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch key {
+		case "cards":
+			err = decodeJSONArray(dec, data, func(line int) error {
+				var c trelloCard
+				err := dec.Decode(&c)
+				if err != nil && !isTypeError(err) {
+					return fmt.Errorf("line %d: %v", line, err)
+				}
+				parsed, board.cards = append(parsed, parsedTask{line: line, err: err}), append(board.cards, c)
+				return nil
+			})
+		case "lists":
+			var lists []trelloList
+			err = dec.Decode(&lists)
+			board.lists = make(map[string]trelloList)
+			for _, l := range lists {
+				board.lists[l.ID] = l
+			}
+		case "checklists":
+			var checklists []trelloChecklist
+			err = dec.Decode(&checklists)
+			board.checklists = make(map[string]trelloChecklist)
+			for _, c := range checklists {
+				board.checklists[c.ID] = c
+			}
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, c := range board.cards {
+		p := &parsed[i]
+		list := board.lists[c.IDList]
+		switch {
+		case p.err != nil:
+		case c.Closed, list.Closed:
+			p.skip = "archived"
+		default:
+			p.task, p.err = c.task(list, board.checklists)
+		}
+		if c.Start != "" {
+			p.warnings = append(p.warnings, "start isn't imported")
+		}
+		if len(c.IDMembers) > 0 {
+			p.warnings = append(p.warnings, "members aren't imported")
+		}
+	}
+	return parsed, nil
+}
+
+// task returns the task of the card in the list. The card is done if its due
+// date is complete or it's in the list named Done. The labels named like the
+// priorities set the priority and the other labels are taken as the tags,
+// named by their colors if they don't have names. The checklists are
+// appended to the description in the note as Markdown checklists.
+func (c *trelloCard) task(list trelloList, checklists map[string]trelloChecklist) (*Task, error) {
+	t := &Task{Title: c.Name, Done: c.DueComplete || strings.EqualFold(list.Name, "Done")}
+	if c.Due != "" {
+		d, err := time.Parse(time.RFC3339, c.Due)
+		if err != nil {
+			return nil, fmt.Errorf("due: %q isn't in the RFC 3339 format", c.Due)
+		}
+		t.Date = d.Unix()
+	}
+	if len(c.ID) == 24 { // The IDs start with the creation time in hexadecimal.
+		if sec, err := strconv.ParseInt(c.ID[:8], 16, 64); err == nil {
+			t.Created = sec
+		}
+	}
+
+labels:
+	for _, l := range c.Labels {
+		for p, n := range priorityNames {
+			if p != PriorityNone && strings.EqualFold(l.Name, n) {
+				t.Priority = byte(p)
+				continue labels
+			}
+		}
+		name := strings.Join(strings.Fields(l.Name), "-")
+		if name == "" {
+			name = l.Color
+		}
+		if name != "" {
+			t.Tags = appendNew(t.Tags, name)
+		}
+	}
+
+	note := []string{c.Desc}
+	for _, id := range c.IDChecklists {
+		cl, ok := checklists[id]
+		if !ok {
+			continue
+		}
+		items := cl.CheckItems
+		sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+		s := []string{cl.Name}
+		for _, it := range items {
+			box := "[ ]"
+			if it.State == "complete" {
+				box = "[x]"
+			}
+			s = append(s, "- "+box+" "+it.Name)
+		}
+		note = append(note, strings.Join(s, "\n"))
+	}
+	t.Note = strings.TrimSpace(strings.Join(note, "\n\n"))
+	return t, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReadTrello(t *testing.T) {
+	board := `{
+"name":"Home",
+"cards":[
+ {"id":"54febd4c8b6b6e1b2c8d0001","name":"Pay rent","desc":"Bank transfer","idList":"l1",
+  "due":"2015-03-20T09:00:00.000Z","labels":[{"name":"High","color":"red"},{"name":"home office","color":"blue"},{"name":"","color":"green"}],
+  "idChecklists":["c1","c2"]},
+ {"id":"c2","name":"Review plan","idList":"l2","idMembers":["m1"],"start":"2015-03-10T08:00:00.000Z"},
+ {"id":"c3","name":"Old task","idList":"l1","closed":true},
+ {"id":"c4","name":"Old list task","idList":"l3"},
+ {"id":"c5","name":"Call mom","idList":"l1","dueComplete":true,"due":"tomorrow"},
+ {"id":"c6","name":["Call mom"]}
+],
+"lists":[{"id":"l1","name":"To Do"},{"id":"l2","name":"done"},{"id":"l3","name":"Later","closed":true}],
+"checklists":[
+ {"id":"c2","name":"Before","checkItems":[{"name":"Check balance","state":"incomplete","pos":2},{"name":"Find IBAN","state":"complete","pos":1}]},
+ {"id":"c1","name":"After","checkItems":[]}
+]
+}`
+	want := []parsedTask{
+		{line: 4, task: &Task{Title: "Pay rent", Note: "Bank transfer\n\nAfter\n\nBefore\n- [x] Find IBAN\n- [ ] Check balance",
+			Date: unix(t, "2015-03-20T09:00:00Z"), Priority: PriorityHigh, Tags: []string{"home-office", "green"}, Created: 1425980748}},
+		{line: 7, task: &Task{Title: "Review plan", Done: true}, warnings: []string{"start isn't imported", "members aren't imported"}},
+		{line: 8, skip: "archived"},
+		{line: 9, skip: "archived"},
+		{line: 10},
+		{line: 11},
+	}
+	got, err := readTrello([]byte(board))
+	if err != nil {
+		t.Fatalf("readTrello(%q): %v", board, err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("readTrello(%q) got %d tasks; want %d", board, len(got), len(want))
+	}
+	for i, p := range got {
+		if (p.err == nil) != (i < 4) {
+			t.Errorf("readTrello card %d: got error %v; want error: %t", i, p.err, i >= 4)
+		}
+		p.err = nil
+		if !reflect.DeepEqual(p, want[i]) {
+			t.Errorf("readTrello card %d = %+v; want %+v", i, p, want[i])
+		}
+	}
+
+	for _, data := range []string{
+		`[]`,
+		`{"cards":[{"name":"Pay rent"}`,
+		`{"cards":{}}`,
+		`{"lists":"l1","cards":[]}`,
+	} {
+		if got, err := readTrello([]byte(data)); err == nil {
+			t.Errorf("readTrello(%q) = %v, <nil>; want error", data, got)
+		}
+	}
+}
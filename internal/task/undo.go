@@ -0,0 +1,287 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+)
+
+// UndoPath specifies the path of the undo action.
+const UndoPath = "/undo"
+
+// RedoPath specifies the path of the redo action.
+const RedoPath = "/redo"
+
+// SessionHeader is the request header identifying the client session
+// whose operations can be undone.
+const SessionHeader = "X-Session-ID"
+
+// maxUndo limits the number of operations which can be undone in a session.
+const maxUndo = 100
+
+// sessionTTL specifies for how long an idle session is remembered.
+const sessionTTL = 24 * time.Hour
+
+// errConflict indicates that the changes can't be reverted
+// because the tasks were modified in the meantime.
+var errConflict = &errRequest{fmt.Errorf("tasks were modified by another operation"), http.StatusConflict}
+
+// journal stores the changes made in a session which can be undone and redone.
+type journal struct {
+	undo, redo [][]change
+	touched    time.Time
+}
+
+// push appends the changes to the stack s and drops
+// the oldest changes if the stack is full.
+func push(s [][]change, changes []change) [][]change {
+	if len(s) == maxUndo {
+		s = append(s[:0], s[1:]...)
+	}
+	return append(s, changes)
+}
+
+// top returns the most recent changes of the stack s.
+func top(s [][]change) []change {
+	if len(s) == 0 {
+		return nil
+	}
+	return s[len(s)-1]
+}
+
+// drop removes the changes from the stack s if they are still there.
+func drop(s [][]change, changes []change) [][]change {
+	for i := len(s) - 1; i >= 0; i-- {
+		if sameChanges(s[i], changes) {
+			return append(s[:i], s[i+1:]...)
+		}
+	}
+	return s
+}
+
+// sameChanges reports whether a and b are the same entry of a stack,
+// not only equal changes.
+func sameChanges(a, b []change) bool {
+	return len(a) == len(b) && cap(a) == cap(b) && (len(a) == 0 || &a[0] == &b[0])
+}
+
+// journals stores journals of sessions. It is safe for concurrent use.
+type journals struct {
+	mu       sync.Mutex
+	sessions map[string]*journal
+}
+
+// newJournals returns a new empty journal store.
+func newJournals() *journals {
+	return &journals{sessions: make(map[string]*journal)}
+}
+
+var sessions = newJournals()
+
+// session returns the journal of session id. It must be called with s.mu held.
+func (s *journals) session(id string) *journal {
+	t := now()
+	for k, j := range s.sessions {
+		if t.Sub(j.touched) > sessionTTL {
+			delete(s.sessions, k)
+		}
+	}
+	j, ok := s.sessions[id]
+	if !ok {
+		j = &journal{}
+		s.sessions[id] = j
+	}
+	j.touched = t
+	return j
+}
+
+// record stores the changes made in session id so they can be undone.
+// The changes which were undone in the session can't be redone anymore.
+func (s *journals) record(id string, changes []change) {
+	if len(changes) == 0 {
+		return
+	}
+	for _, c := range changes {
+		if c.after == nil { // Permanent removal can't be undone.
+			return
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.session(id)
+	j.undo, j.redo = push(j.undo, changes), nil
+}
+
+// revert reverts the most recent changes from the stack selected by
+// from and records the reverting changes on the stack selected by to.
+// The changes stay on the stack if they can't be reverted, so the
+// reversion can be retried.
+func (s *journals) revert(r *http.Request, id string, from, to func(j *journal) *[][]change) ([]change, error) {
+	j, changes := s.top(id, from)
+	if len(changes) == 0 {
+		return nil, notFoundError(fmt.Errorf("nothing to revert in session %q", id))
+	}
+
+	var reverted []change
+	err := storage().TxContext(r.Context(), func(ctx context.Context, m ContextManager) error {
+		reverted = reverted[:0]
+		for i := len(changes) - 1; i >= 0; i-- {
+			c, err := revertChange(ctx, m, r, changes[i])
+			if err != nil {
+				return err
+			}
+			reverted = append(reverted, c.snapshot())
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.move(j, from, to, changes, reverted)
+	return reverted, nil
+}
+
+// top returns the journal of session id and the most recent changes
+// of its stack selected by from.
+func (s *journals) top(id string, from func(j *journal) *[][]change) (*journal, []change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.session(id)
+	return j, top(*from(j))
+}
+
+// move drops the changes from the stack of j selected by from and
+// pushes the reverted changes on the stack selected by to.
+func (s *journals) move(j *journal, from, to func(j *journal) *[][]change, changes, reverted []change) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*from(j) = drop(*from(j), changes)
+	*to(j) = push(*to(j), reverted)
+}
+
+// state returns the current state of task with given id in m
+// or nil if the task doesn't exist.
+func state(ctx context.Context, m ContextManager, id int) (*Task, error) {
+	t, err := m.FindContext(ctx, id)
+	if err == ErrFindUnknown {
+		t, err = findDeleted(ctx, m, id)
+	}
+	if err == ErrFindUnknown {
+		return nil, nil
+	}
+	return t, err
+}
+
+// revertChange brings the task changed by c back to the state before c
+// on behalf of the request and returns the change made by the reversion.
+// A created task is moved to the trash. An error is returned if the task
+// isn't in the state after c or if the request isn't authorized to change it.
+func revertChange(ctx context.Context, m ContextManager, r *http.Request, c change) (change, error) {
+	cur, err := state(ctx, m, c.id())
+	if err != nil {
+		return change{}, err
+	}
+	if cur == nil || !reflect.DeepEqual(*cur, *c.after) {
+		return change{}, errConflict
+	}
+	rc := change{before: cur}
+	switch to := c.before; {
+	case to == nil || to.Deleted != 0:
+		if cur.Deleted == 0 {
+			if err = authorize(r, cur, RoleOwner); err == nil {
+				err = m.DeleteContext(ctx, cur.ID)
+			}
+		}
+	case cur.Deleted != 0:
+		if err = authorize(r, cur, RoleOwner); err != nil {
+			break
+		}
+		if _, err = m.RestoreContext(ctx, cur.ID); err == nil {
+			err = m.UpdateContext(ctx, to)
+		}
+	default:
+		if err = authorize(r, cur, RoleEditor); err == nil {
+			err = m.UpdateContext(ctx, to)
+		}
+	}
+	if err != nil {
+		return change{}, err
+	}
+	rc.after, err = state(ctx, m, c.id())
+	return rc, err
+}
+
+// session returns the id of the request session. The sessions
+// of different users are kept apart even if their ids clash.
+func session(r *http.Request) string {
+	id := r.Header.Get(SessionHeader)
+	if id == "" {
+		return ""
+	}
+	return owner(r) + "/" + id
+}
+
+// UndoAPI is a handler function that handles http requests to undo
+// or redo the operations made in the session given by the SessionHeader.
+func UndoAPI(w http.ResponseWriter, r *http.Request) {
+	var err error
+	id := session(r)
+	switch {
+	case r.Method != "POST":
+		err = badRequestError(fmt.Errorf("%s doesn't implemented", r.Method))
+	case id == "":
+		err = badRequestError(fmt.Errorf("missing %s header", SessionHeader))
+	case r.URL.Path == UndoPath:
+		err = undo(w, r, id)
+	case r.URL.Path == RedoPath:
+		err = redo(w, r, id)
+	default:
+		err = notFoundError(fmt.Errorf("%s doesn't exists", r.URL.Path))
+	}
+	errorHandler(w, r, err)
+}
+
+// undo handles requests for reverting the most recent operation of the session.
+func undo(w http.ResponseWriter, r *http.Request, id string) error {
+	changes, err := sessions.revert(r, id,
+		func(j *journal) *[][]change { return &j.undo },
+		func(j *journal) *[][]change { return &j.redo })
+	if err != nil {
+		return err
+	}
+	return writeReverted(w, r, changes)
+}
+
+// redo handles requests for reverting the most recent undo of the session.
+func redo(w http.ResponseWriter, r *http.Request, id string) error {
+	changes, err := sessions.revert(r, id,
+		func(j *journal) *[][]change { return &j.redo },
+		func(j *journal) *[][]change { return &j.undo })
+	if err != nil {
+		return err
+	}
+	return writeReverted(w, r, changes)
+}
+
+// writeReverted records the reverted changes in the history
+// and writes the reverted tasks to the response.
+func writeReverted(w http.ResponseWriter, r *http.Request, changes []change) error {
+	revisions.record(actor(r), changes...)
+	res := struct {
+		Tasks []*Task `json:"tasks"`
+	}{}
+	for _, c := range changes {
+		res.Tasks = append(res.Tasks, c.after)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res)
+}
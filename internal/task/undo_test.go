@@ -0,0 +1,200 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// sendInSession sends a request with the given body in session to handler h.
+func sendInSession(t *testing.T, h http.HandlerFunc, method, path, session, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set(SessionHeader, session)
+	}
+	rec := httptest.NewRecorder()
+	h(rec, req)
+	return rec
+}
+
+// checkTasks checks that the live and the deleted tasks are as expected.
+func checkTasks(t *testing.T, step string, live, deleted []int) {
+	var gotLive, gotDeleted []int
+	for _, task := range tasks.All() {
+		gotLive = append(gotLive, task.ID)
+	}
+	for _, task := range tasks.Trash() {
+		gotDeleted = append(gotDeleted, task.ID)
+	}
+	if !reflect.DeepEqual(gotLive, live) || !reflect.DeepEqual(gotDeleted, deleted) {
+		t.Errorf("%s: got live %v, deleted %v; want live %v, deleted %v", step, gotLive, gotDeleted, live, deleted)
+	}
+}
+
+func TestUndoRedoReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	sessions = newJournals()
+
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", Path, `{"title":"Task 0"}`},
+		{"PUT", Path + "0", `{"id":0,"title":"Updated Task 0"}`},
+		{"DELETE", Path + "0", ""},
+	} {
+		if rec := sendInSession(t, RestAPI, req.method, req.path, "s1", req.body); rec.Code != http.StatusOK {
+			t.Fatalf("%s %s: got status code %d; want %d", req.method, req.path, rec.Code, http.StatusOK)
+		}
+	}
+
+	for _, step := range []struct {
+		path    string
+		live    []int
+		deleted []int
+		title   string
+	}{
+		{UndoPath, []int{0}, nil, "Updated Task 0"},
+		{UndoPath, []int{0}, nil, "Task 0"},
+		{UndoPath, nil, []int{0}, "Task 0"},
+		{RedoPath, []int{0}, nil, "Task 0"},
+		{RedoPath, []int{0}, nil, "Updated Task 0"},
+		{RedoPath, nil, []int{0}, "Updated Task 0"},
+	} {
+		rec := sendInSession(t, UndoAPI, "POST", step.path, "s1", "")
+		if err := checkStatusCode(rec.Code, http.StatusOK); err != nil {
+			t.Fatalf("POST %s: %v\nRecieve body: %q", step.path, err, rec.Body)
+		}
+		checkTasks(t, "POST "+step.path, step.live, step.deleted)
+		if task, _ := state(context.Background(), storage(), 0); task.Title != step.title {
+			t.Errorf("POST %s: got title %q; want %q", step.path, task.Title, step.title)
+		}
+	}
+
+	// Everything was redone.
+	if rec := sendInSession(t, UndoAPI, "POST", RedoPath, "s1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("POST %s: got status code %d; want %d", RedoPath, rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestUndoBulkReq(t *testing.T) {
+	tasks = NewManager()
+	sessions = newJournals()
+	if err := addTasks(tasks, testTasks[:1], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	json := `{"operations":[{"op":"create","title":"Task 1"},{"op":"create","title":"Task 2"},{"op":"delete","id":0}]}`
+	if rec := sendInSession(t, RestAPI, "POST", BulkPath, "s1", json); rec.Code != http.StatusOK {
+		t.Fatalf("POST %s: got status code %d; want %d", BulkPath, rec.Code, http.StatusOK)
+	}
+	checkTasks(t, "POST "+BulkPath, []int{1, 2}, []int{0})
+
+	if rec := sendInSession(t, UndoAPI, "POST", UndoPath, "s1", ""); rec.Code != http.StatusOK {
+		t.Fatalf("POST %s: got status code %d; want %d", UndoPath, rec.Code, http.StatusOK)
+	}
+	checkTasks(t, "POST "+UndoPath, []int{0}, []int{2, 1})
+}
+
+func TestUndoConflictReq(t *testing.T) {
+	tasks = NewManager()
+	sessions = newJournals()
+	if err := addTasks(tasks, testTasks[:1], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	sendInSession(t, RestAPI, "PUT", Path+"0", "s1", `{"id":0,"title":"By s1"}`)
+	sendInSession(t, RestAPI, "PUT", Path+"0", "s2", `{"id":0,"title":"By s2"}`)
+
+	rec := sendInSession(t, UndoAPI, "POST", UndoPath, "s1", "")
+	if err := checkStatusCode(rec.Code, http.StatusConflict); err != nil {
+		t.Errorf("POST %s: %v", UndoPath, err)
+	}
+	if task, _ := tasks.Find(0); task.Title != "By s2" {
+		t.Errorf("POST %s: got title %q; want %q", UndoPath, task.Title, "By s2")
+	}
+
+	// The other session can still undo its own change.
+	if rec := sendInSession(t, UndoAPI, "POST", UndoPath, "s2", ""); rec.Code != http.StatusOK {
+		t.Errorf("POST %s: got status code %d; want %d", UndoPath, rec.Code, http.StatusOK)
+	}
+	if task, _ := tasks.Find(0); task.Title != "By s1" {
+		t.Errorf("POST %s: got title %q; want %q", UndoPath, task.Title, "By s1")
+	}
+
+	// The undo which failed can be retried.
+	if rec := sendInSession(t, UndoAPI, "POST", UndoPath, "s1", ""); rec.Code != http.StatusOK {
+		t.Errorf("POST %s retried: got status code %d; want %d", UndoPath, rec.Code, http.StatusOK)
+	}
+	if task, _ := tasks.Find(0); task.Title != testTasks[0].Title {
+		t.Errorf("POST %s retried: got title %q; want %q", UndoPath, task.Title, testTasks[0].Title)
+	}
+	if rec := sendInSession(t, UndoAPI, "POST", UndoPath, "s1", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("POST %s: got status code %d; want %d", UndoPath, rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestUndoReqError(t *testing.T) {
+	sessions = newJournals()
+	for _, test := range []struct {
+		method  string
+		path    string
+		session string
+		code    int
+	}{
+		{"POST", UndoPath, "", http.StatusBadRequest},
+		{"GET", UndoPath, "s1", http.StatusBadRequest},
+		{"POST", UndoPath, "s1", http.StatusNotFound},
+		{"POST", RedoPath, "s1", http.StatusNotFound},
+	} {
+		rec := sendInSession(t, UndoAPI, test.method, test.path, test.session, "")
+		if err := checkStatusCode(rec.Code, test.code); err != nil {
+			t.Errorf("HTTP request %s %s: %v", test.method, test.path, err)
+			t.Errorf("Recieve body: %q", rec.Body)
+		}
+	}
+}
+
+func TestUndoEmptyImportReq(t *testing.T) {
+	tasks = NewManager()
+	revisions = newHistory()
+	sessions = newJournals()
+
+	body := `[{"description":"Old task","status":"deleted"}]`
+	if rec := sendInSession(t, RestAPI, "POST", ImportPath, "s1", body); rec.Code != http.StatusOK {
+		t.Fatalf("POST %s: got status code %d; want %d\nRecieve body: %q", ImportPath, rec.Code, http.StatusOK, rec.Body)
+	}
+	for _, session := range []string{"s1", "s2"} {
+		rec := sendInSession(t, UndoAPI, "POST", UndoPath, session, "")
+		if err := checkStatusCode(rec.Code, http.StatusNotFound); err != nil {
+			t.Errorf("POST %s in session %s: %v\nRecieve body: %q", UndoPath, session, err, rec.Body)
+		}
+	}
+}
+
+func TestJournalBound(t *testing.T) {
+	s := newJournals()
+	for i := 0; i < maxUndo+10; i++ {
+		s.record("s1", []change{{nil, &Task{ID: i}}})
+	}
+	j := s.sessions["s1"]
+	if got := len(j.undo); got != maxUndo {
+		t.Errorf("got %d undoable changes; want %d", got, maxUndo)
+	}
+	if got, want := j.undo[0][0].after.ID, 10; got != want {
+		t.Errorf("got oldest undoable task %d; want %d", got, want)
+	}
+	s.record("s1", nil)
+	if got := len(j.undo); got != maxUndo {
+		t.Errorf("got %d undoable changes after recording no changes; want %d", got, maxUndo)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxDate is the latest valid task date, 9999-12-31T23:59:59Z.
+const maxDate = 253402300799
+
+// DefaultRules are the rules which the stored tasks must satisfy.
+var DefaultRules = Rules{
+	Trim("title"),
+	Required("title"),
+	MaxLen("title", 200),
+	Between("priority", PriorityNone, PriorityHigh),
+	Between("date", 0, maxDate),
+	Zone("timeZone"),
+	MaxSize("note", 64<<10),
+}
+
+// FieldError describes a violation of a rule by a task field.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError reports the fields of a task which violate the rules.
+type ValidationError struct {
+	Op     string // One of create or update.
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	s := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		s[i] = f.Field + ": " + f.Message
+	}
+	return fmt.Sprintf("%s: invalid task: %s", e.Op, strings.Join(s, "; "))
+}
+
+// Rule checks, and possibly normalizes, a field of a task.
+type Rule struct {
+	Field string // JSON name of the field.
+
+	// Check returns a description of the violation of the rule
+	// or "" if the field value v is valid. It may change v.
+	Check func(v reflect.Value) string
+}
+
+// Rules is a list of rules which are checked in order.
+type Rules []Rule
+
+// Check normalizes t and checks it by all rules. It returns
+// the violations, at most one for every field, or nil if t is valid.
+func (rs Rules) Check(t *Task) []FieldError {
+	var r []FieldError
+	v := reflect.ValueOf(t).Elem()
+	invalid := make(map[string]bool)
+	for _, rule := range rs {
+		if invalid[rule.Field] {
+			continue
+		}
+		if msg := rule.Check(v.Field(field(rule.Field))); msg != "" {
+			invalid[rule.Field] = true
+			r = append(r, FieldError{rule.Field, msg})
+		}
+	}
+	return r
+}
+
+// field returns the index of the Task field with given JSON name.
+// It panics if there is no such field.
+func field(name string) int {
+	typ := reflect.TypeOf(Task{})
+	for i := 0; i < typ.NumField(); i++ {
+		if strings.Split(typ.Field(i).Tag.Get("json"), ",")[0] == name {
+			return i
+		}
+	}
+	panic(fmt.Sprintf("task: unknown field %q", name))
+}
+
+// Trim returns a Rule which removes leading and
+// trailing white space of the string field.
+func Trim(name string) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		v.SetString(strings.TrimSpace(v.String()))
+		return ""
+	}}
+}
+
+// Required returns a Rule which requires a non-zero field.
+func Required(name string) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		if v.IsZero() {
+			return "is required"
+		}
+		return ""
+	}}
+}
+
+// MaxLen returns a Rule which limits the number
+// of characters of the string field to n.
+func MaxLen(name string, n int) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		if utf8.RuneCountInString(v.String()) > n {
+			return fmt.Sprintf("must be at most %d characters long", n)
+		}
+		return ""
+	}}
+}
+
+// MaxSize returns a Rule which limits the size
+// of the string field to n bytes.
+func MaxSize(name string, n int) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		if len(v.String()) > n {
+			return fmt.Sprintf("must be at most %d bytes long", n)
+		}
+		return ""
+	}}
+}
+
+// Between returns a Rule which requires the integer field to be in the range [min, max].
+func Between(name string, min, max int64) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		var n int64
+		switch v.Kind() {
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			n = int64(v.Uint())
+		default:
+			n = v.Int()
+		}
+		if n < min || n > max {
+			return fmt.Sprintf("must be between %d and %d", min, max)
+		}
+		return ""
+	}}
+}
+
+// Zone returns a Rule which requires the string field
+// to be empty or an IANA time zone name.
+func Zone(name string) Rule {
+	field(name)
+	return Rule{name, func(v reflect.Value) string {
+		if tz := v.String(); tz != "" {
+			if _, err := loadLocation(tz); err != nil || tz == "Local" {
+				return "must be an IANA time zone"
+			}
+		}
+		return ""
+	}}
+}
+
+// Validate returns a Middleware which normalizes and checks by the rules rs
+// the tasks to be created and updated. An invalid task isn't stored and the
+// operation fails with *ValidationError.
+func Validate(rs Rules) Middleware {
+	return func(m Manager) Manager {
+		return &validated{m, rs}
+	}
+}
+
+// validated is a Manager validating the tasks stored by the Manager it wraps.
+type validated struct {
+	Manager
+	rs Rules
+}
+
+// WithContext returns m whose operations are made with ctx.
+func (m *validated) WithContext(ctx context.Context) Manager {
+	return &validated{WithContext(ctx, m.Manager), m.rs}
+}
+
+func (m *validated) Create(title string) (*Task, error) {
+	t := &Task{Title: title}
+	if f := m.rs.Check(t); f != nil {
+		return nil, &ValidationError{"create", f}
+	}
+	return m.Manager.Create(t.Title)
+}
+
+func (m *validated) Update(task *Task) error {
+	t := *task // Copy the task to keep the normalization private.
+	if f := m.rs.Check(&t); f != nil {
+		return &ValidationError{"update", f}
+	}
+	return m.Manager.Update(&t)
+}
+
+func (m *validated) Tx(fn func(m Manager) error) error {
+	return m.Manager.Tx(func(tx Manager) error { return fn(&validated{tx, m.rs}) })
+}
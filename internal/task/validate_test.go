@@ -0,0 +1,127 @@
+// Copyright 2015 Peter Mrekaj. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRulesCheck(t *testing.T) {
+	for _, test := range []struct {
+		in   Task
+		out  Task
+		errs []FieldError
+	}{
+		{Task{Title: "Task 0"}, Task{Title: "Task 0"}, nil},
+		{Task{Title: "  Task 0\n", Priority: PriorityHigh, Date: 1426691590, Note: "Note"},
+			Task{Title: "Task 0", Priority: PriorityHigh, Date: 1426691590, Note: "Note"}, nil},
+		{Task{Title: strings.Repeat("ž", 200)}, Task{Title: strings.Repeat("ž", 200)}, nil},
+		{Task{Title: " \t "}, Task{}, []FieldError{{"title", "is required"}}},
+		{Task{Title: strings.Repeat("x", 201)}, Task{Title: strings.Repeat("x", 201)},
+			[]FieldError{{"title", "must be at most 200 characters long"}}},
+		{Task{Title: "Task 0", Priority: 4}, Task{Title: "Task 0", Priority: 4},
+			[]FieldError{{"priority", "must be between 0 and 3"}}},
+		{Task{Title: "Task 0", Date: -1, Note: strings.Repeat("x", 64<<10+1)},
+			Task{Title: "Task 0", Date: -1, Note: strings.Repeat("x", 64<<10+1)},
+			[]FieldError{{"date", "must be between 0 and 253402300799"}, {"note", "must be at most 65536 bytes long"}}},
+	} {
+		got := test.in
+		errs := DefaultRules.Check(&got)
+		if !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("Check(%.40v) = %v; want %v", test.in, errs, test.errs)
+		}
+		if !reflect.DeepEqual(got, test.out) {
+			t.Errorf("Check(%.40v) normalized the task to %.40v; want %.40v", test.in, got, test.out)
+		}
+	}
+}
+
+func TestUnknownRuleField(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Required(\"unknown\") didn't panic")
+		}
+	}()
+	Required("unknown")
+}
+
+func TestValidate(t *testing.T) {
+	m := Wrap(NewManager(), Validate(DefaultRules))
+	task, err := m.Create("  Task 0 ")
+	if err != nil {
+		t.Fatalf("Create: unexpected error: %v", err)
+	}
+	if task.Title != "Task 0" {
+		t.Errorf("Create: got title %q; want %q", task.Title, "Task 0")
+	}
+
+	var verr *ValidationError
+	if _, err := m.Create(" "); !errors.As(err, &verr) || verr.Op != "create" {
+		t.Errorf("Create(\" \"): got error %v; want *ValidationError of create", err)
+	}
+	u := &Task{ID: 0, Title: "Task 0", Priority: 9}
+	err = m.Tx(func(m Manager) error { return m.Update(u) })
+	if want := "update: invalid task: priority: must be between 0 and 3"; err == nil || err.Error() != want {
+		t.Errorf("Update(%v): got error %v; want %s", u, err, want)
+	}
+	u = &Task{ID: 0, Title: " Updated Task 0 ", Priority: PriorityLow}
+	if err := m.Update(u); err != nil {
+		t.Errorf("Update(%v): unexpected error: %v", u, err)
+	}
+	if u.Title != " Updated Task 0 " {
+		t.Errorf("Update normalized the task of the caller to %v", u)
+	}
+	if got, want := ptrToVal(m.All()), []Task{{ID: 0, Title: "Updated Task 0", Priority: PriorityLow}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got tasks %v; want %v", got, want)
+	}
+}
+
+func TestInvalidReq(t *testing.T) {
+	tasks = Wrap(NewManager(), Validate(DefaultRules))
+	defer func() { tasks = NewManager() }()
+	if err := addTasks(tasks, testTasks[:], t); err != nil {
+		t.Fatalf("cannot initialize test with tasks due to: %v", err)
+	}
+
+	for _, test := range []struct {
+		method, path, body string
+		fields             []FieldError
+	}{
+		{"POST", Path, `{"title":"   "}`, []FieldError{{"title", "is required"}}},
+		{"PUT", Path + "0", `{"id":0,"title":"Task 0","priority":7,"date":-5}`,
+			[]FieldError{{"priority", "must be between 0 and 3"}, {"date", "must be between 0 and 253402300799"}}},
+	} {
+		req, err := http.NewRequest(test.method, test.path, bytes.NewBufferString(test.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		RestAPI(rec, req)
+		if err := checkStatusCode(rec.Code, http.StatusUnprocessableEntity); err != nil {
+			t.Errorf("%s %s: %v\nRecieve body: %q", test.method, test.path, err, rec.Body)
+			continue
+		}
+		var res struct {
+			Error  string       `json:"error"`
+			Fields []FieldError `json:"fields"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&res); err != nil {
+			t.Errorf("%s %s: cannot decode the response: %v", test.method, test.path, err)
+		}
+		if !reflect.DeepEqual(res.Fields, test.fields) {
+			t.Errorf("%s %s: got fields %v; want %v", test.method, test.path, res.Fields, test.fields)
+		}
+	}
+	if got, want := ptrToVal(tasks.All()), testTasks[:]; !reflect.DeepEqual(got, want) {
+		t.Errorf("invalid requests changed the tasks to %v; want %v", got, want)
+	}
+}
@@ -5,30 +5,217 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata" // Time zones of tasks don't depend on the system.
 
+	"github.com/mrekucci/todo/internal/auth"
+	"github.com/mrekucci/todo/internal/config"
+	"github.com/mrekucci/todo/internal/cors"
+	"github.com/mrekucci/todo/internal/logging"
+	"github.com/mrekucci/todo/internal/metrics"
 	"github.com/mrekucci/todo/internal/task"
 )
 
-// corsHeaders wraps http.HandlerFunc and adds CORS headers to response.
-// Function also handles pre-flight requests.
-func corsHeaders(fn http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
-		w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-		if r.Method == "OPTIONS" { // Stop the pre-flight request.
-			return
+// jwtVerifier returns a verifier configured by the jwt settings
+// or nil if no JWT key was given.
+func jwtVerifier(c *config.Config) (*auth.Verifier, error) {
+	if c.JWT.HMACKey == "" && c.JWT.RSAKey == "" && c.JWT.JWKS == "" {
+		return nil, nil
+	}
+	v := auth.NewVerifier()
+	v.Audience, v.Issuer, v.UserClaim = c.JWT.Audience, c.JWT.Issuer, c.JWT.UserClaim
+	v.Leeway, v.RequireExp = c.JWT.Leeway, c.JWT.RequireExp
+	if c.JWT.HMACKey != "" {
+		if err := v.LoadHMACKeyFile("", c.JWT.HMACKey); err != nil {
+			return nil, err
+		}
+	}
+	if c.JWT.RSAKey != "" {
+		if err := v.LoadRSAKeyFile("", c.JWT.RSAKey); err != nil {
+			return nil, err
+		}
+	}
+	if c.JWT.JWKS != "" {
+		if err := v.LoadJWKSFile(c.JWT.JWKS); err != nil {
+			return nil, err
+		}
+	}
+	return v, nil
+}
+
+// setupUsers sets the registration policy and, for the file backend,
+// the persistent store of the users and their tokens.
+func setupUsers(c *config.Config) error {
+	var token string
+	if c.Users.AdminToken != "" {
+		b, err := os.ReadFile(c.Users.AdminToken)
+		if err != nil {
+			return err
+		}
+		if token = strings.TrimSpace(string(b)); token == "" {
+			return fmt.Errorf("empty admin token in %s", c.Users.AdminToken)
+		}
+	}
+	auth.SetRegistration(c.Users.Registration, token)
+	if c.Storage.Backend == "file" {
+		s, err := auth.OpenStore(c.Storage.Path + ".users")
+		if err != nil {
+			return err
+		}
+		auth.SetStore(s)
+	}
+	return nil
+}
+
+// manager returns the task Manager of the configured storage backend.
+func manager(c *config.Config) (task.Manager, error) {
+	if c.Storage.Backend == "file" {
+		if err := task.OpenHistory(c.Storage.Path + ".history"); err != nil {
+			return nil, err
 		}
-		fn(w, r)
+		return task.NewFileManager(c.Storage.Path)
 	}
+	return task.NewManager(), nil
 }
 
 func main() {
-	http.Handle(task.Path, http.HandlerFunc(corsHeaders(task.RestAPI)))
-	http.Handle("/", http.FileServer(http.Dir("frontend/web")))
-	if err := http.ListenAndServe(":8080", nil); err != nil {
+	c, err := config.Load(os.Args[0], os.Args[1:], os.Getenv)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		log.Fatal(err)
+	}
+	if c.PrintConfig {
+		if err := c.Write(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	var level slog.Level
+	level.UnmarshalText([]byte(c.Log.Level)) // Validated.
+	logger, err := logging.New(os.Stderr, logging.Options{Level: level, Format: c.Log.Format, Redact: c.Log.Redact})
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	v, err := jwtVerifier(c)
+	if err != nil {
+		log.Fatal("JWT: ", err)
+	}
+	if v != nil {
+		auth.SetVerifier(v)
+	}
+	if err := setupUsers(c); err != nil {
+		log.Fatal("Users: ", err)
+	}
+	m, err := manager(c)
+	if err != nil {
+		log.Fatal("Storage: ", err)
+	}
+	metrics.Count(m)
+	task.SetManager(task.Wrap(m, metrics.Manager, task.Logging(slog.Default()), task.Validate(task.DefaultRules)))
+	task.SetIdempotencyWindow(c.Idempotency.Window)
+	stop := make(chan struct{})
+	if c.Trash.Days > 0 {
+		go task.PurgeTrash(time.Duration(c.Trash.Days)*24*time.Hour, time.Hour, stop)
+	}
+
+	cc := cors.DefaultConfig()
+	cc.AllowedOrigins = c.CORS.Origins
+	cc.AllowCredentials = c.CORS.Credentials
+	cc.MaxAge = c.CORS.MaxAge
+	cc.ExposedHeaders = c.CORS.ExposedHeaders
+	policy, err := cors.New(cc)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// api wraps the handler fn of the API resource at path.
+	api := func(path string, fn http.HandlerFunc) http.HandlerFunc {
+		fn = policy.Handler(fn)
+		if c.Log.Access {
+			fn = logging.AccessLog(fn)
+		}
+		return metrics.Handler(path, logging.Handler(fn))
+	}
+
+	http.HandleFunc(task.Path, api(task.Path, auth.Required(task.RestAPI)))
+	http.HandleFunc(task.TrashPath, api(task.TrashPath, auth.Required(task.TrashAPI)))
+	http.HandleFunc(task.SharePath, api(task.SharePath, auth.Required(task.ShareAPI)))
+	http.HandleFunc(task.UndoPath, api(task.UndoPath, auth.Required(task.UndoAPI)))
+	http.HandleFunc(task.RedoPath, api(task.RedoPath, auth.Required(task.UndoAPI)))
+	http.HandleFunc(task.CalendarPath, api(task.CalendarPath, auth.Required(task.CalendarAPI)))
+	http.HandleFunc(task.DAVPath, api(task.DAVPath, auth.Required(task.DAVAPI)))
+	http.Handle("/.well-known/caldav", http.RedirectHandler(task.DAVPath, http.StatusMovedPermanently))
+	http.HandleFunc(task.OpenAPIPath, api(task.OpenAPIPath, task.OpenAPI))
+	http.HandleFunc(auth.UserPath, api(auth.UserPath, auth.UserAPI))
+	http.HandleFunc(auth.TokenPath, api(auth.TokenPath, auth.Required(auth.TokenAPI)))
+	http.HandleFunc(metrics.Path, metrics.MetricsAPI)
+	http.HandleFunc(task.HealthzPath, task.HealthAPI)
+	http.HandleFunc(task.ReadyzPath, task.ReadyAPI)
+	if c.Static != "" {
+		if _, err := os.Stat(c.Static); err != nil {
+			slog.Warn("web frontend is unavailable", "err", err)
+		}
+		http.Handle("/", http.FileServer(http.Dir(c.Static)))
+	}
+
+	srv := &http.Server{
+		Addr:              c.Addr,
+		ReadHeaderTimeout: c.Timeouts.ReadHeader,
+		ReadTimeout:       c.Timeouts.Read,
+		WriteTimeout:      c.Timeouts.Write,
+		IdleTimeout:       c.Timeouts.Idle,
+	}
+	errc := make(chan error, 1)
+	go func() {
+		if c.TLS.Cert != "" {
+			errc <- srv.ListenAndServeTLS(c.TLS.Cert, c.TLS.Key)
+		} else {
+			errc <- srv.ListenAndServe()
+		}
+	}()
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	select {
+	case err := <-errc:
 		log.Fatal("ListenAndServe: ", err)
+	case <-ctx.Done():
+	}
+	cancel() // A second signal kills the server immediately.
+
+	// Stop routing new requests to the server, wait for the requests
+	// in progress and save the changes they made. The listener stays
+	// open for the drain delay so load balancers see the readiness
+	// probe fail before connections are refused.
+	slog.Info("shutting down", "drain", c.Timeouts.Drain, "timeout", c.Timeouts.Shutdown)
+	task.Drain()
+	time.Sleep(c.Timeouts.Drain)
+	close(stop)
+	ctx, cancel = context.WithTimeout(context.Background(), c.Timeouts.Shutdown)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("shutdown: some requests didn't finish", "err", err)
+	}
+	if err := task.Flush(); err != nil {
+		log.Fatal("Flush: ", err)
 	}
 }